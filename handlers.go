@@ -0,0 +1,240 @@
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strconv"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib"
+	"github.com/verath/mrgitlab/lib/config"
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/handlers"
+	"github.com/verath/mrgitlab/lib/jira"
+	"github.com/verath/mrgitlab/lib/redact"
+	"github.com/verath/mrgitlab/lib/redmine"
+	"github.com/verath/mrgitlab/lib/youtrack"
+)
+
+// defaultIssueKeyPatterns are the patterns used for finding the issue keys
+// referenced by a merge request, unless the handler declares issue_keys.
+// The default is to find keys like "XYZ-982" in branches named e.g.
+// "feature/xyz982_some_feature".
+var defaultIssueKeyPatterns = []handlers.IssueKeyPattern{{
+	Regexp:   regexp.MustCompile(`(?i)^(?:feature|release-fix)/([a-z]+)([0-9]+)`),
+	Template: "$1-$2",
+	Sources:  []string{handlers.IssueKeySourceBranch},
+}}
+
+// defaultRedmineIssueKeyPatterns are the patterns used for finding the ids
+// of the Redmine issues referenced by a merge request, unless the handler
+// declares issue_keys. The default is to find ids like "1234" in branches
+// named e.g. "feature/1234-some-feature".
+var defaultRedmineIssueKeyPatterns = []handlers.IssueKeyPattern{{
+	Regexp:   regexp.MustCompile(`(?i)^(?:feature|release-fix)/([0-9]+)(?:[-_]|$)`),
+	Template: "$1",
+	Sources:  []string{handlers.IssueKeySourceBranch},
+}}
+
+// buildHandlers creates the clients and the handlers declared in the cfg,
+// returning the handlers as a HandlerSet.
+func buildHandlers(logger *logrus.Logger, cfg *config.Config) (*mrgitlab.HandlerSet, error) {
+	var youTrackClient *youtrack.Client
+	if cfg.YouTrack != nil {
+		var err error
+		if cfg.YouTrack.Token != "" {
+			youTrackClient, err = youtrack.NewTokenClient(logger, cfg.YouTrack.URL, cfg.YouTrack.Token)
+		} else {
+			youTrackClient, err = youtrack.NewClient(logger, cfg.YouTrack.URL,
+				cfg.YouTrack.Username, cfg.YouTrack.Password)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create YouTrack client")
+		}
+	}
+	var jiraClient *jira.Client
+	if cfg.Jira != nil {
+		var err error
+		if cfg.Jira.Username != "" {
+			jiraClient, err = jira.NewClient(logger, cfg.Jira.URL, cfg.Jira.Username, cfg.Jira.Token)
+		} else {
+			jiraClient, err = jira.NewTokenClient(logger, cfg.Jira.URL, cfg.Jira.Token)
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create Jira client")
+		}
+	}
+	var redmineClient *redmine.Client
+	if cfg.Redmine != nil {
+		var err error
+		redmineClient, err = redmine.NewClient(logger, cfg.Redmine.URL, cfg.Redmine.APIKey)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not create Redmine client")
+		}
+	}
+	// The GitLab issue tracker uses a client of its own, so that it is
+	// replaced together with the handlers
+	gitLabClient, err := gitlab.NewClient(logger, cfg.GitLab.URL, cfg.GitLab.Token)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not create GitLab client")
+	}
+	trackerFor := newTrackerFunc(cfg, youTrackClient, jiraClient, redmineClient, gitLabClient)
+	set := mrgitlab.NewHandlerSet()
+	for _, handlerCfg := range cfg.Handlers {
+		opts := []mrgitlab.HandlerOption{
+			mrgitlab.WithName(handlerCfg.Name),
+			mrgitlab.WithProjects(handlerCfg.Projects...),
+			mrgitlab.WithBranches(handlerCfg.Branches...),
+		}
+		if handlerCfg.Timeout > 0 {
+			opts = append(opts, mrgitlab.WithTimeout(handlerCfg.Timeout))
+		}
+		// Failures of youtrack_command handlers are always reported, as the
+		// merge request is otherwise the only place the commands are described
+		if handlerCfg.ErrorFooter || handlerCfg.Type == "youtrack_command" {
+			opts = append(opts, mrgitlab.WithErrorFooter())
+		}
+		switch handlerCfg.Event() {
+		case config.EventMergeRequest:
+			handler, err := newMergeRequestHandler(handlerCfg, youTrackClient, jiraClient, redmineClient, gitLabClient, trackerFor)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not create handler '%s'", handlerCfg.Name)
+			}
+			for _, action := range handlerCfg.Actions {
+				set.RegisterMergeRequestHandler(action, handler, opts...)
+			}
+		case config.EventPipeline:
+			handler, err := newPipelineHandler(handlerCfg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not create handler '%s'", handlerCfg.Name)
+			}
+			for _, status := range handlerCfg.Statuses {
+				set.RegisterPipelineHandler(status, handler, opts...)
+			}
+		}
+	}
+	return set, nil
+}
+
+// reloadHandlers re-reads the config file at configPath, and replaces the
+// handlers of the app with the handlers declared in it, returning the new
+// config. If the new config is invalid, the error is returned and the handlers
+// of the app are kept. Only the handlers and their clients are reloaded,
+// changes to the other settings of the config, compared to the current cfg,
+// i.e. the config last loaded, are logged as requiring a restart. The secrets
+// of the new config are added to the secrets masked by the redactHook, which
+// keeps masking the secrets of the earlier configs.
+func reloadHandlers(logger *logrus.Logger, app *mrgitlab.App, configPath string, cfg *config.Config, redactHook *redact.Hook) (*config.Config, error) {
+	newCfg, err := config.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+	set, err := buildHandlers(logger, newCfg)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(newCfg.Server, cfg.Server) || newCfg.GitLab != cfg.GitLab {
+		logger.Warn("Changes to the server or gitlab settings require a restart to take effect")
+	}
+	redactHook.AddSecrets(newCfg.Secrets()...)
+	app.ReplaceHandlers(set)
+	return newCfg, nil
+}
+
+// newMergeRequestHandler creates the merge request handler declared by
+// the handlerCfg.
+func newMergeRequestHandler(handlerCfg config.HandlerConfig, youTrackClient *youtrack.Client,
+	jiraClient *jira.Client, redmineClient *redmine.Client, gitLabClient *gitlab.Client,
+	trackerFor handlers.TrackerFunc) (mrgitlab.MergeRequestHandler, error) {
+	// The param has been validated, and defaults to no truncation
+	maxDescriptionLength, _ := strconv.Atoi(handlerCfg.Params["max_description_length"])
+	switch handlerCfg.Type {
+	case "youtrack":
+		return handlers.NewYouTrack(youTrackClient, newIssueKeyExtractor(handlerCfg, gitLabClient), maxDescriptionLength), nil
+	case "youtrack_backlink":
+		return handlers.NewYouTrackBackLink(handlers.NewYouTrackTracker(youTrackClient), youTrackClient,
+			newIssueKeyExtractor(handlerCfg, gitLabClient)), nil
+	case "youtrack_command":
+		commands := make([]handlers.YouTrackCommand, len(handlerCfg.Commands))
+		for i, command := range handlerCfg.Commands {
+			commands[i] = handlers.YouTrackCommand{TargetBranch: command.TargetBranch, Command: command.Command}
+		}
+		return handlers.NewYouTrackCommand(handlers.NewYouTrackTracker(youTrackClient),
+			newIssueKeyExtractor(handlerCfg, gitLabClient), commands, handlerCfg.DryRun), nil
+	case "jira":
+		return handlers.NewJira(jiraClient, newIssueKeyExtractor(handlerCfg, gitLabClient), maxDescriptionLength), nil
+	case "jira_remote_link":
+		return handlers.NewJiraRemoteLink(jiraClient, newIssueKeyExtractor(handlerCfg, gitLabClient)), nil
+	case "redmine":
+		return handlers.NewRedmine(redmineClient, newIssueKeyExtractor(handlerCfg, gitLabClient), maxDescriptionLength), nil
+	case "issues":
+		return handlers.NewIssues(trackerFor, newIssueKeyExtractor(handlerCfg, gitLabClient), maxDescriptionLength), nil
+	case "message":
+		return handlers.NewMessage(handlerCfg.Params["message"]), nil
+	case "url_file":
+		return handlers.NewURLFile(handlerCfg.Params["url"]), nil
+	}
+	return nil, errors.Errorf("unknown merge request handler type '%s'", handlerCfg.Type)
+}
+
+// newTrackerFunc creates the TrackerFunc returning the IssueTracker of each
+// project, as chosen by the trackers of the cfg. The clients of the trackers
+// used must be non-nil, which is ensured by the validation of the cfg.
+func newTrackerFunc(cfg *config.Config, youTrackClient *youtrack.Client, jiraClient *jira.Client,
+	redmineClient *redmine.Client, gitLabClient *gitlab.Client) handlers.TrackerFunc {
+	var youTrackTracker, jiraTracker, redmineTracker handlers.IssueTracker
+	if youTrackClient != nil {
+		youTrackTracker = handlers.NewYouTrackTracker(youTrackClient)
+	}
+	if jiraClient != nil {
+		jiraTracker = handlers.NewJiraTracker(jiraClient)
+	}
+	if redmineClient != nil {
+		redmineTracker = handlers.NewRedmineTracker(redmineClient)
+	}
+	return func(project *gitlab.Project) handlers.IssueTracker {
+		switch cfg.TrackerFor(project.PathWithNamespace) {
+		case "youtrack":
+			return youTrackTracker
+		case "jira":
+			return jiraTracker
+		case "redmine":
+			return redmineTracker
+		case "gitlab":
+			return handlers.NewGitLabTracker(gitLabClient, project)
+		}
+		return nil
+	}
+}
+
+// newPipelineHandler creates the pipeline handler declared by the handlerCfg.
+func newPipelineHandler(handlerCfg config.HandlerConfig) (mrgitlab.PipelineHandler, error) {
+	switch handlerCfg.Type {
+	case "pipeline_failure":
+		return handlers.NewPipelineFailure(), nil
+	}
+	return nil, errors.Errorf("unknown pipeline handler type '%s'", handlerCfg.Type)
+}
+
+// newIssueKeyExtractor creates the IssueKeyExtractor for the issue_keys
+// declared by the handlerCfg, or else for the default patterns of the type
+// of the handler. The commits of merge requests are listed using the
+// gitLabClient. The issue keys must have been validated.
+func newIssueKeyExtractor(handlerCfg config.HandlerConfig, gitLabClient *gitlab.Client) *handlers.IssueKeyExtractor {
+	if len(handlerCfg.IssueKeys) == 0 {
+		if handlerCfg.Type == "redmine" {
+			return handlers.NewIssueKeyExtractor(gitLabClient, defaultRedmineIssueKeyPatterns...)
+		}
+		return handlers.NewIssueKeyExtractor(gitLabClient, defaultIssueKeyPatterns...)
+	}
+	patterns := make([]handlers.IssueKeyPattern, len(handlerCfg.IssueKeys))
+	for i, issueKey := range handlerCfg.IssueKeys {
+		patterns[i] = handlers.IssueKeyPattern{
+			Regexp:   regexp.MustCompile(issueKey.Pattern),
+			Template: issueKey.Template,
+			Sources:  issueKey.Sources,
+		}
+	}
+	return handlers.NewIssueKeyExtractor(gitLabClient, patterns...)
+}
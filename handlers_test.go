@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/verath/mrgitlab/lib"
+	"github.com/verath/mrgitlab/lib/config"
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/queue"
+	"github.com/verath/mrgitlab/lib/redact"
+)
+
+func TestDefaultIssueKeyPatterns(t *testing.T) {
+	tests := []struct {
+		branchName string
+		expectedID string
+	}{
+		{"feature/xyz982", "XYZ-982"},
+		{"feature/XYZ982", "XYZ-982"},
+		{"feature/XYZ-982", ""},
+		{"XYZ-982", ""},
+		{"feature/XYZ982_some_feature", "XYZ-982"},
+		{"feature/some_feature", ""},
+		{"feature/some_xyz982_feature", ""},
+		{"release-fix/XYZ982_some_feature", "XYZ-982"},
+	}
+
+	extractor := newIssueKeyExtractor(config.HandlerConfig{}, nil)
+	for _, test := range tests {
+		webhook := &gitlab.MergeRequestWebhook{}
+		webhook.ObjectAttributes.SourceBranch = test.branchName
+		// The title is not a source of the default patterns
+		webhook.ObjectAttributes.Title = "ABC-123"
+		keys, err := extractor.Extract(context.Background(), webhook)
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		var actual string
+		if len(keys) > 0 {
+			actual = keys[0]
+		}
+		if actual != test.expectedID {
+			t.Errorf("expected '%s' for branch name '%s', got: '%s'",
+				test.expectedID, test.branchName, actual)
+		}
+	}
+}
+
+func TestDefaultRedmineIssueKeyPatterns(t *testing.T) {
+	tests := []struct {
+		branchName string
+		expectedID string
+	}{
+		{"feature/1234-foo", "1234"},
+		{"feature/1234_foo", "1234"},
+		{"feature/1234", "1234"},
+		{"Feature/1234-foo", "1234"},
+		{"release-fix/1234-foo", "1234"},
+		{"feature/1234foo", ""},
+		{"feature/xyz982", ""},
+		{"feature/foo-1234", ""},
+		{"1234-foo", ""},
+	}
+
+	extractor := newIssueKeyExtractor(config.HandlerConfig{Type: "redmine"}, nil)
+	for _, test := range tests {
+		webhook := &gitlab.MergeRequestWebhook{}
+		webhook.ObjectAttributes.SourceBranch = test.branchName
+		keys, err := extractor.Extract(context.Background(), webhook)
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		var actual string
+		if len(keys) > 0 {
+			actual = keys[0]
+		}
+		if actual != test.expectedID {
+			t.Errorf("expected '%s' for branch name '%s', got: '%s'",
+				test.expectedID, test.branchName, actual)
+		}
+	}
+}
+
+// newReloadTestApp creates an App, using a job queue in a new temporary
+// directory, and returns it with the path of a config file in the directory.
+// The returned func shuts down the app and removes the directory.
+func newReloadTestApp(t *testing.T) (*mrgitlab.App, string, func()) {
+	dir, err := ioutil.TempDir("", "mrgitlab-main")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	jobQueue, err := queue.Open(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	deadLetters, err := queue.OpenDeadLetters(filepath.Join(dir, "deadletters"))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	app, err := mrgitlab.New(logrus.New(), nil, "", jobQueue, deadLetters)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	return app, filepath.Join(dir, "mrgitlab.yml"), func() {
+		app.Shutdown(context.Background())
+		jobQueue.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestReloadHandlers_KeepsRunningHandlersOnInvalidConfig(t *testing.T) {
+	app, configPath, cleanup := newReloadTestApp(t)
+	defer cleanup()
+	logger := logrus.New()
+	cfg := &config.Config{}
+
+	tests := []struct {
+		config        string
+		expectedError string
+	}{
+		{"gitlab: {token: x}\nhandlers: [{type: message, actions: [open], params: {message: hi}}]", ""},
+		{"gitlab: {token: x}\nhandlers: [{type: message, actions: [open]}]", "param 'message' is required"},
+		{"gitlab: {token: x}\nhandlers: [{type: youtrack, actions: [open], issue_keys: [{pattern: '(', sources: [branch]}]}]\n" +
+			"youtrack: {url: 'http://track.example.com', username: u, password: p}", "issue_keys[0]: invalid pattern"},
+	}
+	for _, test := range tests {
+		if err := ioutil.WriteFile(configPath, []byte(test.config), 0600); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		_, err := reloadHandlers(logger, app, configPath, cfg, redact.NewHook())
+		if test.expectedError == "" && err != nil {
+			t.Errorf("unexpected error for config '%s': %+v", test.config, err)
+		} else if test.expectedError != "" && (err == nil || !strings.Contains(err.Error(), test.expectedError)) {
+			t.Errorf("expected error containing '%s' for config '%s', got: %v",
+				test.expectedError, test.config, err)
+		}
+	}
+}
+
+// Test that each reload is compared to the config loaded last, so that the
+// restart warning is only logged once, and that the secrets of all loaded
+// configs remain masked.
+func TestReloadHandlers_ComparesToLastConfig(t *testing.T) {
+	app, configPath, cleanup := newReloadTestApp(t)
+	defer cleanup()
+	buf := &bytes.Buffer{}
+	logger := logrus.New()
+	logger.Out = buf
+	redactHook := redact.NewHook("startup-token")
+	logger.Hooks.Add(redactHook)
+	cfg := &config.Config{GitLab: config.GitLabConfig{URL: "https://gitlab.com/", Token: "startup-token"}}
+
+	var numWarnings int
+	for _, token := range []string{"first-token", "first-token"} {
+		data := "gitlab: {token: " + token + "}\nhandlers: [{type: message, actions: [open], params: {message: hi}}]"
+		if err := ioutil.WriteFile(configPath, []byte(data), 0600); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		buf.Reset()
+		newCfg, err := reloadHandlers(logger, app, configPath, cfg, redactHook)
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		cfg = newCfg
+		numWarnings += strings.Count(buf.String(), "require a restart")
+	}
+	if numWarnings != 1 {
+		t.Errorf("expected the restart warning to be logged once, was logged %d times", numWarnings)
+	}
+	if masked := redactHook.String("startup-token first-token"); strings.Contains(masked, "token") {
+		t.Errorf("expected the secrets of all configs to be masked, was: %s", masked)
+	}
+}
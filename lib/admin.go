@@ -0,0 +1,108 @@
+package mrgitlab
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AdminHandler returns an http handler for administrating the app. The
+// handler must be registered with any path prefix stripped, e.g. using
+// http.StripPrefix. All requests must include the adminToken as the
+// "X-Admin-Token" header. The following endpoints are provided:
+//
+//	GET    /deadletters            - lists the dead letters, as JSON
+//	POST   /deadletters/{id}/replay - re-queues the webhook of a dead letter
+//	DELETE /deadletters/{id}       - discards a dead letter
+//	GET    /stats                  - returns the handler failure counts, as JSON
+func (app *App) AdminHandler(adminToken string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if adminToken == "" || r.Header.Get("X-Admin-Token") != adminToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		if len(parts) == 1 && parts[0] == "stats" {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"handler_failures": app.HandlerFailures(),
+			})
+			return
+		}
+		if parts[0] != "deadletters" || len(parts) > 3 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if len(parts) == 1 {
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(app.deadLetters.List())
+			return
+		}
+		id, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch {
+		case len(parts) == 3 && parts[2] == "replay" && r.Method == http.MethodPost:
+			app.replayDeadLetter(w, id)
+		case len(parts) == 2 && r.Method == http.MethodDelete:
+			app.discardDeadLetter(w, id)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+// replayDeadLetter removes the dead letter identified by id and pushes its
+// job back to the jobQueue, so that it is handled again.
+func (app *App) replayDeadLetter(w http.ResponseWriter, id uint64) {
+	letter, err := app.deadLetters.Remove(id)
+	if err != nil {
+		app.logger.Errorf("Error removing dead letter %d: %+v", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if letter == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if _, err := app.jobQueue.Push(letter.Job.Event, letter.Job.Payload); err != nil {
+		app.logger.Errorf("Error queueing dead letter %d: %+v", id, err)
+		// Put the letter back, so that it is not lost
+		if _, err := app.deadLetters.Add(letter.Job, letter.Attempts, errors.New(letter.Error)); err != nil {
+			app.logger.Errorf("Error re-adding dead letter %d: %+v", id, err)
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	app.logger.Infof("Replaying dead letter %d", id)
+	w.WriteHeader(http.StatusOK)
+}
+
+// discardDeadLetter removes the dead letter identified by id.
+func (app *App) discardDeadLetter(w http.ResponseWriter, id uint64) {
+	letter, err := app.deadLetters.Remove(id)
+	if err != nil {
+		app.logger.Errorf("Error removing dead letter %d: %+v", id, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if letter == nil {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	app.logger.Infof("Discarded dead letter %d", id)
+	w.WriteHeader(http.StatusOK)
+}
@@ -1,21 +1,44 @@
 package mrgitlab
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
 	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/queue"
+	"github.com/verath/mrgitlab/lib/redact"
 )
 
-// handleWebhookTimeout specifies the max amount of
-// time that may elapse while handling a webhook
-const handleWebhookTimeout = 2 * time.Minute
+// postNoteTimeout specifies the max amount of time that may
+// elapse while posting the note for a webhook
+const postNoteTimeout = 30 * time.Second
+
+// mergeRequestNoteMarker returns the hidden (html comment) marker that is
+// added to the notes created by us for merge request events of the action.
+// It is used to find a previously added note so that it can be updated,
+// instead of adding a new note on each event. The "open", "reopen" and
+// "update" actions share a note, while each other action, e.g. "merge",
+// has its own, so that it does not overwrite the note of the others.
+func mergeRequestNoteMarker(action string) string {
+	switch action {
+	case "open", "reopen", "update":
+		return "<!-- mrgitlab:merge_request -->"
+	default:
+		return "<!-- mrgitlab:merge_request:" + action + " -->"
+	}
+}
+
+// pipelineNoteMarker is the marker added to notes created for pipeline
+// events. It is separate from the mergeRequestNoteMarker so that pipeline
+// notes does not overwrite the merge request notes, and vice versa.
+const pipelineNoteMarker = "<!-- mrgitlab:pipeline -->"
 
 // MergeRequestHandler is a handler for handling merge requests
 // events, triggered via GitLab webhooks. The assumption for a
@@ -28,10 +51,24 @@ type MergeRequestHandler interface {
 	// error should the context become cancelled before the handler
 	// can finish. The HandleMergeRequest must not modify the provided
 	// MergeRequestWebhook data. On success, a string may be returned
-	// which will be appended to a new note added to the merge request.
+	// which will be appended to the note added to the merge request.
 	HandleMergeRequest(context.Context, *gitlab.MergeRequestWebhook) (string, error)
 }
 
+// PipelineHandler is a handler for handling pipeline events, triggered
+// via GitLab webhooks. Similar to the MergeRequestHandler, the assumption
+// is that the handler wants to add a comment to the merge request(s) of
+// the branch the pipeline was run for.
+type PipelineHandler interface {
+	// HandlePipeline is called when a pipeline webhook have been received.
+	// The HandlePipeline must return the context's error should the context
+	// become cancelled before the handler can finish. The HandlePipeline
+	// must not modify the provided PipelineWebhook data. On success, a string
+	// may be returned which will be appended to the note added to the merge
+	// request(s) of the pipeline.
+	HandlePipeline(context.Context, *gitlab.PipelineWebhook) (string, error)
+}
+
 // App is the entry-point to the mrgitlab application. It implements
 // the http handler interface for handling webhooks and should be registered
 // to an http server.
@@ -43,40 +80,242 @@ type App struct {
 	// gitlabClient is the rest client we use to send information
 	// back to GitLab.
 	gitlabClient *gitlab.Client
+	// jobQueue is the durable queue that accepted webhooks are written
+	// to before they are handled by the workers.
+	jobQueue *queue.Queue
+	// deadLetters is the store that webhooks that could not be handled,
+	// even after retrying, are moved to.
+	deadLetters *queue.DeadLetterStore
+	// retryBackoff is the backoff used when retrying webhooks that
+	// failed with a transient error.
+	retryBackoff backoff
+	// deliveries holds the ids of recently accepted webhook deliveries,
+	// used for ignoring webhooks delivered more than once.
+	deliveries *deliveryStore
 
-	mergeRequestHandlersMu sync.RWMutex
-	// mergeRequestHandlers is a map from a merge request webhook action
-	// (i.e. "open", "close", ...) to a slice of handlers for that action.
-	mergeRequestHandlers map[string][]MergeRequestHandler
+	// stopCtx is cancelled when the app is shut down, signalling that
+	// no new webhooks should be accepted or handled.
+	stopCtx context.Context
+	stop    context.CancelFunc
+	// handlerCtx is the parent context of all handler contexts. It is
+	// cancelled if the handlers do not finish before the shutdown deadline.
+	handlerCtx     context.Context
+	cancelHandlers context.CancelFunc
+	// workersWg tracks the running workers.
+	workersWg sync.WaitGroup
+
+	// routes is a map from the "X-Gitlab-Event" header value of a webhook
+	// to the route used for decoding and dispatching that webhook.
+	routes map[string]eventRoute
+	// secretFields are the names of webhook fields that are masked,
+	// in addition to the always masked ones, when webhooks are logged.
+	secretFields []string
+
+	// handlersMu guards the handlers, which are replaced as a whole
+	// by ReplaceHandlers.
+	handlersMu sync.RWMutex
+	handlers   *HandlerSet
+	// handlerFailures counts the failures of each handler.
+	handlerFailures handlerFailureCounter
+
+	// botUserMu guards the botUser, the GitLab user we post notes as,
+	// which is fetched the first time it is needed.
+	botUserMu sync.Mutex
+	botUser   *gitlab.User
 }
 
 // New initializes an App instance. The webhookToken is a string that, if set, must also
-// be present in all webhook calls.
-func New(logger *logrus.Logger, gitlabClient *gitlab.Client, webhookToken string) (*App, error) {
+// be present in all webhook calls. The jobQueue is the queue accepted webhooks are
+// written to, and that the workers started by Start read from. The deadLetters is
+// the store where webhooks that failed to be handled are kept.
+func New(logger *logrus.Logger, gitlabClient *gitlab.Client, webhookToken string,
+	jobQueue *queue.Queue, deadLetters *queue.DeadLetterStore) (*App, error) {
 	logEntry := logger.WithField("module", "mrgitlab")
 	if webhookToken == "" {
 		logEntry.Warn("No webhook token, all requests will be accepted!")
 	}
-	return &App{
-		logger:               logEntry,
-		gitlabClient:         gitlabClient,
-		webhookToken:         webhookToken,
-		mergeRequestHandlers: make(map[string][]MergeRequestHandler),
-	}, nil
+	if jobQueue == nil || deadLetters == nil {
+		return nil, errors.New("jobQueue and deadLetters must not be nil")
+	}
+	stopCtx, stop := context.WithCancel(context.Background())
+	handlerCtx, cancelHandlers := context.WithCancel(context.Background())
+	app := &App{
+		logger:       logEntry,
+		gitlabClient: gitlabClient,
+		webhookToken: webhookToken,
+		jobQueue:     jobQueue,
+		deadLetters:  deadLetters,
+		retryBackoff: defaultBackoff,
+		deliveries:   newDeliveryStore(deliveryStoreSize, deliveryTTL),
+
+		stopCtx:        stopCtx,
+		stop:           stop,
+		handlerCtx:     handlerCtx,
+		cancelHandlers: cancelHandlers,
+		handlers:       NewHandlerSet(),
+	}
+	app.routes = app.newRoutes()
+	return app, nil
 }
 
 // RegisterMergeRequestHandler registers a MergeRequestHandler to the specified
 // action. Action is the action specified by GitLab for the webhook. The following
-// seems to be the only valid actions: "open", "close", "reopen", "merge".
-func (app *App) RegisterMergeRequestHandler(action string, handler MergeRequestHandler) {
-	app.mergeRequestHandlersMu.Lock()
-	app.mergeRequestHandlers[action] = append(app.mergeRequestHandlers[action], handler)
-	app.mergeRequestHandlersMu.Unlock()
+// seems to be the only valid actions: "open", "close", "reopen", "merge", "update".
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterMergeRequestHandler(action string, handler MergeRequestHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterMergeRequestHandler(action, handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterPipelineHandler registers a PipelineHandler to the specified pipeline
+// status. Status is the status of the pipeline as specified by GitLab for the
+// webhook, e.g. "pending", "running", "success", "failed" or "canceled". The opts
+// configure how the handler is run, see HandlerOption.
+func (app *App) RegisterPipelineHandler(status string, handler PipelineHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterPipelineHandler(status, handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// ReplaceHandlers atomically replaces all handlers registered to the app
+// with the handlers of the set. Webhooks already being handled complete
+// using the handlers they were dispatched to, while webhooks handled after
+// ReplaceHandlers returns are dispatched to the handlers of the set. The
+// set must not be modified after being passed to ReplaceHandlers.
+func (app *App) ReplaceHandlers(set *HandlerSet) {
+	app.handlersMu.Lock()
+	app.handlers = set
+	app.handlersMu.Unlock()
+}
+
+// SetSecretFields sets the names of fields of webhooks, e.g. "email", that
+// are masked when webhooks are logged, in addition to the fields that are
+// always masked, such as tokens and passwords. Must be called before Start.
+func (app *App) SetSecretFields(fields ...string) {
+	app.secretFields = fields
+}
+
+// Start starts the given number of workers, handling the webhooks of the
+// jobQueue. Any webhooks that were accepted but not handled before the
+// app was last stopped are handled first.
+func (app *App) Start(workers int) {
+	for i := 0; i < workers; i++ {
+		app.workersWg.Add(1)
+		go app.worker()
+	}
+}
+
+// Shutdown gracefully shuts down the app. New webhooks are rejected and the
+// workers stop picking up new jobs, after which Shutdown waits for the jobs
+// currently being handled to complete. If the ctx is done before then, the
+// contexts of the running handlers are cancelled and the ctx's error is
+// returned once the workers have stopped. Jobs that were not completed are
+// kept in the jobQueue, and are handled the next time the app is started.
+func (app *App) Shutdown(ctx context.Context) error {
+	app.stop()
+	workersDoneCh := make(chan struct{})
+	go func() {
+		app.workersWg.Wait()
+		close(workersDoneCh)
+	}()
+	select {
+	case <-workersDoneCh:
+		return nil
+	case <-ctx.Done():
+		app.logger.Warn("Shutdown deadline reached, cancelling running handlers")
+		app.cancelHandlers()
+		<-workersDoneCh
+		return ctx.Err()
+	}
+}
+
+// errShutdown is returned when handling of a job was aborted because
+// the app is being shut down.
+var errShutdown = errors.New("app is shutting down")
+
+// worker handles jobs from the jobQueue, one at a time, until the app is
+// shut down. Each job is marked as done once handled, or once it has been
+// moved to the deadLetters.
+func (app *App) worker() {
+	defer app.workersWg.Done()
+	for {
+		job, err := app.jobQueue.Next(app.stopCtx)
+		if err != nil {
+			if app.stopCtx.Err() == nil {
+				app.logger.Errorf("Error getting next job: %v", err)
+			}
+			return
+		}
+		if err := app.handleJobWithRetry(job); err == errShutdown {
+			app.logger.Infof("Aborted handling job %d, as the app is shutting down", job.ID)
+			return
+		} else if err != nil {
+			// The job is left in the queue, to be retried the
+			// next time the queue is opened.
+			app.logger.Errorf("Error storing failed job %d: %+v", job.ID, err)
+			continue
+		}
+		if err := app.jobQueue.Done(job.ID); err != nil {
+			app.logger.Errorf("Error marking job %d as done: %+v", job.ID, err)
+		}
+	}
+}
+
+// handleJobWithRetry handles the job, retrying it with a backoff for as long as
+// it fails with a transient error, up to the max number of attempts of the
+// retryBackoff. Only the handlers that failed with a transient error are called
+// again when retrying, the results of the other handlers are reused. If the job
+// still fails it is added to the deadLetters. An error is only returned if
+// adding the job to the deadLetters failed, or errShutdown if the handling was
+// aborted because the app is shutting down.
+func (app *App) handleJobWithRetry(job *queue.Job) error {
+	progress := newJobProgress()
+	for attempt := 1; ; attempt++ {
+		err := app.handleJob(job, progress)
+		if err == nil {
+			return nil
+		}
+		if app.handlerCtx.Err() != nil {
+			// The failure was (likely) caused by us cancelling
+			// the handlers, so it should not count as a failure.
+			return errShutdown
+		}
+		if !isTransient(err) || attempt >= app.retryBackoff.maxAttempts {
+			app.logger.Errorf("Error handling webhook (attempt %d), giving up: %v", attempt, err)
+			app.logger.Debugf("%+v", err)
+			_, err := app.deadLetters.Add(job, attempt, err)
+			return errors.Wrap(err, "Error adding dead letter")
+		}
+		delay := app.retryBackoff.delay(attempt + 1)
+		app.logger.Warnf("Error handling webhook (attempt %d), retrying in %s: %v", attempt, delay, err)
+		select {
+		case <-app.stopCtx.Done():
+			return errShutdown
+		case <-time.After(delay):
+		}
+	}
+}
+
+// handleJob decodes the webhook of the job and dispatches it to the route
+// of its event, recording the results of the handlers in the progress.
+func (app *App) handleJob(job *queue.Job, progress *jobProgress) error {
+	route, ok := app.routes[job.Event]
+	if !ok {
+		return errors.Errorf("No route for event: %s", job.Event)
+	}
+	webhook := route.newWebhook()
+	if err := json.Unmarshal(job.Payload, webhook); err != nil {
+		return errors.Wrap(err, "Error unmarshalling webhook")
+	}
+	return route.handle(app.handlerCtx, webhook, progress)
 }
 
 // ServeHTTP is an http handler that is registered on the path that
 // the GitLab webhook is posted to. It verifies and decodes the webhook
-// from the http request.
+// from the http request, and writes it to the jobQueue, from which it
+// is dispatched by the workers based on the type of event. Deliveries
+// of webhooks that have already been accepted are ignored.
 func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -87,26 +326,48 @@ func (app *App) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
 	}
-	if err := app.ensureMergeRequestWebhook(r); err != nil {
-		app.logger.Debugf("Bad webhook event: %+v", err)
+	if app.stopCtx.Err() != nil {
+		// We are shutting down, do not accept any new webhooks
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	event := r.Header.Get("X-Gitlab-Event")
+	route, ok := app.routes[event]
+	if !ok {
+		app.logger.Debugf("Bad webhook event: X-Gitlab-Event missing or invalid, was: '%s'", event)
 		w.WriteHeader(http.StatusBadRequest)
 		return
 	}
-	webhook := &gitlab.MergeRequestWebhook{}
-	if err := json.NewDecoder(r.Body).Decode(webhook); err != nil {
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		app.logger.Debugf("Error reading webhook: %+v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	// Decode the webhook already here, so that we do not
+	// accept payloads that we will not be able to handle
+	if err := json.Unmarshal(payload, route.newWebhook()); err != nil {
 		app.logger.Debugf("Error unmarshalling webhook: %+v", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		return
 	}
+	// GitLab may deliver the same webhook more than once, e.g. on
+	// timeouts or when it is resent manually. We only handle the
+	// first delivery of a webhook.
+	deliveryID := webhookDeliveryID(r, event, payload)
+	if !app.deliveries.add(deliveryID) {
+		app.logger.Debugf("Ignoring duplicate webhook delivery: %s", deliveryID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if _, err := app.jobQueue.Push(event, payload); err != nil {
+		app.logger.Errorf("Error queueing webhook: %+v", err)
+		// Forget the delivery, so that it is accepted if delivered again
+		app.deliveries.remove(deliveryID)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
 	w.WriteHeader(http.StatusOK)
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), handleWebhookTimeout)
-		defer cancel()
-		if err := app.onMergeRequestWebhook(ctx, webhook); err != nil {
-			app.logger.Errorf("Error handling webhook: %v", err)
-			app.logger.Debugf("%+v", err)
-		}
-	}()
 }
 
 // ensureWebhookToken checks the request for an "X-Gitlab-Token" and
@@ -117,18 +378,9 @@ func (app *App) ensureWebhookToken(r *http.Request) error {
 	}
 	reqToken := r.Header.Get("X-Gitlab-Token")
 	if reqToken != app.webhookToken {
-		return errors.Errorf("X-Gitlab-Token missing or invalid, was: '%s'", reqToken)
-	}
-	return nil
-}
-
-// ensureMergeRequestWebhook tests the request for the "X-Gitlab-Event" header,
-// returning an error if it does not exist or if it does not match the
-// expected "Merge Request Hook" value.
-func (app *App) ensureMergeRequestWebhook(r *http.Request) error {
-	reqEvent := r.Header.Get("X-Gitlab-Event")
-	if reqEvent != "Merge Request Hook" {
-		return errors.Errorf("X-Gitlab-Event missing or invalid, was: '%s'", reqEvent)
+		// The invalid token is not included, as it might be
+		// a secret used for something else
+		return errors.New("X-Gitlab-Token missing or invalid")
 	}
 	return nil
 }
@@ -137,51 +389,157 @@ func (app *App) ensureMergeRequestWebhook(r *http.Request) error {
 // and parsed successfully. onMergeRequestWebhook dispatches handling of the
 // webhook to all registered MergeRequestWebhookHandler for the specific webhook
 // action, waits for them to complete, then posts the accumulated message as a
-// comment on the merge request.
-func (app *App) onMergeRequestWebhook(ctx context.Context, webhook *gitlab.MergeRequestWebhook) error {
-	app.logger.Debugf("onMergeRequestWebhook: %+v", webhook)
+// comment on the merge request. If we have already commented on the merge request
+// for the action, that comment is updated with the new message instead.
+func (app *App) onMergeRequestWebhook(ctx context.Context, webhook *gitlab.MergeRequestWebhook, progress *jobProgress) error {
+	app.logger.Debugf("onMergeRequestWebhook: %s", redact.JSON(webhook, app.secretFields...))
 	action := webhook.ObjectAttributes.Action
-	app.mergeRequestHandlersMu.RLock()
-	handlers, ok := app.mergeRequestHandlers[action]
-	app.mergeRequestHandlersMu.RUnlock()
+	app.handlersMu.RLock()
+	registrations, ok := app.handlers.mergeRequest[action]
+	app.handlersMu.RUnlock()
 	if !ok {
 		app.logger.Debugf("No handler for Action: %s", action)
 		return nil
 	}
-	// Fan-out, let each handler do its thing on a separate go-routine
-	type handlerResult struct {
-		msg string
-		err error
-	}
-	var resultsChs []chan handlerResult
-	for _, handler := range handlers {
-		resultCh := make(chan handlerResult, 1)
-		go func(handler MergeRequestHandler) {
-			msg, err := handler.HandleMergeRequest(ctx, webhook)
-			resultCh <- handlerResult{msg, err}
-		}(handler)
-		resultsChs = append(resultsChs, resultCh)
-	}
-	// Fan-in, wait for each handler to complete (in order) and
-	// combine their messages.
-	var noteMessageBuf bytes.Buffer
-	for _, resultCh := range resultsChs {
-		res := <-resultCh
-		if res.err != nil {
-			return errors.Wrap(res.err, "handler error during HandleMergeRequest")
-		}
-		if len(res.msg) > 0 {
-			noteMessageBuf.WriteString(res.msg)
-			noteMessageBuf.WriteByte('\n')
+	var handlers []noteHandler
+	for _, registration := range registrations {
+		if !registration.options.matches(webhook.Project.PathWithNamespace, webhook.ObjectAttributes.SourceBranch) {
+			continue
 		}
+		handler := registration.handler
+		handlers = append(handlers, noteHandler{
+			handle: func(ctx context.Context) (string, error) {
+				return handler.HandleMergeRequest(ctx, webhook)
+			},
+			options: registration.options,
+		})
 	}
-	// If no handler added anything to the message buffer, we send nothing.
-	if noteMessageBuf.Len() == 0 {
-		app.logger.Debugf("Not creating note, noteMessageBuf empty")
-		return nil
+	// Failed handlers does not stop us from posting the message of the
+	// other handlers. The handler errors are returned after the note has
+	// been posted, so that the webhook can be retried if needed.
+	message, handlerErr := app.collectMessages(ctx, progress, handlers)
+	// If no handler added anything to the message, we send nothing.
+	if message == "" {
+		app.logger.Debugf("Not creating note, message empty")
+		return handlerErr
 	}
+	ctx, cancel := context.WithTimeout(ctx, postNoteTimeout)
+	defer cancel()
 	mergeRequestID := gitlab.NewMergeRequestID(webhook)
-	note := &gitlab.Note{Body: noteMessageBuf.String()}
+	if err := app.upsertMergeRequestNote(ctx, mergeRequestID, mergeRequestNoteMarker(action), message); err != nil {
+		return errors.Wrap(err, "Error upserting merge request note")
+	}
+	return handlerErr
+}
+
+// onPipelineWebhook is called when a pipeline webhook has been received and
+// parsed successfully. onPipelineWebhook dispatches handling of the webhook
+// to all registered PipelineHandlers for the status of the pipeline, then
+// posts the accumulated message as a comment on the merge request(s) of
+// the pipeline.
+func (app *App) onPipelineWebhook(ctx context.Context, webhook *gitlab.PipelineWebhook, progress *jobProgress) error {
+	app.logger.Debugf("onPipelineWebhook: %s", redact.JSON(webhook, app.secretFields...))
+	status := webhook.ObjectAttributes.Status
+	app.handlersMu.RLock()
+	registrations, ok := app.handlers.pipeline[status]
+	app.handlersMu.RUnlock()
+	if !ok {
+		app.logger.Debugf("No handler for Status: %s", status)
+		return nil
+	}
+	var handlers []noteHandler
+	for _, registration := range registrations {
+		if !registration.options.matches(webhook.Project.PathWithNamespace, webhook.ObjectAttributes.Ref) {
+			continue
+		}
+		handler := registration.handler
+		handlers = append(handlers, noteHandler{
+			handle: func(ctx context.Context) (string, error) {
+				return handler.HandlePipeline(ctx, webhook)
+			},
+			options: registration.options,
+		})
+	}
+	message, handlerErr := app.collectMessages(ctx, progress, handlers)
+	if message == "" {
+		app.logger.Debugf("Not creating note, message empty")
+		return handlerErr
+	}
+	ctx, cancel := context.WithTimeout(ctx, postNoteTimeout)
+	defer cancel()
+	mergeRequestIDs, err := app.pipelineMergeRequestIDs(ctx, webhook)
+	if err != nil {
+		return errors.Wrap(err, "Error finding merge requests of pipeline")
+	}
+	for _, mergeRequestID := range mergeRequestIDs {
+		if err := app.upsertMergeRequestNote(ctx, mergeRequestID, pipelineNoteMarker, message); err != nil {
+			return errors.Wrap(err, "Error upserting merge request note")
+		}
+	}
+	return handlerErr
+}
+
+// pipelineMergeRequestIDs returns the ids of the merge requests that the
+// pipeline was run for. For merge request pipelines, this is the merge request
+// included in the webhook. For other (branch) pipelines it is all open merge
+// requests having the pipeline's ref, of the pipeline's project, as their source
+// branch, including merge requests from a fork to another project.
+func (app *App) pipelineMergeRequestIDs(ctx context.Context, webhook *gitlab.PipelineWebhook) ([]gitlab.MergeRequestID, error) {
+	if mr := webhook.MergeRequest; mr != nil {
+		return []gitlab.MergeRequestID{{ProjectID: mr.TargetProjectID, IID: mr.IID}}, nil
+	}
+	if webhook.ObjectAttributes.Tag {
+		return nil, nil
+	}
+	mergeRequests, err := app.gitlabClient.ListOpenMergeRequests(ctx,
+		webhook.Project.ID, webhook.ObjectAttributes.Ref)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error listing merge requests")
+	}
+	var mergeRequestIDs []gitlab.MergeRequestID
+	for _, mr := range mergeRequests {
+		mergeRequestIDs = append(mergeRequestIDs, mr.MergeRequestID())
+	}
+	return mergeRequestIDs, nil
+}
+
+// currentBotUser returns the GitLab user that the notes are posted as, i.e.
+// the user of the token of the gitlabClient.
+func (app *App) currentBotUser(ctx context.Context) (*gitlab.User, error) {
+	app.botUserMu.Lock()
+	defer app.botUserMu.Unlock()
+	if app.botUser == nil {
+		user, err := app.gitlabClient.CurrentUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		app.botUser = user
+	}
+	return app.botUser, nil
+}
+
+// upsertMergeRequestNote adds a note with the given body to the merge request
+// identified by mergeRequestID. If a note containing the marker, written by
+// us, already exists on the merge request, that note is updated instead of a
+// new note being added. Notes of other users are never updated, even if they
+// contain the marker, e.g. from being quoted.
+func (app *App) upsertMergeRequestNote(ctx context.Context, mergeRequestID gitlab.MergeRequestID, marker string, body string) error {
+	note := &gitlab.Note{Body: body + "\n" + marker}
+	botUser, err := app.currentBotUser(ctx)
+	if err != nil {
+		return errors.Wrap(err, "Error getting current user")
+	}
+	notes, err := app.gitlabClient.ListMergeRequestNotes(ctx, mergeRequestID)
+	if err != nil {
+		return errors.Wrap(err, "Error listing merge request notes")
+	}
+	for _, existing := range notes {
+		isOwn := existing.Author != nil && existing.Author.ID == botUser.ID
+		if isOwn && strings.Contains(existing.Body, marker) {
+			return errors.Wrap(app.gitlabClient.EditMergeRequestNote(ctx, mergeRequestID, existing.ID, note),
+				"Error editing merge request note")
+		}
+	}
 	return errors.Wrap(app.gitlabClient.AddMergeRequestNote(ctx, mergeRequestID, note),
 		"Error adding merge request note")
 }
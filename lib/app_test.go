@@ -0,0 +1,565 @@
+package mrgitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/queue"
+)
+
+// pushHandlerFunc is a func implementing the PushHandler interface.
+type pushHandlerFunc func(context.Context, *gitlab.PushWebhook) error
+
+func (f pushHandlerFunc) HandlePush(ctx context.Context, webhook *gitlab.PushWebhook) error {
+	return f(ctx, webhook)
+}
+
+// newTestApp creates a new App, using a job queue in a new temporary
+// directory. The returned func removes the temporary directory.
+func newTestApp(t *testing.T) (*App, func()) {
+	dir, err := ioutil.TempDir("", "mrgitlab-app")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	jobQueue, err := queue.Open(filepath.Join(dir, "queue"))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	deadLetters, err := queue.OpenDeadLetters(filepath.Join(dir, "deadletters"))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	app, err := New(logrus.New(), nil, "", jobQueue, deadLetters)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	return app, func() {
+		app.Shutdown(context.Background())
+		jobQueue.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func newWebhookRequest(event string, body string) *http.Request {
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	req.Header.Set("X-Gitlab-Event", event)
+	return req
+}
+
+func TestServeHTTP_UnknownEvent(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, newWebhookRequest("Unknown Hook", "{}"))
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("expected status %d, got: %d", http.StatusBadRequest, rec.Code)
+	}
+}
+
+func TestServeHTTP_RoutesPushEvent(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	refCh := make(chan string, 1)
+	app.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		refCh <- webhook.Ref
+		return nil
+	}))
+	app.Start(1)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, newWebhookRequest(gitlab.EventPush, `{"object_kind": "push", "ref": "refs/heads/master"}`))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got: %d", http.StatusOK, rec.Code)
+	}
+	select {
+	case ref := <-refCh:
+		if ref != "refs/heads/master" {
+			t.Errorf("expected ref 'refs/heads/master', got: '%s'", ref)
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for push handler to be called")
+	}
+}
+
+// Test that a webhook failing with a transient error is retried, and that
+// it is moved to the dead letters once it has failed maxAttempts times.
+func TestWorker_RetriesThenDeadLetters(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	app.retryBackoff = backoff{maxAttempts: 3, initialDelay: time.Millisecond, maxDelay: time.Millisecond}
+	attemptCh := make(chan struct{}, 3)
+	app.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		attemptCh <- struct{}{}
+		return errors.Wrap(temporaryError(true), "push handler failed")
+	}))
+	app.Start(1)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, newWebhookRequest(gitlab.EventPush, `{"object_kind": "push"}`))
+	for i := 0; i < 3; i++ {
+		select {
+		case <-attemptCh:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for attempt %d", i+1)
+		}
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(app.deadLetters.List()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	letters := app.deadLetters.List()
+	if len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got: %d", len(letters))
+	}
+	if letters[0].Attempts != 3 {
+		t.Errorf("expected dead letter to have 3 attempts, was: %d", letters[0].Attempts)
+	}
+}
+
+// Test that only the handler failing with a transient error is called again
+// when a webhook is retried.
+func TestWorker_RetriesOnlyFailedHandlers(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	app.retryBackoff = backoff{maxAttempts: 3, initialDelay: time.Millisecond, maxDelay: time.Millisecond}
+	var succeedingCalls, failingCalls int32
+	doneCh := make(chan struct{})
+	app.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		atomic.AddInt32(&succeedingCalls, 1)
+		return nil
+	}))
+	app.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		if atomic.AddInt32(&failingCalls, 1) == 1 {
+			return errors.Wrap(temporaryError(true), "push handler failed")
+		}
+		close(doneCh)
+		return nil
+	}))
+	app.Start(1)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, newWebhookRequest(gitlab.EventPush, `{"object_kind": "push"}`))
+	select {
+	case <-doneCh:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the retry")
+	}
+	if n := atomic.LoadInt32(&succeedingCalls); n != 1 {
+		t.Errorf("expected the succeeding handler to be called once, was called %d times", n)
+	}
+}
+
+func TestAdminHandler_ReplayDeadLetter(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	job := &queue.Job{Event: gitlab.EventPush, Payload: []byte(`{"ref": "refs/heads/master"}`)}
+	letter, err := app.deadLetters.Add(job, 1, errors.New("failed"))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	adminHandler := app.AdminHandler("secret")
+
+	req := httptest.NewRequest("POST", fmt.Sprintf("/deadletters/%d/replay", letter.ID), nil)
+	rec := httptest.NewRecorder()
+	adminHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d without token, got: %d", http.StatusUnauthorized, rec.Code)
+	}
+
+	req.Header.Set("X-Admin-Token", "secret")
+	rec = httptest.NewRecorder()
+	adminHandler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got: %d", http.StatusOK, rec.Code)
+	}
+	if len(app.deadLetters.List()) != 0 {
+		t.Error("expected dead letter to be removed")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	replayed, err := app.jobQueue.Next(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if string(replayed.Payload) != string(job.Payload) {
+		t.Errorf("expected replayed payload '%s', got: '%s'", job.Payload, replayed.Payload)
+	}
+}
+
+// Test that Shutdown cancels handlers still running at the deadline, and
+// that their jobs are kept in the queue rather than moved to the dead letters.
+func TestShutdown_CancelsHandlersAtDeadline(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	startedCh := make(chan struct{})
+	app.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		close(startedCh)
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	app.Start(1)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, newWebhookRequest(gitlab.EventPush, `{"object_kind": "push"}`))
+	select {
+	case <-startedCh:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for push handler to be called")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := app.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %+v", err)
+	}
+	if len(app.deadLetters.List()) != 0 {
+		t.Error("expected cancelled job to not be added to dead letters")
+	}
+	rec = httptest.NewRecorder()
+	app.ServeHTTP(rec, newWebhookRequest(gitlab.EventPush, `{"object_kind": "push"}`))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d after shutdown, got: %d", http.StatusServiceUnavailable, rec.Code)
+	}
+}
+
+func TestServeHTTP_IgnoresDuplicateDelivery(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	for _, uuid := range []string{"a", "a", "b"} {
+		req := newWebhookRequest(gitlab.EventPush, `{"object_kind": "push"}`)
+		req.Header.Set("X-Gitlab-Event-UUID", uuid)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got: %d", http.StatusOK, rec.Code)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	var numJobs int
+	for {
+		if _, err := app.jobQueue.Next(ctx); err != nil {
+			break
+		}
+		numJobs++
+	}
+	if numJobs != 2 {
+		t.Errorf("expected 2 queued jobs, got: %d", numJobs)
+	}
+}
+
+func TestReplaceHandlers(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	handlerCh := make(chan string, 2)
+	app.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		handlerCh <- "old"
+		return nil
+	}))
+	set := NewHandlerSet()
+	set.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		handlerCh <- "new"
+		return nil
+	}))
+	app.ReplaceHandlers(set)
+	app.Start(1)
+	rec := httptest.NewRecorder()
+	app.ServeHTTP(rec, newWebhookRequest(gitlab.EventPush, `{"object_kind": "push"}`))
+	select {
+	case name := <-handlerCh:
+		if name != "new" {
+			t.Errorf("expected the new handler to be called, was: %s", name)
+		}
+	case <-time.After(time.Second):
+		t.Error("timed out waiting for push handler to be called")
+	}
+}
+
+// newTestGitLabServer returns a test server stand-in for the GitLab API,
+// where the current user has id 1 and merge request 2 of project 1 has
+// the given notes. The returned func returns the requests that modified
+// notes, as "METHOD path".
+func newTestGitLabServer(notes string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var writes []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v4/user":
+			fmt.Fprint(w, `{"id": 1, "username": "mrgitlab"}`)
+		case r.Method == "GET" && r.URL.Path == "/api/v4/projects/1/merge_requests/2/notes":
+			fmt.Fprint(w, notes)
+		default:
+			mu.Lock()
+			writes = append(writes, r.Method+" "+r.URL.Path)
+			mu.Unlock()
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return writes
+	}
+}
+
+func TestUpsertMergeRequestNote(t *testing.T) {
+	tests := []struct {
+		name     string
+		notes    string
+		expected string
+	}{
+		{"no notes", `[]`, "POST /api/v4/projects/1/merge_requests/2/notes"},
+		{"own note", `[
+			{"id": 10, "body": "Hello", "author": {"id": 7}},
+			{"id": 11, "body": "Old\n<!-- mrgitlab:merge_request -->", "author": {"id": 1}}
+		]`, "PUT /api/v4/projects/1/merge_requests/2/notes/11"},
+		{"user note with the marker", `[
+			{"id": 10, "body": "> Old\n> <!-- mrgitlab:merge_request -->", "author": {"id": 7}}
+		]`, "POST /api/v4/projects/1/merge_requests/2/notes"},
+		{"own note with another marker", `[
+			{"id": 11, "body": "Old\n<!-- mrgitlab:pipeline -->", "author": {"id": 1}}
+		]`, "POST /api/v4/projects/1/merge_requests/2/notes"},
+	}
+	for _, test := range tests {
+		app, cleanup := newTestApp(t)
+		server, writes := newTestGitLabServer(test.notes)
+		client, err := gitlab.NewClient(logrus.New(), server.URL, "token")
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		app.gitlabClient = client
+		mergeRequestID := gitlab.MergeRequestID{ProjectID: 1, IID: 2}
+		if err := app.upsertMergeRequestNote(context.Background(), mergeRequestID, mergeRequestNoteMarker("open"), "New"); err != nil {
+			t.Errorf("%s: unexpected error: %+v", test.name, err)
+		}
+		if actual := writes(); len(actual) != 1 || actual[0] != test.expected {
+			t.Errorf("%s: expected the request '%s', was: %v", test.name, test.expected, actual)
+		}
+		server.Close()
+		cleanup()
+	}
+}
+
+// Test that the bot user is only fetched for the first note, and that no note
+// is added if the existing notes can not be listed.
+func TestUpsertMergeRequestNote_Errors(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	var userRequests, writes int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v4/user":
+			atomic.AddInt32(&userRequests, 1)
+			fmt.Fprint(w, `{"id": 1, "username": "mrgitlab"}`)
+		case r.Method == "GET" && r.URL.Path == "/api/v4/projects/1/merge_requests/2/notes":
+			fmt.Fprint(w, `[]`)
+		case r.Method == "GET":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			atomic.AddInt32(&writes, 1)
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer server.Close()
+	client, err := gitlab.NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	app.gitlabClient = client
+	marker := mergeRequestNoteMarker("open")
+	for i := 0; i < 2; i++ {
+		mergeRequestID := gitlab.MergeRequestID{ProjectID: 1, IID: 2}
+		if err := app.upsertMergeRequestNote(context.Background(), mergeRequestID, marker, "New"); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	if n := atomic.LoadInt32(&userRequests); n != 1 {
+		t.Errorf("expected the bot user to be fetched once, was fetched %d times", n)
+	}
+	mergeRequestID := gitlab.MergeRequestID{ProjectID: 1, IID: 3}
+	if err := app.upsertMergeRequestNote(context.Background(), mergeRequestID, marker, "New"); err == nil {
+		t.Error("expected an error when the notes can not be listed")
+	}
+	if n := atomic.LoadInt32(&writes); n != 2 {
+		t.Errorf("expected 2 notes to be added, was: %d", n)
+	}
+}
+
+// mergeRequestHandlerFunc is a func implementing the MergeRequestHandler interface.
+type mergeRequestHandlerFunc func(context.Context, *gitlab.MergeRequestWebhook) (string, error)
+
+func (f mergeRequestHandlerFunc) HandleMergeRequest(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
+	return f(ctx, webhook)
+}
+
+// newTestNotesServer returns a test server stand-in for the GitLab API,
+// where the current user has id 1, keeping the notes added to and edited
+// on merge request 2 of project 1. The returned func returns the bodies
+// of the notes.
+func newTestNotesServer() (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	var notes []*gitlab.Note
+	notesPath := "/api/v4/projects/1/merge_requests/2/notes"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v4/user":
+			fmt.Fprint(w, `{"id": 1, "username": "mrgitlab"}`)
+		case r.Method == "GET" && r.URL.Path == notesPath:
+			json.NewEncoder(w).Encode(notes)
+		case r.Method == "POST" && r.URL.Path == notesPath:
+			note := &gitlab.Note{}
+			json.NewDecoder(r.Body).Decode(note)
+			note.ID = int64(len(notes) + 1)
+			note.Author = &gitlab.User{ID: 1}
+			notes = append(notes, note)
+			json.NewEncoder(w).Encode(note)
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, notesPath+"/"):
+			id, _ := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, notesPath+"/"), 10, 64)
+			edited := &gitlab.Note{}
+			json.NewDecoder(r.Body).Decode(edited)
+			for _, note := range notes {
+				if note.ID == id {
+					note.Body = edited.Body
+				}
+			}
+			json.NewEncoder(w).Encode(edited)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		var bodies []string
+		for _, note := range notes {
+			bodies = append(bodies, note.Body)
+		}
+		return bodies
+	}
+}
+
+// Test that the note of an "open" merge request webhook is updated by the
+// note of a later "update" webhook, but not by the note of a "merge" webhook.
+func TestOnMergeRequestWebhook_NotePerAction(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	server, notes := newTestNotesServer()
+	defer server.Close()
+	client, err := gitlab.NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	app.gitlabClient = client
+	for _, action := range []string{"open", "update", "merge"} {
+		action := action
+		app.RegisterMergeRequestHandler(action, mergeRequestHandlerFunc(func(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
+			return "Note of " + action, nil
+		}))
+	}
+	for _, action := range []string{"open", "update", "merge"} {
+		webhook := &gitlab.MergeRequestWebhook{}
+		webhook.ObjectAttributes.Action = action
+		webhook.ObjectAttributes.TargetProjectID = 1
+		webhook.ObjectAttributes.IID = 2
+		if err := app.onMergeRequestWebhook(context.Background(), webhook, nil); err != nil {
+			t.Fatalf("unexpected error for action '%s': %+v", action, err)
+		}
+	}
+	expected := []string{
+		"Note of update\n\n<!-- mrgitlab:merge_request -->",
+		"Note of merge\n\n<!-- mrgitlab:merge_request:merge -->",
+	}
+	if actual := notes(); fmt.Sprint(actual) != fmt.Sprint(expected) {
+		t.Errorf("expected notes %q, was: %q", expected, actual)
+	}
+}
+
+// Test that handlers of events without notes, e.g. push handlers, are run
+// with the options they were registered with.
+func TestRegisterPushHandler_Options(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	app.RegisterPushHandler(pushHandlerFunc(func(ctx context.Context, webhook *gitlab.PushWebhook) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), WithName("slow push"), WithTimeout(10*time.Millisecond))
+	route := app.routes[gitlab.EventPush]
+	if err := route.handle(context.Background(), &gitlab.PushWebhook{}, nil); err == nil {
+		t.Fatal("expected an error but got nil")
+	}
+	if n := app.HandlerFailures()["slow push"]; n != 1 {
+		t.Errorf("expected 1 failure of the handler 'slow push', was: %d", n)
+	}
+}
+
+// pipelineHandlerFunc is a func implementing the PipelineHandler interface.
+type pipelineHandlerFunc func(context.Context, *gitlab.PipelineWebhook) (string, error)
+
+func (f pipelineHandlerFunc) HandlePipeline(ctx context.Context, webhook *gitlab.PipelineWebhook) (string, error) {
+	return f(ctx, webhook)
+}
+
+// Test that the note of a branch pipeline is added to the open merge requests
+// of its branch, including merge requests from the fork to another project.
+func TestOnPipelineWebhook_BranchPipeline(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	var mu sync.Mutex
+	var posted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api/v4/user":
+			fmt.Fprint(w, `{"id": 1, "username": "mrgitlab"}`)
+		case r.Method == "GET" && r.URL.Path == "/api/v4/merge_requests":
+			fmt.Fprint(w, `[
+				{"iid": 2, "project_id": 3, "source_project_id": 3},
+				{"iid": 5, "project_id": 1, "source_project_id": 3},
+				{"iid": 6, "project_id": 1, "source_project_id": 1}
+			]`)
+		case r.Method == "GET":
+			fmt.Fprint(w, `[]`)
+		case r.Method == "POST":
+			mu.Lock()
+			posted = append(posted, r.URL.Path)
+			mu.Unlock()
+			fmt.Fprint(w, `{}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client, err := gitlab.NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	app.gitlabClient = client
+	app.RegisterPipelineHandler("failed", pipelineHandlerFunc(func(ctx context.Context, webhook *gitlab.PipelineWebhook) (string, error) {
+		return "Pipeline failed", nil
+	}))
+	webhook := &gitlab.PipelineWebhook{}
+	webhook.ObjectAttributes.Status = "failed"
+	webhook.ObjectAttributes.Ref = "feature/x"
+	webhook.Project.ID = 3
+	if err := app.onPipelineWebhook(context.Background(), webhook, nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	expected := []string{
+		"/api/v4/projects/3/merge_requests/2/notes",
+		"/api/v4/projects/1/merge_requests/5/notes",
+	}
+	if fmt.Sprint(posted) != fmt.Sprint(expected) {
+		t.Errorf("expected notes to be posted to %v, was: %v", expected, posted)
+	}
+}
@@ -0,0 +1,491 @@
+package config
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/handlers"
+	"gopkg.in/yaml.v2"
+)
+
+// Events that handlers can be run for.
+const (
+	EventMergeRequest = "merge_request"
+	EventPipeline     = "pipeline"
+)
+
+// handlerTypes are the supported handler types, mapped to the event
+// that the handler type is run for.
+var handlerTypes = map[string]string{
+	"youtrack":          EventMergeRequest,
+	"youtrack_backlink": EventMergeRequest,
+	"youtrack_command":  EventMergeRequest,
+	"jira":              EventMergeRequest,
+	"jira_remote_link":  EventMergeRequest,
+	"redmine":           EventMergeRequest,
+	"issues":            EventMergeRequest,
+	"message":           EventMergeRequest,
+	"url_file":          EventMergeRequest,
+	"pipeline_failure":  EventPipeline,
+}
+
+// requiredParams are the params that must be set for each handler type.
+var requiredParams = map[string][]string{
+	"message":  {"message"},
+	"url_file": {"url"},
+}
+
+// intParams are the params of each handler type that, if set, must be
+// non-negative integers.
+var intParams = map[string][]string{
+	"youtrack": {"max_description_length"},
+	"jira":     {"max_description_length"},
+	"redmine":  {"max_description_length"},
+	"issues":   {"max_description_length"},
+}
+
+// trackerTypes are the supported issue trackers of TrackerConfigs.
+var trackerTypes = map[string]bool{
+	"youtrack": true,
+	"jira":     true,
+	"redmine":  true,
+	"gitlab":   true,
+}
+
+// youtrackTypes are the handler types that require the YouTrack client.
+var youtrackTypes = map[string]bool{
+	"youtrack":          true,
+	"youtrack_backlink": true,
+	"youtrack_command":  true,
+}
+
+// jiraTypes are the handler types that require the Jira client.
+var jiraTypes = map[string]bool{
+	"jira":             true,
+	"jira_remote_link": true,
+}
+
+// Config is the configuration of mrgitlab, declaring the settings of
+// the server, the credentials of the clients and the handlers to run.
+type Config struct {
+	Server ServerConfig `yaml:"server"`
+	GitLab GitLabConfig `yaml:"gitlab"`
+	// YouTrack is the configuration of the YouTrack client. It is
+	// only required if there are handlers of the YouTrack types.
+	YouTrack *YouTrackConfig `yaml:"youtrack"`
+	// Jira is the configuration of the Jira client. It is only required
+	// if there are handlers of the "jira" or "jira_remote_link" types.
+	Jira *JiraConfig `yaml:"jira"`
+	// Redmine is the configuration of the Redmine client. It is only
+	// required if there are handlers of the "redmine" type.
+	Redmine *RedmineConfig `yaml:"redmine"`
+	// Trackers choose the issue tracker of each project, for handlers
+	// of the "issues" type.
+	Trackers []TrackerConfig `yaml:"trackers"`
+	Handlers []HandlerConfig `yaml:"handlers"`
+}
+
+// ServerConfig is the configuration of the webhook server.
+type ServerConfig struct {
+	// Addr is the TCP address where the server listens for webhooks.
+	Addr string `yaml:"addr"`
+	// WebhookToken is the token that, if non-empty, must be included
+	// in the webhook calls.
+	WebhookToken string `yaml:"webhook_token"`
+	// AdminToken is the token required for accessing the /admin/
+	// endpoints. The endpoints are disabled if empty.
+	AdminToken string `yaml:"admin_token"`
+	// QueueFile is the path of the file where accepted webhooks are
+	// stored until they have been handled.
+	QueueFile string `yaml:"queue_file"`
+	// DeadLetterFile is the path of the file where webhooks that could
+	// not be handled are stored.
+	DeadLetterFile string `yaml:"dead_letter_file"`
+	// Workers is the number of webhooks that may be handled concurrently.
+	Workers int `yaml:"workers"`
+	// ShutdownTimeout is the max amount of time to wait for running
+	// handlers to complete when shutting down.
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// SecretFields are the names of webhook fields, e.g. "email", that
+	// are masked when webhooks are logged, in addition to the fields
+	// that are always masked, such as tokens and passwords.
+	SecretFields []string `yaml:"secret_fields"`
+}
+
+// GitLabConfig is the configuration of the GitLab client.
+type GitLabConfig struct {
+	// URL is the base URL of the GitLab server.
+	URL string `yaml:"url"`
+	// Token is the private token used for requests to the GitLab server.
+	Token string `yaml:"token"`
+}
+
+// YouTrackConfig is the configuration of the YouTrack client. Either a
+// Token, for the current API, or a Username and Password, for the legacy
+// API of older YouTrack servers, must be set.
+type YouTrackConfig struct {
+	// URL is the base URL of the YouTrack server.
+	URL string `yaml:"url"`
+	// Token is a permanent token for the current API.
+	Token    string `yaml:"token"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// JiraConfig is the configuration of the Jira client. The Token is used
+// together with the Username for basic auth if the Username is set, or
+// else as a personal access token.
+type JiraConfig struct {
+	// URL is the base URL of the Jira server.
+	URL string `yaml:"url"`
+	// Username is the email of the user on Jira Cloud, where the Token
+	// is an API token, or the username on Jira Server.
+	Username string `yaml:"username"`
+	Token    string `yaml:"token"`
+}
+
+// RedmineConfig is the configuration of the Redmine client.
+type RedmineConfig struct {
+	// URL is the base URL of the Redmine server.
+	URL string `yaml:"url"`
+	// APIKey is the API key of the Redmine user, found on the
+	// "My account" page of Redmine.
+	APIKey string `yaml:"api_key"`
+}
+
+// TrackerConfig chooses the issue tracker of the issues referenced by the
+// merge requests of some projects.
+type TrackerConfig struct {
+	// Tracker is the issue tracker, "youtrack", "jira", "redmine" or
+	// "gitlab".
+	Tracker string `yaml:"tracker"`
+	// Projects are the paths of the projects, e.g. "group/project", using
+	// the tracker. A tracker without projects is used for all projects.
+	// The first tracker with a matching project is used.
+	Projects []string `yaml:"projects"`
+}
+
+// TrackerFor returns the tracker of the project with the path projectPath,
+// or an empty string if the project has no tracker.
+func (cfg *Config) TrackerFor(projectPath string) string {
+	for _, tracker := range cfg.Trackers {
+		if len(tracker.Projects) == 0 {
+			return tracker.Tracker
+		}
+		for _, project := range tracker.Projects {
+			if project == projectPath {
+				return tracker.Tracker
+			}
+		}
+	}
+	return ""
+}
+
+// HandlerConfig declares a handler, and the webhooks it is run for.
+type HandlerConfig struct {
+	// Name is the name of the handler, used when logging and counting
+	// handler failures. Defaults to the type of the handler.
+	Name string `yaml:"name"`
+	// Type is the type of handler, e.g. "youtrack".
+	Type string `yaml:"type"`
+	// Actions are the merge request actions that the handler is run
+	// for, e.g. "open". Only used for merge request handlers.
+	Actions []string `yaml:"actions"`
+	// Statuses are the pipeline statuses that the handler is run for,
+	// e.g. "failed". Only used for pipeline handlers.
+	Statuses []string `yaml:"statuses"`
+	// Projects are the paths of the projects, e.g. "group/project", the
+	// handler is run for. The handler is run for all projects if empty.
+	Projects []string `yaml:"projects"`
+	// Branches are patterns, e.g. "feature/*", of the branches the handler
+	// is run for. The handler is run for all branches if empty.
+	Branches []string `yaml:"branches"`
+	// Timeout is the max amount of time the handler may run for. The
+	// default timeout is used if zero.
+	Timeout time.Duration `yaml:"timeout"`
+	// ErrorFooter specifies if failures of the handler should be
+	// described in a footer of the note.
+	ErrorFooter bool `yaml:"error_footer"`
+	// Params are the parameters of the handler, specific to its type.
+	Params map[string]string `yaml:"params"`
+	// IssueKeys are the patterns used for finding the issue keys
+	// referenced by a merge request, for handlers of issue trackers.
+	IssueKeys []IssueKeyConfig `yaml:"issue_keys"`
+	// Commands are the YouTrack commands applied by handlers of the
+	// "youtrack_command" type, by target branch.
+	Commands []CommandConfig `yaml:"commands"`
+	// DryRun specifies that handlers of the "youtrack_command" type only
+	// describe the commands they would apply, without applying them.
+	DryRun bool `yaml:"dry_run"`
+}
+
+// CommandConfig is a YouTrack command applied to the issues referenced
+// by merge requests targeting some branches.
+type CommandConfig struct {
+	// TargetBranch is a pattern, e.g. "release/*", of the target branches
+	// the command is applied for.
+	TargetBranch string `yaml:"target_branch"`
+	// Command is the YouTrack command, e.g. "State Fixed".
+	Command string `yaml:"command"`
+}
+
+// IssueKeyConfig is a pattern for finding issue keys in some of the
+// sources of a merge request.
+type IssueKeyConfig struct {
+	// Pattern is the regular expression matching the issue keys.
+	Pattern string `yaml:"pattern"`
+	// Template is the template for creating an issue key from a match
+	// of the Pattern, e.g. "$1-$2". The whole match is used if empty.
+	Template string `yaml:"template"`
+	// Sources are the sources of the merge request, "branch", "title",
+	// "description" or "commits", that the pattern is applied to.
+	Sources []string `yaml:"sources"`
+}
+
+// Secrets returns the secrets of the config, i.e. the tokens and passwords,
+// that must never be logged.
+func (cfg *Config) Secrets() []string {
+	secrets := []string{cfg.Server.WebhookToken, cfg.Server.AdminToken, cfg.GitLab.Token}
+	if cfg.YouTrack != nil {
+		secrets = append(secrets, cfg.YouTrack.Token, cfg.YouTrack.Password)
+	}
+	if cfg.Jira != nil {
+		secrets = append(secrets, cfg.Jira.Token)
+	}
+	if cfg.Redmine != nil {
+		secrets = append(secrets, cfg.Redmine.APIKey)
+	}
+	return secrets
+}
+
+// Event returns the event that the handler is run for.
+func (handler *HandlerConfig) Event() string {
+	return handlerTypes[handler.Type]
+}
+
+// Load reads the config file at path. Settings missing from the file are
+// set to their default values, and the config is validated.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not read config file: %s", path)
+	}
+	cfg, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid config file: %s", path)
+	}
+	return cfg, nil
+}
+
+// Parse parses the YAML encoded config in data. Settings missing from the
+// data are set to their default values, and the config is validated.
+func Parse(data []byte) (*Config, error) {
+	cfg := &Config{}
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, errors.Wrap(err, "could not decode config")
+	}
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// setDefaults sets the settings that were not set to their default values.
+func (cfg *Config) setDefaults() {
+	if cfg.Server.Addr == "" {
+		cfg.Server.Addr = ":3000"
+	}
+	if cfg.Server.QueueFile == "" {
+		cfg.Server.QueueFile = "mrgitlab.queue"
+	}
+	if cfg.Server.DeadLetterFile == "" {
+		cfg.Server.DeadLetterFile = "mrgitlab.deadletters"
+	}
+	if cfg.Server.Workers == 0 {
+		cfg.Server.Workers = 4
+	}
+	if cfg.Server.ShutdownTimeout == 0 {
+		cfg.Server.ShutdownTimeout = 30 * time.Second
+	}
+	if cfg.GitLab.URL == "" {
+		cfg.GitLab.URL = "https://gitlab.com/"
+	}
+	for i := range cfg.Handlers {
+		if cfg.Handlers[i].Name == "" {
+			cfg.Handlers[i].Name = cfg.Handlers[i].Type
+		}
+		if cfg.Handlers[i].Type == "youtrack_command" && len(cfg.Handlers[i].Actions) == 0 {
+			cfg.Handlers[i].Actions = []string{"merge"}
+		}
+	}
+}
+
+// ValidationError is the error returned for an invalid config,
+// describing each of the problems found.
+type ValidationError []string
+
+// Error implements the error interface
+func (errs ValidationError) Error() string {
+	return fmt.Sprintf("invalid config: %s", strings.Join(errs, "; "))
+}
+
+// Validate checks that the config is valid, returning a ValidationError
+// describing all problems found if it is not.
+func (cfg *Config) Validate() error {
+	var errs ValidationError
+	addErr := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+	if cfg.Server.Workers < 0 {
+		addErr("server.workers must not be negative")
+	}
+	if cfg.Server.ShutdownTimeout < 0 {
+		addErr("server.shutdown_timeout must not be negative")
+	}
+	if cfg.GitLab.Token == "" {
+		addErr("gitlab.token is required")
+	}
+	if cfg.YouTrack != nil {
+		if cfg.YouTrack.URL == "" {
+			addErr("youtrack.url is required")
+		}
+		hasLogin := cfg.YouTrack.Username != "" || cfg.YouTrack.Password != ""
+		if cfg.YouTrack.Token != "" && hasLogin {
+			addErr("youtrack.token can not be combined with youtrack.username and youtrack.password")
+		} else if cfg.YouTrack.Token == "" && (cfg.YouTrack.Username == "" || cfg.YouTrack.Password == "") {
+			addErr("youtrack.token, or youtrack.username and youtrack.password, are required")
+		}
+	}
+	if cfg.Jira != nil {
+		if cfg.Jira.URL == "" {
+			addErr("jira.url is required")
+		}
+		if cfg.Jira.Token == "" {
+			addErr("jira.token is required")
+		}
+	}
+	if cfg.Redmine != nil {
+		if cfg.Redmine.URL == "" {
+			addErr("redmine.url is required")
+		}
+		if cfg.Redmine.APIKey == "" {
+			addErr("redmine.api_key is required")
+		}
+	}
+	for i, tracker := range cfg.Trackers {
+		prefix := fmt.Sprintf("trackers[%d]", i)
+		switch {
+		case !trackerTypes[tracker.Tracker]:
+			addErr("%s: unknown tracker '%s'", prefix, tracker.Tracker)
+		case tracker.Tracker == "youtrack" && cfg.YouTrack == nil:
+			addErr("%s: youtrack must be configured for the tracker 'youtrack'", prefix)
+		case tracker.Tracker == "jira" && cfg.Jira == nil:
+			addErr("%s: jira must be configured for the tracker 'jira'", prefix)
+		case tracker.Tracker == "redmine" && cfg.Redmine == nil:
+			addErr("%s: redmine must be configured for the tracker 'redmine'", prefix)
+		}
+	}
+	names := make(map[string]bool)
+	for i, handler := range cfg.Handlers {
+		prefix := fmt.Sprintf("handlers[%d]", i)
+		if handler.Name != "" {
+			prefix = fmt.Sprintf("%s (%s)", prefix, handler.Name)
+		}
+		if names[handler.Name] {
+			addErr("%s: name is not unique", prefix)
+		}
+		names[handler.Name] = true
+		event, ok := handlerTypes[handler.Type]
+		if !ok {
+			addErr("%s: unknown type '%s'", prefix, handler.Type)
+		}
+		switch event {
+		case EventMergeRequest:
+			if len(handler.Actions) == 0 {
+				addErr("%s: actions are required for handlers of type '%s'", prefix, handler.Type)
+			}
+			if len(handler.Statuses) > 0 {
+				addErr("%s: statuses are not supported for handlers of type '%s'", prefix, handler.Type)
+			}
+		case EventPipeline:
+			if len(handler.Statuses) == 0 {
+				addErr("%s: statuses are required for handlers of type '%s'", prefix, handler.Type)
+			}
+			if len(handler.Actions) > 0 {
+				addErr("%s: actions are not supported for handlers of type '%s'", prefix, handler.Type)
+			}
+		}
+		for _, pattern := range handler.Branches {
+			if _, err := path.Match(pattern, ""); err != nil {
+				addErr("%s: invalid branch pattern '%s'", prefix, pattern)
+			}
+		}
+		if handler.Timeout < 0 {
+			addErr("%s: timeout must not be negative", prefix)
+		}
+		for _, param := range requiredParams[handler.Type] {
+			if handler.Params[param] == "" {
+				addErr("%s: param '%s' is required for handlers of type '%s'", prefix, param, handler.Type)
+			}
+		}
+		for _, param := range intParams[handler.Type] {
+			if value, ok := handler.Params[param]; ok {
+				if n, err := strconv.Atoi(value); err != nil || n < 0 {
+					addErr("%s: param '%s' must be a non-negative integer", prefix, param)
+				}
+			}
+		}
+		for j, issueKey := range handler.IssueKeys {
+			if _, err := regexp.Compile(issueKey.Pattern); err != nil {
+				addErr("%s: issue_keys[%d]: invalid pattern: %v", prefix, j, err)
+			}
+			if len(issueKey.Sources) == 0 {
+				addErr("%s: issue_keys[%d]: sources are required", prefix, j)
+			}
+			for _, source := range issueKey.Sources {
+				if !handlers.IsIssueKeySource(source) {
+					addErr("%s: issue_keys[%d]: unknown source '%s'", prefix, j, source)
+				}
+			}
+		}
+		if handler.Type == "youtrack_command" && len(handler.Commands) == 0 {
+			addErr("%s: commands are required for handlers of type '%s'", prefix, handler.Type)
+		}
+		for j, command := range handler.Commands {
+			if _, err := path.Match(command.TargetBranch, ""); err != nil || command.TargetBranch == "" {
+				addErr("%s: commands[%d]: invalid target_branch pattern '%s'", prefix, j, command.TargetBranch)
+			}
+			if command.Command == "" {
+				addErr("%s: commands[%d]: command is required", prefix, j)
+			}
+		}
+		if youtrackTypes[handler.Type] && cfg.YouTrack == nil {
+			addErr("%s: youtrack must be configured for handlers of type '%s'", prefix, handler.Type)
+		}
+		if jiraTypes[handler.Type] && cfg.Jira == nil {
+			addErr("%s: jira must be configured for handlers of type '%s'", prefix, handler.Type)
+		}
+		if handler.Type == "redmine" && cfg.Redmine == nil {
+			addErr("%s: redmine must be configured for handlers of type '%s'", prefix, handler.Type)
+		}
+		if handler.Type == "issues" && len(cfg.Trackers) == 0 {
+			addErr("%s: trackers must be configured for handlers of type '%s'", prefix, handler.Type)
+		}
+		// The default issue keys are those of YouTrack, which do not fit the
+		// other trackers, so the issue keys of the trackers must be given
+		if handler.Type == "issues" && len(handler.IssueKeys) == 0 {
+			addErr("%s: issue_keys are required for handlers of type '%s'", prefix, handler.Type)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var validConfigYAML = `
+server:
+  addr: ":8080"
+  webhook_token: webhook-secret
+gitlab:
+  token: gitlab-secret
+youtrack:
+  url: https://track.example.com/
+  username: bot
+  password: youtrack-secret
+handlers:
+  - type: youtrack
+    actions: [open]
+    projects: [group/project]
+    branches: ["feature/*", "release-fix/*"]
+    timeout: 30s
+    issue_keys:
+      - pattern: '(?i)^(?:feature|release-fix)/([a-z]+)([0-9]+)'
+        template: '$1-$2'
+        sources: [branch]
+      - pattern: '\b[A-Z][A-Z0-9]+-[0-9]+\b'
+        sources: [title, commits]
+  - name: beepboop
+    type: message
+    actions: [open, reopen]
+    params:
+      message: BeepBoop!
+  - type: pipeline_failure
+    statuses: [failed]
+    error_footer: true
+  - type: youtrack_command
+    dry_run: true
+    commands:
+      - target_branch: master
+        command: State Fixed
+`
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(validConfigYAML))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if cfg.Server.Addr != ":8080" {
+		t.Errorf("expected addr ':8080', was: '%s'", cfg.Server.Addr)
+	}
+	if cfg.Server.Workers != 4 {
+		t.Errorf("expected default workers 4, was: %d", cfg.Server.Workers)
+	}
+	if cfg.GitLab.URL != "https://gitlab.com/" {
+		t.Errorf("expected default GitLab URL, was: '%s'", cfg.GitLab.URL)
+	}
+	if len(cfg.Handlers) != 4 {
+		t.Fatalf("expected 4 handlers, was: %d", len(cfg.Handlers))
+	}
+	youtrack := cfg.Handlers[0]
+	if youtrack.Name != "youtrack" {
+		t.Errorf("expected name to default to type, was: '%s'", youtrack.Name)
+	}
+	if youtrack.Timeout != 30*time.Second {
+		t.Errorf("expected timeout 30s, was: %s", youtrack.Timeout)
+	}
+	if len(youtrack.IssueKeys) != 2 || youtrack.IssueKeys[0].Template != "$1-$2" {
+		t.Errorf("unexpected issue keys: %+v", youtrack.IssueKeys)
+	}
+	if youtrack.Event() != EventMergeRequest {
+		t.Errorf("expected event '%s', was: '%s'", EventMergeRequest, youtrack.Event())
+	}
+	if cfg.Handlers[1].Params["message"] != "BeepBoop!" {
+		t.Errorf("unexpected message param: '%s'", cfg.Handlers[1].Params["message"])
+	}
+	if cfg.Handlers[2].Event() != EventPipeline {
+		t.Errorf("expected event '%s', was: '%s'", EventPipeline, cfg.Handlers[2].Event())
+	}
+	command := cfg.Handlers[3]
+	if len(command.Actions) != 1 || command.Actions[0] != "merge" {
+		t.Errorf("expected actions to default to [merge], was: %v", command.Actions)
+	}
+	if !command.DryRun || len(command.Commands) != 1 || command.Commands[0].Command != "State Fixed" {
+		t.Errorf("unexpected youtrack_command handler: %+v", command)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		yaml          string
+		expectedError string
+	}{
+		{"gitlab: {}", "gitlab.token is required"},
+		{"gitlab: {token: x}\nunknown: 1", "field unknown not found"},
+		{"gitlab: {token: x}\nhandlers: [{type: foo}]", "handlers[0] (foo): unknown type 'foo'"},
+		{"gitlab: {token: x}\nhandlers: [{type: message, params: {message: x}}]", "actions are required"},
+		{"gitlab: {token: x}\nhandlers: [{type: message, actions: [open]}]", "param 'message' is required"},
+		{"gitlab: {token: x}\nhandlers: [{type: pipeline_failure, actions: [open], statuses: [failed]}]", "actions are not supported"},
+		{"gitlab: {token: x}\nhandlers: [{type: youtrack, actions: [open]}]", "youtrack must be configured"},
+		{"gitlab: {token: x}\nhandlers: [{type: youtrack_backlink, actions: [open]}]", "youtrack must be configured for handlers of type 'youtrack_backlink'"},
+		{"gitlab: {token: x}\nhandlers: [{type: jira_remote_link, actions: [open]}]", "jira must be configured for handlers of type 'jira_remote_link'"},
+		{"gitlab: {token: x}\nyoutrack: {url: x, username: u}", "youtrack.token, or youtrack.username and youtrack.password, are required"},
+		{"gitlab: {token: x}\nyoutrack: {url: x, token: t, username: u, password: p}", "youtrack.token can not be combined"},
+		{"gitlab: {token: x}\nhandlers: [{type: url_file, actions: [open], params: {url: x}, branches: ['[']}]", "invalid branch pattern '['"},
+		{"gitlab: {token: x}\nhandlers: [{type: url_file, actions: [open], params: {url: x}, timeout: soon}]", "cannot unmarshal"},
+		{"gitlab: {token: x}\nhandlers: [{type: message, actions: [open], params: {message: x}, issue_keys: [{pattern: '(', sources: [title]}]}]", "issue_keys[0]: invalid pattern"},
+		{"gitlab: {token: x}\nhandlers: [{type: message, actions: [open], params: {message: x}, issue_keys: [{pattern: 'x'}]}]", "issue_keys[0]: sources are required"},
+		{"gitlab: {token: x}\nhandlers: [{type: message, actions: [open], params: {message: x}, issue_keys: [{pattern: 'x', sources: [body]}]}]", "unknown source 'body'"},
+		{"gitlab: {token: x}\nhandlers: [{type: youtrack, actions: [open], params: {max_description_length: long}}]", "param 'max_description_length' must be a non-negative integer"},
+		{"gitlab: {token: x}\nhandlers: [{type: jira, actions: [open]}]", "jira must be configured"},
+		{"gitlab: {token: x}\njira: {url: x}", "jira.token is required"},
+		{"gitlab: {token: x}\nhandlers: [{type: issues, actions: [open]}]", "trackers must be configured for handlers of type 'issues'"},
+		{"gitlab: {token: x}\nhandlers: [{type: issues, actions: [open]}]", "issue_keys are required for handlers of type 'issues'"},
+		{"gitlab: {token: x}\ntrackers: [{tracker: bugzilla}]", "trackers[0]: unknown tracker 'bugzilla'"},
+		{"gitlab: {token: x}\ntrackers: [{tracker: redmine}]", "trackers[0]: redmine must be configured"},
+		{"gitlab: {token: x}\nhandlers: [{type: redmine, actions: [open]}]", "redmine must be configured for handlers of type 'redmine'"},
+		{"gitlab: {token: x}\nredmine: {url: x}", "redmine.api_key is required"},
+		{"gitlab: {token: x}\ntrackers: [{tracker: jira, projects: [group/project]}]", "trackers[0]: jira must be configured"},
+		{"gitlab: {token: x}\nhandlers: [{type: youtrack_command}]", "commands are required"},
+		{"gitlab: {token: x}\nhandlers: [{type: youtrack_command, commands: [{target_branch: '[', command: x}]}]", "commands[0]: invalid target_branch pattern '['"},
+		{"gitlab: {token: x}\nhandlers: [{type: youtrack_command, commands: [{target_branch: master}]}]", "commands[0]: command is required"},
+		{"gitlab: {token: x}\nhandlers: [{type: pipeline_failure, statuses: [failed]}, {type: pipeline_failure, statuses: [success]}]", "handlers[1] (pipeline_failure): name is not unique"},
+	}
+	for _, test := range tests {
+		_, err := Parse([]byte(test.yaml))
+		if err == nil {
+			t.Errorf("expected an error for config '%s'", test.yaml)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.expectedError) {
+			t.Errorf("expected error containing '%s' for config '%s', got: %v",
+				test.expectedError, test.yaml, err)
+		}
+	}
+}
+
+func TestTrackerFor(t *testing.T) {
+	cfg := &Config{Trackers: []TrackerConfig{
+		{Tracker: "gitlab", Projects: []string{"group/a", "group/b"}},
+		{Tracker: "youtrack", Projects: []string{"group/c"}},
+	}}
+	tests := []struct {
+		projectPath string
+		expected    string
+	}{
+		{"group/b", "gitlab"},
+		{"group/c", "youtrack"},
+		{"group/d", ""},
+	}
+	for _, test := range tests {
+		if actual := cfg.TrackerFor(test.projectPath); actual != test.expected {
+			t.Errorf("expected tracker '%s' for '%s', was: '%s'", test.expected, test.projectPath, actual)
+		}
+	}
+	cfg.Trackers = append(cfg.Trackers, TrackerConfig{Tracker: "jira"})
+	if actual := cfg.TrackerFor("group/d"); actual != "jira" {
+		t.Errorf("expected the tracker without projects for other projects, was: '%s'", actual)
+	}
+}
@@ -0,0 +1,110 @@
+package mrgitlab
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// deliveryStoreSize is the max number of delivery ids remembered
+	// for detecting duplicate webhook deliveries.
+	deliveryStoreSize = 10000
+	// deliveryTTL is how long a delivery id is remembered.
+	deliveryTTL = 24 * time.Hour
+)
+
+// webhookDeliveryID returns an id identifying the delivery of a webhook. This
+// is the "X-Gitlab-Event-UUID" header, if set. Otherwise it is a hash of the
+// event type and the payload of the webhook.
+func webhookDeliveryID(r *http.Request, event string, payload []byte) string {
+	if uuid := r.Header.Get("X-Gitlab-Event-UUID"); uuid != "" {
+		return "uuid:" + uuid
+	}
+	h := sha256.New()
+	h.Write([]byte(event))
+	h.Write([]byte{0})
+	h.Write(payload)
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// deliveryEntry is a single delivery id in a deliveryStore.
+type deliveryEntry struct {
+	id     string
+	seenAt time.Time
+}
+
+// deliveryStore is a bounded set of recently seen webhook delivery ids,
+// used to detect webhooks that are delivered more than once. An id is
+// remembered for the ttl, or until the store holds maxSize newer ids.
+type deliveryStore struct {
+	maxSize int
+	ttl     time.Duration
+	// now returns the current time, replaceable for testing.
+	now func() time.Time
+
+	mu sync.Mutex
+	// entries maps an id to its element in order.
+	entries map[string]*list.Element
+	// order holds the *deliveryEntry of each id, oldest first.
+	order *list.List
+}
+
+// newDeliveryStore creates a new deliveryStore holding at most maxSize
+// ids, each for at most ttl.
+func newDeliveryStore(maxSize int, ttl time.Duration) *deliveryStore {
+	return &deliveryStore{
+		maxSize: maxSize,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// add adds the id to the store. It returns false, and does not modify the
+// store, if the id has already been added and has not yet expired.
+func (s *deliveryStore) add(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.evict(now)
+	if _, ok := s.entries[id]; ok {
+		return false
+	}
+	s.entries[id] = s.order.PushBack(&deliveryEntry{id: id, seenAt: now})
+	if s.order.Len() > s.maxSize {
+		s.removeElement(s.order.Front())
+	}
+	return true
+}
+
+// remove removes the id from the store, so that it is no longer
+// considered seen.
+func (s *deliveryStore) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[id]; ok {
+		s.removeElement(elem)
+	}
+}
+
+// evict removes all ids that have expired. Must be called with mu held.
+func (s *deliveryStore) evict(now time.Time) {
+	for elem := s.order.Front(); elem != nil; elem = s.order.Front() {
+		if now.Sub(elem.Value.(*deliveryEntry).seenAt) < s.ttl {
+			return
+		}
+		s.removeElement(elem)
+	}
+}
+
+// removeElement removes the element from both order and entries. Must
+// be called with mu held.
+func (s *deliveryStore) removeElement(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.entries, elem.Value.(*deliveryEntry).id)
+}
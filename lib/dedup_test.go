@@ -0,0 +1,67 @@
+package mrgitlab
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeliveryStore_AddTwice(t *testing.T) {
+	s := newDeliveryStore(10, time.Hour)
+	if !s.add("a") {
+		t.Error("expected first add to return true")
+	}
+	if s.add("a") {
+		t.Error("expected second add to return false")
+	}
+	s.remove("a")
+	if !s.add("a") {
+		t.Error("expected add after remove to return true")
+	}
+}
+
+func TestDeliveryStore_Expires(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newDeliveryStore(10, time.Hour)
+	s.now = func() time.Time { return now }
+	s.add("a")
+	now = now.Add(59 * time.Minute)
+	if s.add("a") {
+		t.Error("expected id to be remembered before ttl")
+	}
+	now = now.Add(time.Minute)
+	if !s.add("a") {
+		t.Error("expected id to be forgotten after ttl")
+	}
+}
+
+func TestDeliveryStore_Bounded(t *testing.T) {
+	s := newDeliveryStore(2, time.Hour)
+	s.add("a")
+	s.add("b")
+	s.add("c")
+	if len(s.entries) != 2 || s.order.Len() != 2 {
+		t.Errorf("expected store to hold 2 ids, held: %d", len(s.entries))
+	}
+	if !s.add("a") {
+		t.Error("expected oldest id to have been evicted")
+	}
+}
+
+func TestWebhookDeliveryID(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	byHash := webhookDeliveryID(req, "Push Hook", []byte(`{}`))
+	if byHash != webhookDeliveryID(req, "Push Hook", []byte(`{}`)) {
+		t.Error("expected the same payload to give the same id")
+	}
+	if byHash == webhookDeliveryID(req, "Push Hook", []byte(`{"a":1}`)) {
+		t.Error("expected different payloads to give different ids")
+	}
+	if byHash == webhookDeliveryID(req, "Tag Push Hook", []byte(`{}`)) {
+		t.Error("expected different events to give different ids")
+	}
+	req.Header.Set("X-Gitlab-Event-UUID", "abc")
+	if id := webhookDeliveryID(req, "Push Hook", []byte(`{}`)); id != "uuid:abc" {
+		t.Errorf("expected id from X-Gitlab-Event-UUID, got: '%s'", id)
+	}
+}
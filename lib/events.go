@@ -0,0 +1,191 @@
+package mrgitlab
+
+import (
+	"context"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/redact"
+)
+
+// PushHandler is a handler for handling push events, triggered via
+// GitLab webhooks.
+type PushHandler interface {
+	// HandlePush is called when a push webhook have been received. The
+	// HandlePush must return the context's error should the context become
+	// cancelled before the handler can finish. The HandlePush must not
+	// modify the provided PushWebhook data.
+	HandlePush(context.Context, *gitlab.PushWebhook) error
+}
+
+// TagPushHandler is a handler for handling tag push events, triggered via
+// GitLab webhooks.
+type TagPushHandler interface {
+	// HandleTagPush is called when a tag push webhook have been received. The
+	// HandleTagPush must return the context's error should the context become
+	// cancelled before the handler can finish. The HandleTagPush must not
+	// modify the provided TagPushWebhook data.
+	HandleTagPush(context.Context, *gitlab.TagPushWebhook) error
+}
+
+// IssueHandler is a handler for handling issue events, triggered via
+// GitLab webhooks.
+type IssueHandler interface {
+	// HandleIssue is called when a issue webhook have been received. The
+	// HandleIssue must return the context's error should the context become
+	// cancelled before the handler can finish. The HandleIssue must not
+	// modify the provided IssueWebhook data.
+	HandleIssue(context.Context, *gitlab.IssueWebhook) error
+}
+
+// NoteHandler is a handler for handling comment (note) events, triggered via
+// GitLab webhooks.
+type NoteHandler interface {
+	// HandleNote is called when a comment (note) webhook have been received. The
+	// HandleNote must return the context's error should the context become
+	// cancelled before the handler can finish. The HandleNote must not
+	// modify the provided NoteWebhook data.
+	HandleNote(context.Context, *gitlab.NoteWebhook) error
+}
+
+// JobHandler is a handler for handling job events, triggered via
+// GitLab webhooks.
+type JobHandler interface {
+	// HandleJob is called when a job webhook have been received. The
+	// HandleJob must return the context's error should the context become
+	// cancelled before the handler can finish. The HandleJob must not
+	// modify the provided JobWebhook data.
+	HandleJob(context.Context, *gitlab.JobWebhook) error
+}
+
+// WikiPageHandler is a handler for handling wiki page events, triggered via
+// GitLab webhooks.
+type WikiPageHandler interface {
+	// HandleWikiPage is called when a wiki page webhook have been received. The
+	// HandleWikiPage must return the context's error should the context become
+	// cancelled before the handler can finish. The HandleWikiPage must not
+	// modify the provided WikiPageWebhook data.
+	HandleWikiPage(context.Context, *gitlab.WikiPageWebhook) error
+}
+
+// DeploymentHandler is a handler for handling deployment events, triggered via
+// GitLab webhooks.
+type DeploymentHandler interface {
+	// HandleDeployment is called when a deployment webhook have been received. The
+	// HandleDeployment must return the context's error should the context become
+	// cancelled before the handler can finish. The HandleDeployment must not
+	// modify the provided DeploymentWebhook data.
+	HandleDeployment(context.Context, *gitlab.DeploymentWebhook) error
+}
+
+// ReleaseHandler is a handler for handling release events, triggered via
+// GitLab webhooks.
+type ReleaseHandler interface {
+	// HandleRelease is called when a release webhook have been received. The
+	// HandleRelease must return the context's error should the context become
+	// cancelled before the handler can finish. The HandleRelease must not
+	// modify the provided ReleaseWebhook data.
+	HandleRelease(context.Context, *gitlab.ReleaseWebhook) error
+}
+
+// RegisterPushHandler registers a PushHandler, called for each push event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterPushHandler(handler PushHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterPushHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterTagPushHandler registers a TagPushHandler, called for each tag push event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterTagPushHandler(handler TagPushHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterTagPushHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterIssueHandler registers an IssueHandler, called for each issue event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterIssueHandler(handler IssueHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterIssueHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterNoteHandler registers a NoteHandler, called for each comment (note) event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterNoteHandler(handler NoteHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterNoteHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterJobHandler registers a JobHandler, called for each job event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterJobHandler(handler JobHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterJobHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterWikiPageHandler registers a WikiPageHandler, called for each wiki page event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterWikiPageHandler(handler WikiPageHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterWikiPageHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterDeploymentHandler registers a DeploymentHandler, called for each deployment event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterDeploymentHandler(handler DeploymentHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterDeploymentHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// RegisterReleaseHandler registers a ReleaseHandler, called for each release event.
+// The opts configure how the handler is run, see HandlerOption.
+func (app *App) RegisterReleaseHandler(handler ReleaseHandler, opts ...HandlerOption) {
+	app.handlersMu.Lock()
+	app.handlers.RegisterReleaseHandler(handler, opts...)
+	app.handlersMu.Unlock()
+}
+
+// eventRegistration is a registered handler of an event that the handler
+// does not add a note for, e.g. a PushHandler, together with the options
+// it was registered with.
+type eventRegistration struct {
+	// handle calls the handler with the webhook, which is always
+	// of the type of webhook handled by the handler.
+	handle  func(ctx context.Context, webhook interface{}) error
+	options handlerOptions
+}
+
+// newEventRoute returns the eventRoute of an event that handlers do not add
+// notes for. The webhook is decoded into the webhook model returned by
+// newWebhook, and dispatched to the registrations, as returned by the
+// registrations func for the current handlers, waiting for them to complete.
+func (app *App) newEventRoute(event string, newWebhook func() interface{},
+	registrations func(set *HandlerSet) []eventRegistration) eventRoute {
+	return eventRoute{
+		newWebhook: newWebhook,
+		handle: func(ctx context.Context, webhook interface{}, progress *jobProgress) error {
+			app.logger.Debugf("on %s webhook: %s", event, redact.JSON(webhook, app.secretFields...))
+			app.handlersMu.RLock()
+			eventRegistrations := registrations(app.handlers)
+			app.handlersMu.RUnlock()
+			var noteHandlers []noteHandler
+			for _, registration := range eventRegistrations {
+				handle := registration.handle
+				noteHandlers = append(noteHandlers, noteHandler{
+					handle: func(ctx context.Context) (string, error) {
+						return "", handle(ctx, webhook)
+					},
+					options: registration.options,
+				})
+			}
+			_, err := app.collectMessages(ctx, progress, noteHandlers)
+			return err
+		},
+	}
+}
@@ -7,11 +7,18 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/internal/restclient"
+	"github.com/verath/mrgitlab/lib/redact"
 )
 
+// perPage is the number of items, e.g. notes, requested per page when
+// listing items. 100 is the maximum allowed by the GitLab API.
+const perPage = 100
+
 // Client is a client for the GitLab v4 REST api.
 type Client struct {
 	logger       *logrus.Entry
@@ -76,28 +83,198 @@ func (c *Client) checkResponse(res *http.Response) error {
 	if res.StatusCode >= 200 && res.StatusCode < 300 {
 		return nil
 	}
-	return errors.Errorf("Bad response code: %d", res.StatusCode)
+	return restclient.NewHTTPError(res)
+}
+
+// do sends the request using the client's httpClient and checks the response
+// status. If v is non-nil, the response body is decoded as JSON into v. The
+// returned response has its body closed, but its headers can still be inspected.
+func (c *Client) do(req *http.Request, v interface{}) (*http.Response, error) {
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error sending request")
+	}
+	defer res.Body.Close()
+	c.logger.Debugf("%s %s - %d", req.Method, redact.URL(req.URL), res.StatusCode)
+	if err := c.checkResponse(res); err != nil {
+		return nil, errors.Wrap(err, "Bad response")
+	}
+	if v != nil {
+		if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+			return nil, errors.Wrap(err, "Error decoding response body")
+		}
+	}
+	return res, nil
+}
+
+// CurrentUser returns the user that the private token of the client
+// belongs to.
+func (c *Client) CurrentUser(ctx context.Context) (*User, error) {
+	req, err := c.newRequest(ctx, "GET", "user", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+	user := &User{}
+	if _, err := c.do(req, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// mergeRequestNotesPath returns the api path of the notes of the merge
+// request identified by the mergeRequestID.
+func mergeRequestNotesPath(mergeRequestID MergeRequestID) string {
+	return fmt.Sprintf("projects/%d/merge_requests/%d/notes", mergeRequestID.ProjectID, mergeRequestID.IID)
 }
 
 // AddMergeRequestNote creates a new note on the merge request identified
 // by the mergeRequestID. It returns an error if the request was not
 // successful, or if the context was cancelled.
 func (c *Client) AddMergeRequestNote(ctx context.Context, mergeRequestID MergeRequestID, note *Note) error {
-	path := fmt.Sprintf("projects/%d/merge_requests/%d/notes", mergeRequestID.ProjectID, mergeRequestID.IID)
-	req, err := c.newRequest(ctx, "POST", path, note)
+	req, err := c.newRequest(ctx, "POST", mergeRequestNotesPath(mergeRequestID), note)
 	if err != nil {
 		return errors.Wrap(err, "Error creating request")
 	}
-	res, err := c.httpClient.Do(req)
+	_, err = c.do(req, nil)
+	return err
+}
+
+// ListMergeRequestNotes returns all notes on the merge request identified
+// by the mergeRequestID. The notes are fetched page by page, following the
+// "X-Next-Page" header, until all pages have been read.
+func (c *Client) ListMergeRequestNotes(ctx context.Context, mergeRequestID MergeRequestID) ([]*Note, error) {
+	var notes []*Note
+	page := "1"
+	for page != "" {
+		path := fmt.Sprintf("%s?per_page=%d&page=%s", mergeRequestNotesPath(mergeRequestID), perPage, page)
+		req, err := c.newRequest(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating request")
+		}
+		var pageNotes []*Note
+		res, err := c.do(req, &pageNotes)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, pageNotes...)
+		page = res.Header.Get("X-Next-Page")
+	}
+	return notes, nil
+}
+
+// ListMergeRequestCommits returns all commits of the merge request identified
+// by the mergeRequestID, newest first. The commits are fetched page by page,
+// following the "X-Next-Page" header, until all pages have been read.
+func (c *Client) ListMergeRequestCommits(ctx context.Context, mergeRequestID MergeRequestID) ([]*Commit, error) {
+	var commits []*Commit
+	page := "1"
+	for page != "" {
+		path := fmt.Sprintf("projects/%d/merge_requests/%d/commits?per_page=%d&page=%s",
+			mergeRequestID.ProjectID, mergeRequestID.IID, perPage, page)
+		req, err := c.newRequest(ctx, "GET", path, nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating request")
+		}
+		var pageCommits []*Commit
+		res, err := c.do(req, &pageCommits)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, pageCommits...)
+		page = res.Header.Get("X-Next-Page")
+	}
+	return commits, nil
+}
+
+// EditMergeRequestNote replaces the body of the existing note identified by
+// noteID on the merge request identified by the mergeRequestID.
+func (c *Client) EditMergeRequestNote(ctx context.Context, mergeRequestID MergeRequestID, noteID int64, note *Note) error {
+	path := fmt.Sprintf("%s/%d", mergeRequestNotesPath(mergeRequestID), noteID)
+	req, err := c.newRequest(ctx, "PUT", path, note)
 	if err != nil {
-		return errors.Wrap(err, "Error sending request")
+		return errors.Wrap(err, "Error creating request")
 	}
-	defer func() {
-		c.logger.Debugf("POST %s - %d", req.URL, res.StatusCode)
-	}()
-	defer res.Body.Close()
-	if err := c.checkResponse(res); err != nil {
-		return errors.Wrap(err, "Bad response")
+	_, err = c.do(req, nil)
+	return err
+}
+
+// ListOpenMergeRequests returns the open merge requests that have the branch
+// sourceBranch of the project identified by sourceProjectID as their source
+// branch. The merge requests of all projects are listed, so that merge requests
+// from a fork to another project are included. The merge requests are fetched
+// page by page, following the "X-Next-Page" header, until all pages have been
+// read.
+func (c *Client) ListOpenMergeRequests(ctx context.Context, sourceProjectID int64, sourceBranch string) ([]*MergeRequest, error) {
+	query := url.Values{}
+	query.Set("scope", "all")
+	query.Set("state", "opened")
+	query.Set("source_branch", sourceBranch)
+	query.Set("per_page", strconv.Itoa(perPage))
+	var mergeRequests []*MergeRequest
+	page := "1"
+	for page != "" {
+		query.Set("page", page)
+		req, err := c.newRequest(ctx, "GET", "merge_requests?"+query.Encode(), nil)
+		if err != nil {
+			return nil, errors.Wrap(err, "Error creating request")
+		}
+		var pageMergeRequests []*MergeRequest
+		res, err := c.do(req, &pageMergeRequests)
+		if err != nil {
+			return nil, err
+		}
+		// The source branch is only filtered by name, which other
+		// projects can have branches of as well
+		for _, mr := range pageMergeRequests {
+			if mr.SourceProjectID == sourceProjectID {
+				mergeRequests = append(mergeRequests, mr)
+			}
+		}
+		page = res.Header.Get("X-Next-Page")
+	}
+	return mergeRequests, nil
+}
+
+// issuePath returns the api path of the issue identified by the
+// project-specific iid in the project identified by projectID.
+func issuePath(projectID int64, iid int64) string {
+	return fmt.Sprintf("projects/%d/issues/%d", projectID, iid)
+}
+
+// GetIssue returns the issue identified by the project-specific iid in the
+// project identified by projectID.
+func (c *Client) GetIssue(ctx context.Context, projectID int64, iid int64) (*Issue, error) {
+	req, err := c.newRequest(ctx, "GET", issuePath(projectID, iid), nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error creating request")
+	}
+	issue := &Issue{}
+	if _, err := c.do(req, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// AddIssueNote creates a new note on the issue identified by the
+// project-specific iid in the project identified by projectID.
+func (c *Client) AddIssueNote(ctx context.Context, projectID int64, iid int64, note *Note) error {
+	req, err := c.newRequest(ctx, "POST", issuePath(projectID, iid)+"/notes", note)
+	if err != nil {
+		return errors.Wrap(err, "Error creating request")
+	}
+	_, err = c.do(req, nil)
+	return err
+}
+
+// SetIssueState changes the state of the issue identified by the
+// project-specific iid in the project identified by projectID, using the
+// stateEvent "close" or "reopen".
+func (c *Client) SetIssueState(ctx context.Context, projectID int64, iid int64, stateEvent string) error {
+	body := map[string]string{"state_event": stateEvent}
+	req, err := c.newRequest(ctx, "PUT", issuePath(projectID, iid), body)
+	if err != nil {
+		return errors.Wrap(err, "Error creating request")
 	}
-	return nil
+	_, err = c.do(req, nil)
+	return err
 }
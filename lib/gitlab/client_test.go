@@ -0,0 +1,223 @@
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+func TestListMergeRequestNotes_FollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/1/merge_requests/2/notes" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id": 10, "body": "first"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id": 11, "body": "second"}]`)
+		default:
+			t.Errorf("unexpected page: %s", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	notes, err := c.ListMergeRequestNotes(context.Background(), MergeRequestID{ProjectID: 1, IID: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(notes) != 2 {
+		t.Fatalf("expected 2 notes, got: %d", len(notes))
+	}
+	if notes[0].ID != 10 || notes[1].ID != 11 {
+		t.Errorf("unexpected note ids: %d, %d", notes[0].ID, notes[1].ID)
+	}
+}
+
+func TestListMergeRequestCommits_FollowsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/1/merge_requests/2/commits" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"id": "b83d6e39", "message": "Refs XYZ-2"}]`)
+		case "2":
+			fmt.Fprint(w, `[{"id": "a91f3c02", "message": "Refs XYZ-1"}]`)
+		default:
+			t.Errorf("unexpected page: %s", r.URL.Query().Get("page"))
+		}
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	commits, err := c.ListMergeRequestCommits(context.Background(), MergeRequestID{ProjectID: 1, IID: 2})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(commits) != 2 {
+		t.Fatalf("expected 2 commits, got: %d", len(commits))
+	}
+	if commits[0].Message != "Refs XYZ-2" || commits[1].Message != "Refs XYZ-1" {
+		t.Errorf("unexpected commit messages: '%s', '%s'", commits[0].Message, commits[1].Message)
+	}
+}
+
+func TestEditMergeRequestNote(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("expected method PUT, was: %s", r.Method)
+		}
+		if r.URL.Path != "/api/v4/projects/1/merge_requests/2/notes/10" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.Header.Get("PRIVATE-TOKEN") != "token" {
+			t.Errorf("expected PRIVATE-TOKEN to be set")
+		}
+		note := &Note{}
+		if err := json.NewDecoder(r.Body).Decode(note); err != nil {
+			t.Errorf("unexpected error decoding body: %+v", err)
+		}
+		if note.Body != "updated" {
+			t.Errorf("expected body 'updated', was: '%s'", note.Body)
+		}
+		fmt.Fprint(w, `{"id": 10, "body": "updated"}`)
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	err = c.EditMergeRequestNote(context.Background(), MergeRequestID{ProjectID: 1, IID: 2}, 10, &Note{Body: "updated"})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+}
+
+func TestAddMergeRequestNote_BadResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	err = c.AddMergeRequestNote(context.Background(), MergeRequestID{ProjectID: 1, IID: 2}, &Note{Body: "body"})
+	if err == nil {
+		t.Error("expected an error for a bad response code")
+	}
+}
+
+func TestGetIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v4/projects/1/issues/3" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `{
+			"id": 30, "iid": 3, "project_id": 1,
+			"title": "Crash on start", "description": "It crashes",
+			"state": "opened",
+			"assignees": [{"id": 5, "name": "Jane Doe", "username": "jane"}],
+			"web_url": "https://gitlab.example.com/group/project/-/issues/3"
+		}`)
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	issue, err := c.GetIssue(context.Background(), 1, 3)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if issue.IID != 3 || issue.Title != "Crash on start" || issue.State != "opened" {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+	if len(issue.Assignees) != 1 || issue.Assignees[0].Username != "jane" {
+		t.Errorf("unexpected assignees: %+v", issue.Assignees)
+	}
+}
+
+func TestSetIssueState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" {
+			t.Errorf("expected method PUT, was: %s", r.Method)
+		}
+		if r.URL.Path != "/api/v4/projects/1/issues/3" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("unexpected error decoding body: %+v", err)
+		}
+		if body["state_event"] != "close" {
+			t.Errorf("expected state_event 'close', was: '%s'", body["state_event"])
+		}
+		fmt.Fprint(w, `{"id": 30, "iid": 3, "state": "closed"}`)
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if err := c.SetIssueState(context.Background(), 1, 3, "close"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+}
+
+// Test that the open merge requests are listed across all projects, page by
+// page, keeping only the merge requests from the source project.
+func TestListOpenMergeRequests(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/api/v4/merge_requests" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if query.Get("scope") != "all" || query.Get("state") != "opened" || query.Get("source_branch") != "feature/x" {
+			t.Errorf("unexpected query: %s", r.URL.RawQuery)
+		}
+		switch query.Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			fmt.Fprint(w, `[{"iid": 1, "project_id": 1, "source_project_id": 1}]`)
+		case "2":
+			fmt.Fprint(w, `[
+				{"iid": 2, "project_id": 1, "source_project_id": 3},
+				{"iid": 3, "project_id": 2, "source_project_id": 3}
+			]`)
+		default:
+			t.Errorf("unexpected page: %s", query.Get("page"))
+		}
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL, "token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	mergeRequests, err := c.ListOpenMergeRequests(context.Background(), 3, "feature/x")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(mergeRequests) != 2 {
+		t.Fatalf("expected 2 merge requests, got: %d", len(mergeRequests))
+	}
+	expected := []MergeRequestID{{ProjectID: 1, IID: 2}, {ProjectID: 2, IID: 3}}
+	for i, mr := range mergeRequests {
+		if mr.MergeRequestID() != expected[i] {
+			t.Errorf("expected merge request %+v, was: %+v", expected[i], mr.MergeRequestID())
+		}
+	}
+}
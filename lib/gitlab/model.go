@@ -4,14 +4,113 @@ package gitlab
 // in the merge request webhook. See:
 // https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#merge-request-events
 type MergeRequestWebhook struct {
-	ObjectKind       string `json:"object_kind"`
-	ObjectAttributes struct {
-		ID              int64  `json:"id"`
-		IID             int64  `json:"iid"`
-		SourceBranch    string `json:"source_branch"`
-		TargetProjectID int64  `json:"target_project_id"`
-		Action          string `json:"action"`
-	} `json:"object_attributes"`
+	ObjectKind string `json:"object_kind"`
+	EventType  string `json:"event_type"`
+	// User is the user that triggered the event, which is not
+	// necessarily the author of the merge request.
+	User             User                   `json:"user"`
+	Project          Project                `json:"project"`
+	Repository       Repository             `json:"repository"`
+	ObjectAttributes MergeRequestAttributes `json:"object_attributes"`
+	Labels           []Label                `json:"labels"`
+	Assignees        []User                 `json:"assignees"`
+	Reviewers        []User                 `json:"reviewers"`
+	// Changes holds the attributes changed by the event. Only
+	// the attributes that were changed are set.
+	Changes MergeRequestChanges `json:"changes"`
+}
+
+// MergeRequestAttributes are the attributes of a merge request, as
+// included in webhooks.
+type MergeRequestAttributes struct {
+	ID              int64   `json:"id"`
+	IID             int64   `json:"iid"`
+	Title           string  `json:"title"`
+	Description     string  `json:"description"`
+	State           string  `json:"state"`
+	MergeStatus     string  `json:"merge_status"`
+	URL             string  `json:"url"`
+	SourceBranch    string  `json:"source_branch"`
+	SourceProjectID int64   `json:"source_project_id"`
+	Source          Project `json:"source"`
+	TargetBranch    string  `json:"target_branch"`
+	TargetProjectID int64   `json:"target_project_id"`
+	Target          Project `json:"target"`
+	AuthorID        int64   `json:"author_id"`
+	AssigneeID      int64   `json:"assignee_id"`
+	AssigneeIDs     []int64 `json:"assignee_ids"`
+	ReviewerIDs     []int64 `json:"reviewer_ids"`
+	MilestoneID     int64   `json:"milestone_id"`
+	UpdatedByID     int64   `json:"updated_by_id"`
+	LastCommit      Commit  `json:"last_commit"`
+	Labels          []Label `json:"labels"`
+	// WorkInProgress is the name used by older GitLab versions
+	// for Draft. Use IsDraft to check either of them.
+	WorkInProgress bool   `json:"work_in_progress"`
+	Draft          bool   `json:"draft"`
+	MergeCommitSHA string `json:"merge_commit_sha"`
+	HeadPipelineID int64  `json:"head_pipeline_id"`
+	// OldRev is the previous head commit of the merge request, set
+	// for "update" actions caused by new commits being pushed.
+	OldRev    string `json:"oldrev"`
+	Action    string `json:"action"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// IsDraft returns true if the merge request is marked as a draft
+// (previously called "work in progress").
+func (attrs *MergeRequestAttributes) IsDraft() bool {
+	return attrs.Draft || attrs.WorkInProgress
+}
+
+// MergeRequestChanges are the attributes of a merge request that were
+// changed by the event a webhook was sent for. Attributes that were not
+// changed are nil.
+type MergeRequestChanges struct {
+	Title          *StringChange `json:"title"`
+	Description    *StringChange `json:"description"`
+	State          *StringChange `json:"state"`
+	TargetBranch   *StringChange `json:"target_branch"`
+	UpdatedAt      *StringChange `json:"updated_at"`
+	WorkInProgress *BoolChange   `json:"work_in_progress"`
+	Draft          *BoolChange   `json:"draft"`
+	MilestoneID    *IntChange    `json:"milestone_id"`
+	UpdatedByID    *IntChange    `json:"updated_by_id"`
+	Labels         *LabelsChange `json:"labels"`
+	Assignees      *UsersChange  `json:"assignees"`
+	Reviewers      *UsersChange  `json:"reviewers"`
+}
+
+// StringChange is the previous and current value of a changed string attribute.
+type StringChange struct {
+	Previous string `json:"previous"`
+	Current  string `json:"current"`
+}
+
+// BoolChange is the previous and current value of a changed boolean attribute.
+type BoolChange struct {
+	Previous bool `json:"previous"`
+	Current  bool `json:"current"`
+}
+
+// IntChange is the previous and current value of a changed integer attribute.
+type IntChange struct {
+	Previous int64 `json:"previous"`
+	Current  int64 `json:"current"`
+}
+
+// LabelsChange is the previous and current labels of a merge request.
+type LabelsChange struct {
+	Previous []Label `json:"previous"`
+	Current  []Label `json:"current"`
+}
+
+// UsersChange is the previous and current users of a changed user list
+// attribute, e.g. the assignees of a merge request.
+type UsersChange struct {
+	Previous []User `json:"previous"`
+	Current  []User `json:"current"`
 }
 
 // MergeRequestID represents the id of single merge request,
@@ -39,6 +138,86 @@ func NewMergeRequestID(webhook *MergeRequestWebhook) MergeRequestID {
 // A Note is a comment on GitLab snippets, issues or merge requests.
 // https://docs.gitlab.com/ee/api/notes.html
 type Note struct {
+	// ID is the id of the note. It is only set for notes
+	// returned by the GitLab API.
+	ID int64 `json:"id,omitempty"`
 	// Body is the markdown text content of the note.
 	Body string `json:"body"`
+	// Author is the user that wrote the note. It is only set
+	// for notes returned by the GitLab API.
+	Author *User `json:"author,omitempty"`
+}
+
+// PipelineWebhook is the data structure that GitLab provides us
+// in the pipeline webhook. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#pipeline-events
+type PipelineWebhook struct {
+	ObjectKind       string `json:"object_kind"`
+	ObjectAttributes struct {
+		ID     int64    `json:"id"`
+		Ref    string   `json:"ref"`
+		Tag    bool     `json:"tag"`
+		SHA    string   `json:"sha"`
+		Status string   `json:"status"`
+		Stages []string `json:"stages"`
+	} `json:"object_attributes"`
+	// MergeRequest is the merge request the pipeline was run for. It
+	// is only set for merge request pipelines.
+	MergeRequest *PipelineMergeRequest `json:"merge_request"`
+	User         User                  `json:"user"`
+	Project      Project               `json:"project"`
+	Commit       Commit                `json:"commit"`
+	Builds       []PipelineBuild       `json:"builds"`
+}
+
+// PipelineMergeRequest is the merge request information included in
+// a PipelineWebhook for merge request pipelines.
+type PipelineMergeRequest struct {
+	ID              int64  `json:"id"`
+	IID             int64  `json:"iid"`
+	SourceBranch    string `json:"source_branch"`
+	TargetProjectID int64  `json:"target_project_id"`
+	URL             string `json:"url"`
+}
+
+// PipelineBuild is a single build (job) of a pipeline, as included
+// in a PipelineWebhook.
+type PipelineBuild struct {
+	ID           int64  `json:"id"`
+	Stage        string `json:"stage"`
+	Name         string `json:"name"`
+	Status       string `json:"status"`
+	AllowFailure bool   `json:"allow_failure"`
+}
+
+// A MergeRequest is a merge request as returned by the GitLab API.
+// https://docs.gitlab.com/ee/api/merge_requests.html
+type MergeRequest struct {
+	ID  int64 `json:"id"`
+	IID int64 `json:"iid"`
+	// ProjectID is the id of the project of the merge request, i.e.
+	// its target project.
+	ProjectID       int64  `json:"project_id"`
+	SourceProjectID int64  `json:"source_project_id"`
+	SourceBranch    string `json:"source_branch"`
+	WebURL          string `json:"web_url"`
+}
+
+// MergeRequestID returns the MergeRequestID identifying the merge request.
+func (mr *MergeRequest) MergeRequestID() MergeRequestID {
+	return MergeRequestID{ProjectID: mr.ProjectID, IID: mr.IID}
+}
+
+// An Issue is an issue as returned by the GitLab API.
+// https://docs.gitlab.com/ee/api/issues.html
+type Issue struct {
+	ID          int64  `json:"id"`
+	IID         int64  `json:"iid"`
+	ProjectID   int64  `json:"project_id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// State is the state of the issue, "opened" or "closed".
+	State     string `json:"state"`
+	Assignees []User `json:"assignees"`
+	WebURL    string `json:"web_url"`
 }
@@ -0,0 +1,306 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// mergeRequestWebhookJSON is a merge request webhook, as sent by GitLab
+// when a merge request was updated.
+var mergeRequestWebhookJSON = `{
+  "object_kind": "merge_request",
+  "event_type": "merge_request",
+  "user": {
+    "id": 1,
+    "name": "Administrator",
+    "username": "root",
+    "avatar_url": "http://www.gravatar.com/avatar/e64c7d89f26bd1972efa854d13d7dd61?s=40&d=identicon",
+    "email": "admin@example.com"
+  },
+  "project": {
+    "id": 1,
+    "name": "Gitlab Test",
+    "description": "Aut reprehenderit ut est.",
+    "web_url": "http://example.com/gitlabhq/gitlab-test",
+    "avatar_url": null,
+    "git_ssh_url": "git@example.com:gitlabhq/gitlab-test.git",
+    "git_http_url": "http://example.com/gitlabhq/gitlab-test.git",
+    "namespace": "GitlabHQ",
+    "visibility_level": 20,
+    "path_with_namespace": "gitlabhq/gitlab-test",
+    "default_branch": "master",
+    "homepage": "http://example.com/gitlabhq/gitlab-test",
+    "url": "http://example.com/gitlabhq/gitlab-test.git",
+    "ssh_url": "git@example.com:gitlabhq/gitlab-test.git",
+    "http_url": "http://example.com/gitlabhq/gitlab-test.git"
+  },
+  "repository": {
+    "name": "Gitlab Test",
+    "url": "http://example.com/gitlabhq/gitlab-test.git",
+    "description": "Aut reprehenderit ut est.",
+    "homepage": "http://example.com/gitlabhq/gitlab-test"
+  },
+  "object_attributes": {
+    "id": 99,
+    "iid": 1,
+    "target_branch": "master",
+    "source_branch": "feature/xyz982_ms_viewer",
+    "source_project_id": 14,
+    "author_id": 51,
+    "assignee_ids": [6],
+    "assignee_id": 6,
+    "reviewer_ids": [6],
+    "title": "XYZ-982: MS-Viewer",
+    "created_at": "2013-12-03T17:23:34Z",
+    "updated_at": "2013-12-03T17:23:34Z",
+    "milestone_id": null,
+    "state": "opened",
+    "blocking_discussions_resolved": true,
+    "work_in_progress": false,
+    "draft": true,
+    "first_contribution": true,
+    "merge_status": "unchecked",
+    "target_project_id": 14,
+    "description": "Implements the viewer described in XYZ-982",
+    "total_time_spent": 1800,
+    "time_change": 30,
+    "human_total_time_spent": "30m",
+    "human_time_change": "30s",
+    "human_time_estimate": "30m",
+    "url": "http://example.com/diaspora/merge_requests/1",
+    "source": {
+      "name": "Awesome Project",
+      "description": "Aut reprehenderit ut est.",
+      "web_url": "http://example.com/awesome_space/awesome_project",
+      "avatar_url": null,
+      "git_ssh_url": "git@example.com:awesome_space/awesome_project.git",
+      "git_http_url": "http://example.com/awesome_space/awesome_project.git",
+      "namespace": "Awesome Space",
+      "visibility_level": 20,
+      "path_with_namespace": "awesome_space/awesome_project",
+      "default_branch": "master",
+      "homepage": "http://example.com/awesome_space/awesome_project",
+      "url": "http://example.com/awesome_space/awesome_project.git",
+      "ssh_url": "git@example.com:awesome_space/awesome_project.git",
+      "http_url": "http://example.com/awesome_space/awesome_project.git"
+    },
+    "target": {
+      "name": "Awesome Project",
+      "description": "Aut reprehenderit ut est.",
+      "web_url": "http://example.com/awesome_space/awesome_project",
+      "avatar_url": null,
+      "git_ssh_url": "git@example.com:awesome_space/awesome_project.git",
+      "git_http_url": "http://example.com/awesome_space/awesome_project.git",
+      "namespace": "Awesome Space",
+      "visibility_level": 20,
+      "path_with_namespace": "awesome_space/awesome_project",
+      "default_branch": "master",
+      "homepage": "http://example.com/awesome_space/awesome_project",
+      "url": "http://example.com/awesome_space/awesome_project.git",
+      "ssh_url": "git@example.com:awesome_space/awesome_project.git",
+      "http_url": "http://example.com/awesome_space/awesome_project.git"
+    },
+    "last_commit": {
+      "id": "da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+      "message": "fixed readme\n\nRefs XYZ-983",
+      "title": "fixed readme",
+      "timestamp": "2012-01-03T23:36:29+02:00",
+      "url": "http://example.com/awesome_space/awesome_project/commits/da1560886d4f094c3e6c9ef40349f7d38b5d27d7",
+      "author": {
+        "name": "GitLab dev user",
+        "email": "gitlabdev@dv6700.(none)"
+      }
+    },
+    "labels": [{
+      "id": 206,
+      "title": "API",
+      "color": "#ffffff",
+      "project_id": 14,
+      "created_at": "2013-12-03T17:15:43Z",
+      "updated_at": "2013-12-03T17:15:43Z",
+      "template": false,
+      "description": "API related issues",
+      "type": "ProjectLabel",
+      "group_id": 41
+    }],
+    "action": "update",
+    "oldrev": "f51b5e5a0d8e1fe1b4bc6c0d5a0e9a4b0a7e8e1c"
+  },
+  "labels": [{
+    "id": 206,
+    "title": "API",
+    "color": "#ffffff",
+    "project_id": 14,
+    "created_at": "2013-12-03T17:15:43Z",
+    "updated_at": "2013-12-03T17:15:43Z",
+    "template": false,
+    "description": "API related issues",
+    "type": "ProjectLabel",
+    "group_id": 41
+  }],
+  "changes": {
+    "updated_by_id": {
+      "previous": null,
+      "current": 1
+    },
+    "draft": {
+      "previous": false,
+      "current": true
+    },
+    "updated_at": {
+      "previous": "2017-09-15 16:50:55 UTC",
+      "current": "2017-09-15 16:52:00 UTC"
+    },
+    "labels": {
+      "previous": [{
+        "id": 206,
+        "title": "API",
+        "color": "#ffffff",
+        "project_id": 14,
+        "created_at": "2013-12-03T17:15:43Z",
+        "updated_at": "2013-12-03T17:15:43Z",
+        "template": false,
+        "description": "API related issues",
+        "type": "ProjectLabel",
+        "group_id": 41
+      }],
+      "current": [{
+        "id": 205,
+        "title": "Platform",
+        "color": "#123123",
+        "project_id": 14,
+        "created_at": "2013-12-03T17:15:43Z",
+        "updated_at": "2013-12-03T17:15:43Z",
+        "template": false,
+        "description": "Platform related issues",
+        "type": "ProjectLabel",
+        "group_id": 41
+      }]
+    }
+  },
+  "assignees": [
+    {
+      "id": 6,
+      "name": "User1",
+      "username": "user1",
+      "avatar_url": "http://www.gravatar.com/avatar/e64c7d89f26bd1972efa854d13d7dd61?s=40&d=identicon"
+    }
+  ],
+  "reviewers": [
+    {
+      "id": 6,
+      "name": "User1",
+      "username": "user1",
+      "avatar_url": "http://www.gravatar.com/avatar/e64c7d89f26bd1972efa854d13d7dd61?s=40&d=identicon"
+    }
+  ]
+}`
+
+// legacyMergeRequestWebhookJSON is a merge request webhook, as sent by
+// older (pre 13.0) GitLab versions when a merge request was opened.
+var legacyMergeRequestWebhookJSON = `{
+  "object_kind": "merge_request",
+  "user": {
+    "name": "Administrator",
+    "username": "root",
+    "avatar_url": "http://www.gravatar.com/avatar/e64c7d89f26bd1972efa854d13d7dd61?s=40&d=identicon"
+  },
+  "project": {
+    "name": "Gitlab Test",
+    "web_url": "http://example.com/gitlabhq/gitlab-test",
+    "path_with_namespace": "gitlabhq/gitlab-test",
+    "default_branch": "master"
+  },
+  "object_attributes": {
+    "id": 99,
+    "target_branch": "master",
+    "source_branch": "release-fix/XYZ990",
+    "source_project_id": 14,
+    "author_id": 51,
+    "assignee_id": null,
+    "title": "WIP: Fix the release",
+    "created_at": "2017-09-15 16:50:55 UTC",
+    "updated_at": "2017-09-15 16:50:55 UTC",
+    "milestone_id": null,
+    "state": "opened",
+    "merge_status": "unchecked",
+    "target_project_id": 14,
+    "iid": 1,
+    "description": null,
+    "work_in_progress": true,
+    "url": "http://example.com/diaspora/merge_requests/1",
+    "action": "open"
+  },
+  "labels": [],
+  "changes": {},
+  "assignee": null
+}`
+
+func TestMergeRequestWebhookUnmarshal(t *testing.T) {
+	webhook := &MergeRequestWebhook{}
+	if err := json.Unmarshal([]byte(mergeRequestWebhookJSON), webhook); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	// The labels and assignees are indexed below, so their lengths are
+	// checked before building the table.
+	if len(webhook.Labels) != 1 || len(webhook.Assignees) != 1 {
+		t.Fatalf("expected 1 label and 1 assignee, got: %+v and %+v", webhook.Labels, webhook.Assignees)
+	}
+	attrs := webhook.ObjectAttributes
+	tests := []struct {
+		name     string
+		actual   interface{}
+		expected interface{}
+	}{
+		{"title", attrs.Title, "XYZ-982: MS-Viewer"},
+		{"description", attrs.Description, "Implements the viewer described in XYZ-982"},
+		{"source branch", attrs.SourceBranch, "feature/xyz982_ms_viewer"},
+		{"target branch", attrs.TargetBranch, "master"},
+		{"author id", attrs.AuthorID, int64(51)},
+		{"action", attrs.Action, "update"},
+		{"draft", attrs.IsDraft(), true},
+		{"last commit message", attrs.LastCommit.Message, "fixed readme\n\nRefs XYZ-983"},
+		{"target project", attrs.Target.PathWithNamespace, "awesome_space/awesome_project"},
+		{"user", webhook.User.Username, "root"},
+		{"project", webhook.Project.PathWithNamespace, "gitlabhq/gitlab-test"},
+		{"label", webhook.Labels[0].Title, "API"},
+		{"assignee", webhook.Assignees[0].Username, "user1"},
+		{"num reviewers", len(webhook.Reviewers), 1},
+	}
+	for _, test := range tests {
+		if test.actual != test.expected {
+			t.Errorf("expected %s to be '%v', was: '%v'", test.name, test.expected, test.actual)
+		}
+	}
+	changes := webhook.Changes
+	if changes.Title != nil {
+		t.Errorf("expected title change to be nil, was: %+v", changes.Title)
+	}
+	if changes.Draft == nil || changes.Draft.Previous || !changes.Draft.Current {
+		t.Errorf("expected draft to change from false to true, was: %+v", changes.Draft)
+	}
+	if changes.UpdatedByID == nil || changes.UpdatedByID.Current != 1 {
+		t.Errorf("expected updated by id to change to 1, was: %+v", changes.UpdatedByID)
+	}
+	if changes.Labels == nil || len(changes.Labels.Current) != 1 || changes.Labels.Current[0].Title != "Platform" {
+		t.Errorf("expected labels to change to 'Platform', was: %+v", changes.Labels)
+	}
+}
+
+func TestLegacyMergeRequestWebhookUnmarshal(t *testing.T) {
+	webhook := &MergeRequestWebhook{}
+	if err := json.Unmarshal([]byte(legacyMergeRequestWebhookJSON), webhook); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	attrs := webhook.ObjectAttributes
+	if !attrs.IsDraft() {
+		t.Error("expected work in progress merge request to be a draft")
+	}
+	if attrs.Description != "" {
+		t.Errorf("expected null description to be empty, was: '%s'", attrs.Description)
+	}
+	mergeRequestID := NewMergeRequestID(webhook)
+	if mergeRequestID.ProjectID != 14 || mergeRequestID.IID != 1 {
+		t.Errorf("unexpected merge request id: %+v", mergeRequestID)
+	}
+}
@@ -0,0 +1,305 @@
+package gitlab
+
+import "encoding/json"
+
+// The values of the "X-Gitlab-Event" header, identifying the type of
+// event a webhook was sent for. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#events
+const (
+	EventPush              = "Push Hook"
+	EventTagPush           = "Tag Push Hook"
+	EventIssue             = "Issue Hook"
+	EventConfidentialIssue = "Confidential Issue Hook"
+	EventNote              = "Note Hook"
+	EventConfidentialNote  = "Confidential Note Hook"
+	EventMergeRequest      = "Merge Request Hook"
+	EventPipeline          = "Pipeline Hook"
+	EventJob               = "Job Hook"
+	EventWikiPage          = "Wiki Page Hook"
+	EventDeployment        = "Deployment Hook"
+	EventRelease           = "Release Hook"
+)
+
+// User is a GitLab user, as included in webhooks.
+type User struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	Username  string `json:"username"`
+	Email     string `json:"email"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+// Project is a GitLab project, as included in webhooks.
+type Project struct {
+	ID                int64  `json:"id"`
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	WebURL            string `json:"web_url"`
+	AvatarURL         string `json:"avatar_url"`
+	GitSSHURL         string `json:"git_ssh_url"`
+	GitHTTPURL        string `json:"git_http_url"`
+	Namespace         string `json:"namespace"`
+	VisibilityLevel   int    `json:"visibility_level"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	DefaultBranch     string `json:"default_branch"`
+	Homepage          string `json:"homepage"`
+}
+
+// Repository is the git repository of a project, as included in webhooks.
+type Repository struct {
+	Name            string `json:"name"`
+	URL             string `json:"url"`
+	Description     string `json:"description"`
+	Homepage        string `json:"homepage"`
+	GitHTTPURL      string `json:"git_http_url"`
+	GitSSHURL       string `json:"git_ssh_url"`
+	VisibilityLevel int    `json:"visibility_level"`
+}
+
+// Commit is a git commit, as included in webhooks and listed by the
+// merge request commits API.
+type Commit struct {
+	ID        string `json:"id"`
+	Message   string `json:"message"`
+	Title     string `json:"title"`
+	Timestamp string `json:"timestamp"`
+	URL       string `json:"url"`
+	Author    struct {
+		Name  string `json:"name"`
+		Email string `json:"email"`
+	} `json:"author"`
+	Added    []string `json:"added"`
+	Modified []string `json:"modified"`
+	Removed  []string `json:"removed"`
+}
+
+// Label is a project or group label, as included in webhooks.
+type Label struct {
+	ID          int64  `json:"id"`
+	Title       string `json:"title"`
+	Color       string `json:"color"`
+	ProjectID   int64  `json:"project_id"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	GroupID     int64  `json:"group_id"`
+}
+
+// Change is the previous and current value of an attribute that was
+// changed by the event a webhook was sent for. The values are kept as
+// raw json as their type depends on the attribute.
+type Change struct {
+	Previous json.RawMessage `json:"previous"`
+	Current  json.RawMessage `json:"current"`
+}
+
+// PushWebhook is the data structure that GitLab provides us
+// in the push webhook. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#push-events
+type PushWebhook struct {
+	ObjectKind        string     `json:"object_kind"`
+	Before            string     `json:"before"`
+	After             string     `json:"after"`
+	Ref               string     `json:"ref"`
+	CheckoutSHA       string     `json:"checkout_sha"`
+	UserID            int64      `json:"user_id"`
+	UserName          string     `json:"user_name"`
+	UserUsername      string     `json:"user_username"`
+	UserEmail         string     `json:"user_email"`
+	UserAvatar        string     `json:"user_avatar"`
+	ProjectID         int64      `json:"project_id"`
+	Project           Project    `json:"project"`
+	Repository        Repository `json:"repository"`
+	Commits           []Commit   `json:"commits"`
+	TotalCommitsCount int        `json:"total_commits_count"`
+}
+
+// TagPushWebhook is the data structure that GitLab provides us
+// in the tag push webhook. It has the same structure as the PushWebhook.
+// See: https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#tag-events
+type TagPushWebhook PushWebhook
+
+// IssueWebhook is the data structure that GitLab provides us
+// in the issue webhook. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#issues-events
+type IssueWebhook struct {
+	ObjectKind       string            `json:"object_kind"`
+	User             User              `json:"user"`
+	Project          Project           `json:"project"`
+	Repository       Repository        `json:"repository"`
+	ObjectAttributes IssueAttributes   `json:"object_attributes"`
+	Assignees        []User            `json:"assignees"`
+	Labels           []Label           `json:"labels"`
+	Changes          map[string]Change `json:"changes"`
+}
+
+// IssueAttributes are the attributes of an issue, as included in webhooks.
+type IssueAttributes struct {
+	ID           int64  `json:"id"`
+	IID          int64  `json:"iid"`
+	Title        string `json:"title"`
+	Description  string `json:"description"`
+	State        string `json:"state"`
+	Action       string `json:"action"`
+	URL          string `json:"url"`
+	AuthorID     int64  `json:"author_id"`
+	ProjectID    int64  `json:"project_id"`
+	MilestoneID  int64  `json:"milestone_id"`
+	Confidential bool   `json:"confidential"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// NoteWebhook is the data structure that GitLab provides us
+// in the comment (note) webhook. Depending on the NoteableType, one
+// of Commit, MergeRequest, Issue or Snippet is set. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#comment-events
+type NoteWebhook struct {
+	ObjectKind       string         `json:"object_kind"`
+	User             User           `json:"user"`
+	ProjectID        int64          `json:"project_id"`
+	Project          Project        `json:"project"`
+	Repository       Repository     `json:"repository"`
+	ObjectAttributes NoteAttributes `json:"object_attributes"`
+
+	Commit       *Commit                 `json:"commit"`
+	MergeRequest *MergeRequestAttributes `json:"merge_request"`
+	Issue        *IssueAttributes        `json:"issue"`
+	Snippet      *SnippetAttributes      `json:"snippet"`
+}
+
+// NoteAttributes are the attributes of a note, as included in webhooks.
+type NoteAttributes struct {
+	ID           int64  `json:"id"`
+	Note         string `json:"note"`
+	NoteableType string `json:"noteable_type"`
+	NoteableID   int64  `json:"noteable_id"`
+	AuthorID     int64  `json:"author_id"`
+	ProjectID    int64  `json:"project_id"`
+	CommitID     string `json:"commit_id"`
+	LineCode     string `json:"line_code"`
+	System       bool   `json:"system"`
+	URL          string `json:"url"`
+	CreatedAt    string `json:"created_at"`
+	UpdatedAt    string `json:"updated_at"`
+}
+
+// SnippetAttributes are the attributes of a snippet, as included in webhooks.
+type SnippetAttributes struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title"`
+	Content   string `json:"content"`
+	FileName  string `json:"file_name"`
+	AuthorID  int64  `json:"author_id"`
+	ProjectID int64  `json:"project_id"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+// JobWebhook is the data structure that GitLab provides us
+// in the job webhook. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#job-events
+type JobWebhook struct {
+	ObjectKind         string  `json:"object_kind"`
+	Ref                string  `json:"ref"`
+	Tag                bool    `json:"tag"`
+	BeforeSHA          string  `json:"before_sha"`
+	SHA                string  `json:"sha"`
+	BuildID            int64   `json:"build_id"`
+	BuildName          string  `json:"build_name"`
+	BuildStage         string  `json:"build_stage"`
+	BuildStatus        string  `json:"build_status"`
+	BuildStartedAt     string  `json:"build_started_at"`
+	BuildFinishedAt    string  `json:"build_finished_at"`
+	BuildDuration      float64 `json:"build_duration"`
+	BuildAllowFailure  bool    `json:"build_allow_failure"`
+	BuildFailureReason string  `json:"build_failure_reason"`
+	PipelineID         int64   `json:"pipeline_id"`
+	ProjectID          int64   `json:"project_id"`
+	ProjectName        string  `json:"project_name"`
+	User               User    `json:"user"`
+	Commit             struct {
+		ID          int64   `json:"id"`
+		SHA         string  `json:"sha"`
+		Message     string  `json:"message"`
+		AuthorName  string  `json:"author_name"`
+		AuthorEmail string  `json:"author_email"`
+		Status      string  `json:"status"`
+		Duration    float64 `json:"duration"`
+		StartedAt   string  `json:"started_at"`
+		FinishedAt  string  `json:"finished_at"`
+	} `json:"commit"`
+	Repository Repository `json:"repository"`
+}
+
+// WikiPageWebhook is the data structure that GitLab provides us
+// in the wiki page webhook. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#wiki-page-events
+type WikiPageWebhook struct {
+	ObjectKind string  `json:"object_kind"`
+	User       User    `json:"user"`
+	Project    Project `json:"project"`
+	Wiki       struct {
+		WebURL            string `json:"web_url"`
+		GitSSHURL         string `json:"git_ssh_url"`
+		GitHTTPURL        string `json:"git_http_url"`
+		PathWithNamespace string `json:"path_with_namespace"`
+		DefaultBranch     string `json:"default_branch"`
+	} `json:"wiki"`
+	ObjectAttributes struct {
+		Title   string `json:"title"`
+		Content string `json:"content"`
+		Format  string `json:"format"`
+		Message string `json:"message"`
+		Slug    string `json:"slug"`
+		URL     string `json:"url"`
+		Action  string `json:"action"`
+	} `json:"object_attributes"`
+}
+
+// DeploymentWebhook is the data structure that GitLab provides us
+// in the deployment webhook. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#deployment-events
+type DeploymentWebhook struct {
+	ObjectKind    string  `json:"object_kind"`
+	Status        string  `json:"status"`
+	DeployableID  int64   `json:"deployable_id"`
+	DeployableURL string  `json:"deployable_url"`
+	Environment   string  `json:"environment"`
+	Project       Project `json:"project"`
+	ShortSHA      string  `json:"short_sha"`
+	User          User    `json:"user"`
+	UserURL       string  `json:"user_url"`
+	CommitURL     string  `json:"commit_url"`
+	CommitTitle   string  `json:"commit_title"`
+}
+
+// ReleaseWebhook is the data structure that GitLab provides us
+// in the release webhook. See:
+// https://docs.gitlab.com/ce/user/project/integrations/webhooks.html#release-events
+type ReleaseWebhook struct {
+	ObjectKind  string  `json:"object_kind"`
+	ID          int64   `json:"id"`
+	Name        string  `json:"name"`
+	Tag         string  `json:"tag"`
+	Description string  `json:"description"`
+	URL         string  `json:"url"`
+	Action      string  `json:"action"`
+	CreatedAt   string  `json:"created_at"`
+	ReleasedAt  string  `json:"released_at"`
+	Project     Project `json:"project"`
+	Commit      Commit  `json:"commit"`
+	Assets      struct {
+		Count int `json:"count"`
+		Links []struct {
+			ID       int64  `json:"id"`
+			External bool   `json:"external"`
+			LinkType string `json:"link_type"`
+			Name     string `json:"name"`
+			URL      string `json:"url"`
+		} `json:"links"`
+		Sources []struct {
+			Format string `json:"format"`
+			URL    string `json:"url"`
+		} `json:"sources"`
+	} `json:"assets"`
+}
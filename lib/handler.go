@@ -0,0 +1,287 @@
+package mrgitlab
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// defaultHandlerTimeout is the max amount of time a handler may run
+// for, unless another timeout is given using WithTimeout.
+const defaultHandlerTimeout = 2 * time.Minute
+
+// HandlerOption is an option for configuring how a registered handler
+// is run.
+type HandlerOption func(*handlerOptions)
+
+// handlerOptions are the options a handler was registered with.
+type handlerOptions struct {
+	// name is the name of the handler, used when logging and
+	// counting handler failures.
+	name string
+	// errorFooter specifies if a footer describing the error of
+	// the handler should be added to the note if the handler fails.
+	errorFooter bool
+	// timeout is the max amount of time the handler may run for.
+	timeout time.Duration
+	// projects are the paths of the projects the handler is run for.
+	// The handler is run for all projects if empty.
+	projects []string
+	// branches are the patterns of the branches the handler is run
+	// for. The handler is run for all branches if empty.
+	branches []string
+}
+
+// matches returns true if the handler should be run for a webhook of
+// the project with the given path, and the given branch.
+func (options handlerOptions) matches(projectPath string, branch string) bool {
+	if len(options.projects) > 0 && !containsString(options.projects, projectPath) {
+		return false
+	}
+	if len(options.branches) == 0 {
+		return true
+	}
+	for _, pattern := range options.branches {
+		if ok, _ := path.Match(pattern, branch); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// containsString returns true if the str is one of the strs.
+func containsString(strs []string, str string) bool {
+	for _, s := range strs {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
+
+// newHandlerOptions returns the handlerOptions for a handler registered
+// with the given opts. The name of the handler defaults to the type of
+// the handler, and the timeout to the defaultHandlerTimeout.
+func newHandlerOptions(handler interface{}, opts []HandlerOption) handlerOptions {
+	options := handlerOptions{
+		name:    fmt.Sprintf("%T", handler),
+		timeout: defaultHandlerTimeout,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// WithName sets the name of a handler, used for identifying the handler
+// when logging and counting handler failures.
+func WithName(name string) HandlerOption {
+	return func(options *handlerOptions) {
+		options.name = name
+	}
+}
+
+// WithErrorFooter makes a failure of a handler be reported as a footer
+// in the note added to the merge request, instead of only being logged.
+func WithErrorFooter() HandlerOption {
+	return func(options *handlerOptions) {
+		options.errorFooter = true
+	}
+}
+
+// WithTimeout sets the max amount of time a handler may run for. If the
+// handler has not completed within the timeout, its context is cancelled
+// and it is reported as failed. The messages of the other handlers are
+// posted without waiting any further for the handler.
+func WithTimeout(timeout time.Duration) HandlerOption {
+	return func(options *handlerOptions) {
+		options.timeout = timeout
+	}
+}
+
+// WithProjects limits a handler to only be run for webhooks of the
+// projects with the given paths, e.g. "group/project". Only applies to
+// merge request and pipeline handlers.
+func WithProjects(projectPaths ...string) HandlerOption {
+	return func(options *handlerOptions) {
+		options.projects = projectPaths
+	}
+}
+
+// WithBranches limits a handler to only be run for webhooks of branches
+// matching any of the given patterns. The patterns use the syntax of
+// path.Match, e.g. "feature/*". For merge requests the source branch is
+// matched, and for pipelines the ref of the pipeline.
+func WithBranches(patterns ...string) HandlerOption {
+	return func(options *handlerOptions) {
+		options.branches = patterns
+	}
+}
+
+// messageFunc is a function producing a message that is to be included
+// in a note, typically by calling a handler.
+type messageFunc func(context.Context) (string, error)
+
+// noteHandler is a messageFunc together with the options of the handler
+// it calls.
+type noteHandler struct {
+	handle  messageFunc
+	options handlerOptions
+}
+
+// handlerErrors is the errors of the handlers that failed while handling
+// a single webhook.
+type handlerErrors []error
+
+// Error implements the error interface
+func (errs handlerErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d handler(s) failed: %s", len(errs), strings.Join(msgs, "; "))
+}
+
+// Temporary returns true if any of the handler errors are transient, so
+// that handling of the webhook is retried.
+func (errs handlerErrors) Temporary() bool {
+	for _, err := range errs {
+		if isTransient(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// handlerFailureCounter counts the failures of handlers, by handler name.
+type handlerFailureCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// inc increments the failure count of the named handler.
+func (c *handlerFailureCounter) inc(name string) {
+	c.mu.Lock()
+	if c.counts == nil {
+		c.counts = make(map[string]int64)
+	}
+	c.counts[name]++
+	c.mu.Unlock()
+}
+
+// snapshot returns a copy of the current failure counts.
+func (c *handlerFailureCounter) snapshot() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for name, count := range c.counts {
+		counts[name] = count
+	}
+	return counts
+}
+
+// HandlerFailures returns the number of times each handler has failed,
+// keyed by the name of the handler.
+func (app *App) HandlerFailures() map[string]int64 {
+	return app.handlerFailures.snapshot()
+}
+
+// handlerResult is the result of calling a single handler.
+type handlerResult struct {
+	msg string
+	err error
+}
+
+// collectMessages calls each of the handlers on a separate go-routine, waits
+// for them all to complete and combines their messages, in the order of the
+// handlers. Each handler is given a context with the timeout of its options,
+// and is considered failed if it has not completed once the timeout expires.
+// A failing handler does not prevent the messages of the other handlers from
+// being included. Each failure is logged and counted, and, if the handler has
+// the errorFooter option, described in a footer added to the message. If any
+// of the handlers failed, a handlerErrors is returned together with the message.
+// The final results of the handlers, i.e. all but transient failures, are
+// recorded in the progress, if non-nil, and handlers with a recorded result
+// are not called again, their recorded result being used instead.
+func (app *App) collectMessages(ctx context.Context, progress *jobProgress, handlers []noteHandler) (string, error) {
+	// Fan-out, let each handler do its thing on a separate go-routine
+	type runningHandler struct {
+		ctx      context.Context
+		resultCh chan handlerResult
+		// recorded is true if the result was recorded by an
+		// earlier attempt, and the handler was not called.
+		recorded bool
+	}
+	var running []runningHandler
+	for i, handler := range handlers {
+		handlerCtx, cancel := context.WithTimeout(ctx, handler.options.timeout)
+		defer cancel()
+		resultCh := make(chan handlerResult, 1)
+		if res, ok := progress.result(i, handler.options.name); ok {
+			resultCh <- res
+			running = append(running, runningHandler{handlerCtx, resultCh, true})
+			continue
+		}
+		go func(handle messageFunc) {
+			msg, err := handle(handlerCtx)
+			resultCh <- handlerResult{msg, err}
+		}(handler.handle)
+		running = append(running, runningHandler{handlerCtx, resultCh, false})
+	}
+	// Fan-in, wait for each handler to complete (in order) and
+	// combine their messages. We do not wait for handlers past
+	// their deadline, as they might not respect the cancellation.
+	var messageBuf, footerBuf bytes.Buffer
+	var errs handlerErrors
+	for i, r := range running {
+		options := handlers[i].options
+		var res handlerResult
+		select {
+		case res = <-r.resultCh:
+		case <-r.ctx.Done():
+			// Prefer the result, should the handler have
+			// completed at the same time as the deadline
+			select {
+			case res = <-r.resultCh:
+			default:
+				res.err = r.ctx.Err()
+			}
+		}
+		if res.err != nil && !r.recorded && r.ctx.Err() == context.DeadlineExceeded {
+			res.err = errors.Wrapf(res.err, "timed out after %s", options.timeout)
+		}
+		if !r.recorded && (res.err == nil || !isTransient(res.err)) {
+			progress.record(i, options.name, res)
+		}
+		if res.err != nil {
+			if !r.recorded {
+				app.logger.Errorf("Handler '%s' failed: %v", options.name, res.err)
+				app.logger.Debugf("%+v", res.err)
+				app.handlerFailures.inc(options.name)
+			}
+			errs = append(errs, res.err)
+			if options.errorFooter {
+				fmt.Fprintf(&footerBuf, "_%s failed: `%v`_\n", options.name, res.err)
+			}
+			continue
+		}
+		if len(res.msg) > 0 {
+			messageBuf.WriteString(res.msg)
+			messageBuf.WriteByte('\n')
+		}
+	}
+	if footerBuf.Len() > 0 {
+		messageBuf.WriteString("\n---\n")
+		messageBuf.Write(footerBuf.Bytes())
+	}
+	if len(errs) > 0 {
+		return messageBuf.String(), errs
+	}
+	return messageBuf.String(), nil
+}
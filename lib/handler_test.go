@@ -0,0 +1,129 @@
+package mrgitlab
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// newTestNoteHandler returns a noteHandler with the given name, returning
+// the given message and error.
+func newTestNoteHandler(name string, msg string, err error, opts ...HandlerOption) noteHandler {
+	return noteHandler{
+		handle: func(context.Context) (string, error) {
+			return msg, err
+		},
+		options: newHandlerOptions(nil, append([]HandlerOption{WithName(name)}, opts...)),
+	}
+}
+
+// Test that a failing handler does not prevent the messages of the other
+// handlers from being collected, and that the failure is counted.
+func TestCollectMessages_IsolatesFailures(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	handlers := []noteHandler{
+		newTestNoteHandler("first", "first message", nil),
+		newTestNoteHandler("failing", "", errors.New("failure")),
+		newTestNoteHandler("last", "last message", nil),
+	}
+	msg, err := app.collectMessages(context.Background(), nil, handlers)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	if msg != "first message\nlast message\n" {
+		t.Errorf("unexpected message: '%s'", msg)
+	}
+	if strings.Contains(msg, "failure") {
+		t.Errorf("expected no error footer, was: '%s'", msg)
+	}
+	if count := app.HandlerFailures()["failing"]; count != 1 {
+		t.Errorf("expected failure count 1, was: %d", count)
+	}
+}
+
+func TestCollectMessages_ErrorFooter(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	handlers := []noteHandler{
+		newTestNoteHandler("failing", "", errors.New("failure"), WithErrorFooter()),
+		newTestNoteHandler("last", "last message", nil),
+	}
+	msg, _ := app.collectMessages(context.Background(), nil, handlers)
+	if !strings.HasPrefix(msg, "last message\n") {
+		t.Errorf("expected message to start with the successful message, was: '%s'", msg)
+	}
+	if !strings.Contains(msg, "failing failed: `failure`") {
+		t.Errorf("expected message to contain error footer, was: '%s'", msg)
+	}
+}
+
+// Test that a handler not completing within its timeout is reported as
+// failed, without delaying the messages of the other handlers.
+func TestCollectMessages_Timeout(t *testing.T) {
+	app, cleanup := newTestApp(t)
+	defer cleanup()
+	blockCh := make(chan struct{})
+	defer close(blockCh)
+	slowHandler := noteHandler{
+		handle: func(context.Context) (string, error) {
+			// Ignores the context, like a handler stuck in a call
+			<-blockCh
+			return "slow message", nil
+		},
+		options: newHandlerOptions(nil, []HandlerOption{WithName("slow"), WithTimeout(10 * time.Millisecond)}),
+	}
+	handlers := []noteHandler{
+		slowHandler,
+		newTestNoteHandler("last", "last message", nil),
+	}
+	msg, err := app.collectMessages(context.Background(), nil, handlers)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("expected a timed out error, got: %+v", err)
+	}
+	if msg != "last message\n" {
+		t.Errorf("unexpected message: '%s'", msg)
+	}
+	if count := app.HandlerFailures()["slow"]; count != 1 {
+		t.Errorf("expected failure count 1, was: %d", count)
+	}
+}
+
+func TestHandlerErrorsTemporary(t *testing.T) {
+	errs := handlerErrors{errors.New("permanent")}
+	if isTransient(errs) {
+		t.Error("expected only permanent errors to not be transient")
+	}
+	errs = append(errs, errors.Wrap(temporaryError(true), "temporary"))
+	if !isTransient(errs) {
+		t.Error("expected errors with a temporary error to be transient")
+	}
+}
+
+func TestHandlerOptionsMatches(t *testing.T) {
+	tests := []struct {
+		opts        []HandlerOption
+		projectPath string
+		branch      string
+		expected    bool
+	}{
+		{nil, "group/project", "master", true},
+		{[]HandlerOption{WithProjects("group/project")}, "group/project", "master", true},
+		{[]HandlerOption{WithProjects("group/other")}, "group/project", "master", false},
+		{[]HandlerOption{WithBranches("feature/*")}, "group/project", "feature/abc123", true},
+		{[]HandlerOption{WithBranches("feature/*")}, "group/project", "master", false},
+		{[]HandlerOption{WithBranches("feature/*", "master")}, "group/project", "master", true},
+		{[]HandlerOption{WithProjects("group/other"), WithBranches("master")}, "group/project", "master", false},
+	}
+	for _, test := range tests {
+		options := newHandlerOptions(nil, test.opts)
+		actual := options.matches(test.projectPath, test.branch)
+		if actual != test.expected {
+			t.Errorf("expected %t for project '%s' and branch '%s', got: %t",
+				test.expected, test.projectPath, test.branch, actual)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// gitLabIssuesClient is an interface abstracting the GitLab client used for
+// the API calls of the GitLab issue tracker, so that we can do unit tests
+// against a non-network implementation.
+type gitLabIssuesClient interface {
+	GetIssue(ctx context.Context, projectID int64, iid int64) (*gitlab.Issue, error)
+	AddIssueNote(ctx context.Context, projectID int64, iid int64, note *gitlab.Note) error
+	SetIssueState(ctx context.Context, projectID int64, iid int64, stateEvent string) error
+}
+
+// gitLabTracker is the IssueTracker of the GitLab issues of a project.
+type gitLabTracker struct {
+	client  gitLabIssuesClient
+	project *gitlab.Project
+}
+
+// NewGitLabTracker creates an IssueTracker for the GitLab issues of the
+// project. The issues are identified by their project-specific iid, with
+// or without a leading "#", e.g. "#12". Issues are transitioned using the
+// state events "close" and "reopen".
+func NewGitLabTracker(client gitLabIssuesClient, project *gitlab.Project) IssueTracker {
+	if client == nil || project == nil {
+		panic("client and project must not be nil")
+	}
+	return &gitLabTracker{client: client, project: project}
+}
+
+// GetIssue implements the IssueTracker interface.
+func (t *gitLabTracker) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
+	iid, err := parseNumericIssueID(issueID)
+	if err != nil {
+		// Not an error, the issue id just does not look like an iid
+		return nil, nil
+	}
+	issue, err := t.client.GetIssue(ctx, t.project.ID, iid)
+	if err != nil {
+		if gitlab.IsHTTPStatusError(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := &Issue{
+		ID:          fmt.Sprintf("#%d", issue.IID),
+		Summary:     issue.Title,
+		Description: issue.Description,
+		State:       issue.State,
+	}
+	if len(issue.Assignees) > 0 {
+		result.Assignee = issue.Assignees[0].Name
+	}
+	return result, nil
+}
+
+// GetIssueURL implements the IssueTracker interface.
+func (t *gitLabTracker) GetIssueURL(ctx context.Context, issueID string) (*url.URL, error) {
+	iid, err := parseNumericIssueID(issueID)
+	if err != nil {
+		return nil, err
+	}
+	rawURL := fmt.Sprintf("%s/-/issues/%d", strings.TrimSuffix(t.project.WebURL, "/"), iid)
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not parse issue URL: %s", rawURL)
+	}
+	return u, nil
+}
+
+// AddComment implements the IssueTracker interface.
+func (t *gitLabTracker) AddComment(ctx context.Context, issueID string, text string) error {
+	iid, err := parseNumericIssueID(issueID)
+	if err != nil {
+		return err
+	}
+	return t.client.AddIssueNote(ctx, t.project.ID, iid, &gitlab.Note{Body: text})
+}
+
+// TransitionIssue implements the IssueTracker interface, where the
+// transition is the state event "close" or "reopen".
+func (t *gitLabTracker) TransitionIssue(ctx context.Context, issueID string, transition string) error {
+	if transition != "close" && transition != "reopen" {
+		return errors.Errorf("unknown transition '%s', expected 'close' or 'reopen'", transition)
+	}
+	iid, err := parseNumericIssueID(issueID)
+	if err != nil {
+		return err
+	}
+	return t.client.SetIssueState(ctx, t.project.ID, iid, transition)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// mock implementation of the gitLabIssuesClient interface.
+type mockGitLabIssuesClient struct {
+	issues      map[int64]*gitlab.Issue
+	stateEvents []string
+}
+
+func (c *mockGitLabIssuesClient) GetIssue(ctx context.Context, projectID int64, iid int64) (*gitlab.Issue, error) {
+	return c.issues[iid], nil
+}
+
+func (c *mockGitLabIssuesClient) AddIssueNote(ctx context.Context, projectID int64, iid int64, note *gitlab.Note) error {
+	return nil
+}
+
+func (c *mockGitLabIssuesClient) SetIssueState(ctx context.Context, projectID int64, iid int64, stateEvent string) error {
+	c.stateEvents = append(c.stateEvents, stateEvent)
+	return nil
+}
+
+func TestGitLabTracker(t *testing.T) {
+	client := &mockGitLabIssuesClient{issues: map[int64]*gitlab.Issue{
+		12: {IID: 12, Title: "Crash", State: "opened", Assignees: []gitlab.User{{Name: "Jane Doe"}}},
+	}}
+	project := &gitlab.Project{ID: 1, WebURL: "https://gitlab.example.com/group/project"}
+	tracker := NewGitLabTracker(client, project)
+
+	issue, err := tracker.GetIssue(context.Background(), "#12")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expected := Issue{ID: "#12", Summary: "Crash", State: "opened", Assignee: "Jane Doe"}
+	if issue == nil || *issue != expected {
+		t.Errorf("Expected issue %+v, was %+v", expected, issue)
+	}
+	if issue, err := tracker.GetIssue(context.Background(), "ABC-12"); issue != nil || err != nil {
+		t.Errorf("Expected no issue and no error for a non-iid, was %+v, %v", issue, err)
+	}
+
+	u, err := tracker.GetIssueURL(context.Background(), "12")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if u.String() != "https://gitlab.example.com/group/project/-/issues/12" {
+		t.Errorf("Unexpected issue URL: %s", u)
+	}
+
+	if err := tracker.TransitionIssue(context.Background(), "#12", "close"); err != nil {
+		t.Errorf("Unexpected error: %+v", err)
+	}
+	if err := tracker.TransitionIssue(context.Background(), "#12", "Done"); err == nil {
+		t.Error("Expected an error for an unknown transition")
+	}
+	if len(client.stateEvents) != 1 || client.stateEvents[0] != "close" {
+		t.Errorf("Unexpected state events: %v", client.stateEvents)
+	}
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// The sources of a merge request that issue keys can be extracted from.
+const (
+	// IssueKeySourceBranch is the source branch of the merge request.
+	IssueKeySourceBranch = "branch"
+	// IssueKeySourceTitle is the title of the merge request.
+	IssueKeySourceTitle = "title"
+	// IssueKeySourceDescription is the description of the merge request.
+	IssueKeySourceDescription = "description"
+	// IssueKeySourceCommits are the messages of the commits of the merge
+	// request, oldest first.
+	IssueKeySourceCommits = "commits"
+)
+
+// issueKeySources are the valid issue key sources, in the order they are
+// searched for issue keys.
+var issueKeySources = []string{
+	IssueKeySourceBranch,
+	IssueKeySourceTitle,
+	IssueKeySourceDescription,
+	IssueKeySourceCommits,
+}
+
+// IsIssueKeySource returns true if source is a valid issue key source.
+func IsIssueKeySource(source string) bool {
+	return containsSource(issueKeySources, source)
+}
+
+// IssueKeyPattern is a pattern for finding issue keys in some of the
+// sources of a merge request.
+type IssueKeyPattern struct {
+	// Regexp matches the issue keys.
+	Regexp *regexp.Regexp
+	// Template is the template for creating an issue key from a match
+	// of the Regexp, as expanded by regexp.Expand, e.g. "$1-$2". The
+	// whole match is used as the issue key if empty.
+	Template string
+	// Sources are the sources of the merge request, e.g. "branch" or
+	// "title", that the pattern is applied to.
+	Sources []string
+}
+
+// mergeRequestCommitsClient is an interface abstracting the GitLab client
+// used for listing the commits of merge requests, so that we can do unit
+// tests against a non-network implementation.
+type mergeRequestCommitsClient interface {
+	ListMergeRequestCommits(ctx context.Context, mergeRequestID gitlab.MergeRequestID) ([]*gitlab.Commit, error)
+}
+
+// IssueKeyExtractor extracts the issue keys referenced by a merge request,
+// using a list of IssueKeyPatterns.
+type IssueKeyExtractor struct {
+	client   mergeRequestCommitsClient
+	patterns []IssueKeyPattern
+}
+
+// NewIssueKeyExtractor creates a new IssueKeyExtractor, finding issue keys
+// matching any of the given patterns. The client is used for listing the
+// commits of the merge request, if any pattern has the "commits" source.
+// If the client is nil, only the last commit, which is the only commit
+// included in merge request webhooks, is searched.
+func NewIssueKeyExtractor(client mergeRequestCommitsClient, patterns ...IssueKeyPattern) *IssueKeyExtractor {
+	return &IssueKeyExtractor{client: client, patterns: patterns}
+}
+
+// issueKeyMatch is an issue key found at an index of a source.
+type issueKeyMatch struct {
+	index int
+	key   string
+}
+
+// Extract returns the issue keys found in the merge request of the webhook.
+// The keys are upper-cased and deduplicated, and ordered by the source they
+// were found in (branch, title, description, commits) and then by their
+// position within the source. An error is returned if the commits of the
+// merge request could not be listed.
+func (e *IssueKeyExtractor) Extract(ctx context.Context, webhook *gitlab.MergeRequestWebhook) ([]string, error) {
+	if webhook == nil {
+		return nil, nil
+	}
+	attrs := webhook.ObjectAttributes
+	commitsText, err := e.commitsText(ctx, webhook)
+	if err != nil {
+		return nil, err
+	}
+	sourceTexts := map[string]string{
+		IssueKeySourceBranch:      attrs.SourceBranch,
+		IssueKeySourceTitle:       attrs.Title,
+		IssueKeySourceDescription: attrs.Description,
+		IssueKeySourceCommits:     commitsText,
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, source := range issueKeySources {
+		text := sourceTexts[source]
+		if text == "" {
+			continue
+		}
+		var matches []issueKeyMatch
+		for _, pattern := range e.patterns {
+			if !containsSource(pattern.Sources, source) {
+				continue
+			}
+			matches = append(matches, pattern.find(text)...)
+		}
+		sort.SliceStable(matches, func(i, j int) bool { return matches[i].index < matches[j].index })
+		for _, match := range matches {
+			if !seen[match.key] {
+				seen[match.key] = true
+				keys = append(keys, match.key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+// commitsText returns the messages of the commits of the merge request,
+// oldest first, or an empty string if no pattern has the "commits" source.
+func (e *IssueKeyExtractor) commitsText(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
+	searched := false
+	for _, pattern := range e.patterns {
+		if containsSource(pattern.Sources, IssueKeySourceCommits) {
+			searched = true
+			break
+		}
+	}
+	if !searched {
+		return "", nil
+	}
+	if e.client == nil {
+		return webhook.ObjectAttributes.LastCommit.Message, nil
+	}
+	commits, err := e.client.ListMergeRequestCommits(ctx, gitlab.NewMergeRequestID(webhook))
+	if err != nil {
+		return "", errors.Wrap(err, "could not list merge request commits")
+	}
+	// The commits are listed newest first
+	messages := make([]string, len(commits))
+	for i, commit := range commits {
+		messages[len(commits)-1-i] = commit.Message
+	}
+	return strings.Join(messages, "\n"), nil
+}
+
+// find returns the issue keys matching the pattern in the text.
+func (pattern *IssueKeyPattern) find(text string) []issueKeyMatch {
+	var matches []issueKeyMatch
+	for _, submatch := range pattern.Regexp.FindAllStringSubmatchIndex(text, -1) {
+		var key string
+		if pattern.Template == "" {
+			key = text[submatch[0]:submatch[1]]
+		} else {
+			key = string(pattern.Regexp.ExpandString(nil, pattern.Template, text, submatch))
+		}
+		if key == "" {
+			continue
+		}
+		matches = append(matches, issueKeyMatch{submatch[0], strings.ToUpper(key)})
+	}
+	return matches
+}
+
+// containsSource returns true if source is one of the sources.
+func containsSource(sources []string, source string) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
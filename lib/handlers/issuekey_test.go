@@ -0,0 +1,133 @@
+package handlers
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+func TestIssueKeyExtractor(t *testing.T) {
+	extractor := NewIssueKeyExtractor(nil,
+		IssueKeyPattern{
+			Regexp:   regexp.MustCompile(`(?i)^(?:feature|release-fix)/([a-z]+)([0-9]+)`),
+			Template: "$1-$2",
+			Sources:  []string{IssueKeySourceBranch},
+		},
+		IssueKeyPattern{
+			Regexp:  regexp.MustCompile(`(?i)\b[a-z][a-z0-9]+-[0-9]+\b`),
+			Sources: []string{IssueKeySourceTitle, IssueKeySourceCommits},
+		},
+	)
+	tests := []struct {
+		branch       string
+		title        string
+		description  string
+		commit       string
+		expectedKeys []string
+	}{
+		{"master", "Some title", "", "", nil},
+		{"feature/xyz982_some_feature", "Some title", "", "", []string{"XYZ-982"}},
+		{"master", "XYZ-982: Some title", "", "", []string{"XYZ-982"}},
+		{"master", "Fix abc-1 and XYZ-982", "", "", []string{"ABC-1", "XYZ-982"}},
+		{"feature/xyz982", "XYZ-982: Some title", "", "Fixes ABC-1", []string{"XYZ-982", "ABC-1"}},
+		{"master", "Some title", "XYZ-982 is not searched", "", nil},
+		{"master", "Some title", "", "Refs XYZ-982, XYZ-982 and ABC-1", []string{"XYZ-982", "ABC-1"}},
+		{"feature/some_xyz982", "XYZ982", "", "", nil},
+	}
+	for _, test := range tests {
+		webhook := &gitlab.MergeRequestWebhook{}
+		webhook.ObjectAttributes.SourceBranch = test.branch
+		webhook.ObjectAttributes.Title = test.title
+		webhook.ObjectAttributes.Description = test.description
+		webhook.ObjectAttributes.LastCommit.Message = test.commit
+		keys, err := extractor.Extract(context.Background(), webhook)
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if !reflect.DeepEqual(keys, test.expectedKeys) {
+			t.Errorf("expected keys %v for %+v, got: %v", test.expectedKeys, test, keys)
+		}
+	}
+}
+
+// Test that keys matched by multiple patterns in the same source
+// are ordered by their position in the source.
+func TestIssueKeyExtractor_OrdersByPosition(t *testing.T) {
+	extractor := NewIssueKeyExtractor(nil,
+		IssueKeyPattern{
+			Regexp:  regexp.MustCompile(`#([0-9]+)`),
+			Sources: []string{IssueKeySourceTitle},
+		},
+		IssueKeyPattern{
+			Regexp:  regexp.MustCompile(`[A-Z]+-[0-9]+`),
+			Sources: []string{IssueKeySourceTitle},
+		},
+	)
+	webhook := &gitlab.MergeRequestWebhook{}
+	webhook.ObjectAttributes.Title = "ABC-1, #2 and DEF-3"
+	keys, err := extractor.Extract(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	expected := []string{"ABC-1", "#2", "DEF-3"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got: %v", expected, keys)
+	}
+}
+
+type mockMergeRequestCommitsClient struct {
+	ListMergeRequestCommitsFunc func(ctx context.Context, mergeRequestID gitlab.MergeRequestID) ([]*gitlab.Commit, error)
+}
+
+func (c *mockMergeRequestCommitsClient) ListMergeRequestCommits(ctx context.Context, mergeRequestID gitlab.MergeRequestID) ([]*gitlab.Commit, error) {
+	return c.ListMergeRequestCommitsFunc(ctx, mergeRequestID)
+}
+
+// Test that the messages of all commits of the merge request are searched,
+// oldest first, when the extractor has a client.
+func TestIssueKeyExtractor_ListsCommits(t *testing.T) {
+	client := &mockMergeRequestCommitsClient{}
+	client.ListMergeRequestCommitsFunc = func(ctx context.Context, mergeRequestID gitlab.MergeRequestID) ([]*gitlab.Commit, error) {
+		if mergeRequestID.ProjectID != 14 || mergeRequestID.IID != 1 {
+			t.Errorf("unexpected merge request id: %+v", mergeRequestID)
+		}
+		return []*gitlab.Commit{{Message: "Refs DEF-3"}, {Message: "Refs ABC-1"}}, nil
+	}
+	extractor := NewIssueKeyExtractor(client, IssueKeyPattern{
+		Regexp:  regexp.MustCompile(`[A-Z]+-[0-9]+`),
+		Sources: []string{IssueKeySourceCommits},
+	})
+	webhook := &gitlab.MergeRequestWebhook{}
+	webhook.ObjectAttributes.TargetProjectID = 14
+	webhook.ObjectAttributes.IID = 1
+	webhook.ObjectAttributes.LastCommit.Message = "Refs DEF-3"
+	keys, err := extractor.Extract(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	expected := []string{"ABC-1", "DEF-3"}
+	if !reflect.DeepEqual(keys, expected) {
+		t.Errorf("expected keys %v, got: %v", expected, keys)
+	}
+}
+
+// Test that the commits are not listed if no pattern searches them.
+func TestIssueKeyExtractor_OnlyListsCommitsIfSearched(t *testing.T) {
+	client := &mockMergeRequestCommitsClient{}
+	client.ListMergeRequestCommitsFunc = func(context.Context, gitlab.MergeRequestID) ([]*gitlab.Commit, error) {
+		t.Error("expected commits not to be listed")
+		return nil, nil
+	}
+	extractor := NewIssueKeyExtractor(client, IssueKeyPattern{
+		Regexp:  regexp.MustCompile(`[A-Z]+-[0-9]+`),
+		Sources: []string{IssueKeySourceTitle},
+	})
+	webhook := &gitlab.MergeRequestWebhook{}
+	webhook.ObjectAttributes.Title = "ABC-1"
+	if _, err := extractor.Extract(context.Background(), webhook); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+}
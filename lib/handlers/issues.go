@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// maxConcurrentIssueFetches is the max number of issues that are
+// fetched concurrently for a single merge request.
+const maxConcurrentIssueFetches = 4
+
+// issueTableThreshold is the number of issues at which the issues are
+// rendered as a table, instead of as one section per issue.
+const issueTableThreshold = 4
+
+// noteIssue is the data of an issue, of any issue tracker, included in
+// a message.
+type noteIssue struct {
+	ID          string
+	URL         *url.URL
+	Summary     string
+	Description string
+	State       string
+	// Assignee is the name of the assignee, or empty if unassigned.
+	Assignee string
+	// ParentID is the id of the parent issue, or empty if the issue
+	// is not a subtask.
+	ParentID  string
+	ParentURL *url.URL
+}
+
+// fetchIssueFunc fetches the issue identified by issueID, or returns nil
+// if no such issue exists.
+type fetchIssueFunc func(ctx context.Context, issueID string) (*noteIssue, error)
+
+// fetchIssues fetches the issues identified by the issueIDs using fetch, at
+// most maxConcurrentIssueFetches at a time. The issues are returned in the
+// order of the issueIDs, skipping issues that do not exist. If fetching any
+// of the issues fails, the fetches still running are cancelled and the
+// error is returned.
+func fetchIssues(ctx context.Context, issueIDs []string, fetch fetchIssueFunc) ([]*noteIssue, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make([]*noteIssue, len(issueIDs))
+	errCh := make(chan error, len(issueIDs))
+	semaphore := make(chan struct{}, maxConcurrentIssueFetches)
+	var wg sync.WaitGroup
+	for i, issueID := range issueIDs {
+		wg.Add(1)
+		go func(i int, issueID string) {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				errCh <- ctx.Err()
+				return
+			}
+			issue, err := fetch(ctx, issueID)
+			if err != nil {
+				errCh <- err
+				cancel()
+				return
+			}
+			results[i] = issue
+		}(i, issueID)
+	}
+	wg.Wait()
+	close(errCh)
+	// The first error is the cause of any cancellation errors following it
+	if err := <-errCh; err != nil {
+		return nil, err
+	}
+	var issues []*noteIssue
+	for _, issue := range results {
+		if issue != nil {
+			issues = append(issues, issue)
+		}
+	}
+	return issues, nil
+}
+
+// issuesMessage renders the issues as the message of a note, as a table if
+// there are at least issueTableThreshold issues, or else as one section per
+// issue. The descriptions of the issues are truncated to at most
+// maxDescriptionLength characters, unless maxDescriptionLength is zero.
+func issuesMessage(issues []*noteIssue, maxDescriptionLength int) string {
+	if len(issues) >= issueTableThreshold {
+		return issuesTable(issues)
+	}
+	var buf bytes.Buffer
+	for _, issue := range issues {
+		issue.Description = truncateMarkdown(issue.Description, maxDescriptionLength, issue.URL)
+		buf.WriteString(issueSection(issue))
+	}
+	return buf.String()
+}
+
+// issueSection renders the issue as a section, with the summary as the
+// heading followed by the URL, the details of the issue and the quoted
+// description.
+func issueSection(issue *noteIssue) string {
+	issueTitle := issue.ID + ": " + issue.Summary
+	details := issueDetails(issue)
+	if details != "" {
+		details += "\n\n"
+	}
+	return fmt.Sprintf(""+
+		"# %s\n"+
+		"%s\n\n"+
+		"%s"+
+		"%s\n",
+		issueTitle, issue.URL, details, markdownQuote(issue.Description))
+}
+
+// issueDetails renders the state, assignee and parent issue of the issue
+// on a single line, leaving out those the issue does not have.
+func issueDetails(issue *noteIssue) string {
+	var details []string
+	if issue.State != "" {
+		details = append(details, "**State:** "+issue.State)
+	}
+	if issue.Assignee != "" {
+		details = append(details, "**Assignee:** "+issue.Assignee)
+	}
+	if issue.ParentID != "" {
+		details = append(details, fmt.Sprintf("**Parent:** [%s](%s)", issue.ParentID, issue.ParentURL))
+	}
+	return strings.Join(details, " · ")
+}
+
+// tableCellReplacer escapes the pipes and collapses the line breaks of the
+// text of a table cell, both of which would otherwise break the table row.
+var tableCellReplacer = strings.NewReplacer("|", "\\|", "\r\n", " ", "\r", " ", "\n", " ")
+
+// issuesTable renders the issues as a table of linked ids and summaries.
+// The descriptions are left out to keep the table compact.
+func issuesTable(issues []*noteIssue) string {
+	var buf bytes.Buffer
+	buf.WriteString("| Issue | Summary |\n")
+	buf.WriteString("|-------|---------|\n")
+	for _, issue := range issues {
+		fmt.Fprintf(&buf, "| [%s](%s) | %s |\n", issue.ID, issue.URL, tableCellReplacer.Replace(issue.Summary))
+	}
+	return buf.String()
+}
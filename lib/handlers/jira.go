@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/jira"
+)
+
+// jiraClient is an interface abstracting the Jira client used for API calls,
+// so that we can do unit tests against a non-network implementation.
+type jiraClient interface {
+	GetIssue(ctx context.Context, issueKey string) (*jira.Issue, error)
+	GetIssueURL(ctx context.Context, issueKey string) (*url.URL, error)
+	AddComment(ctx context.Context, issueKey string, text string) error
+	TransitionIssue(ctx context.Context, issueKey string, name string) error
+}
+
+// jiraTracker is the IssueTracker of a jiraClient.
+type jiraTracker struct {
+	client jiraClient
+}
+
+// NewJiraTracker creates an IssueTracker for the issues of the Jira server
+// of the client. Issues are transitioned using the available transition, or
+// to the status, with the name of the transition.
+func NewJiraTracker(client jiraClient) IssueTracker {
+	if client == nil {
+		panic("client must not be nil")
+	}
+	return &jiraTracker{client: client}
+}
+
+// GetIssue implements the IssueTracker interface.
+func (t *jiraTracker) GetIssue(ctx context.Context, issueKey string) (*Issue, error) {
+	issue, err := t.client.GetIssue(ctx, issueKey)
+	if err != nil {
+		if jira.IsHTTPStatusError(err, http.StatusNotFound) {
+			// Not an error, the issue key just looked like a Jira key
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := &Issue{
+		ID:          issue.Key,
+		Summary:     issue.Summary,
+		Description: convertJiraWiki(issue.Description),
+		State:       issue.Status,
+		Parent:      issue.Parent,
+	}
+	if issue.Assignee != nil {
+		result.Assignee = issue.Assignee.DisplayName
+	}
+	return result, nil
+}
+
+// GetIssueURL implements the IssueTracker interface.
+func (t *jiraTracker) GetIssueURL(ctx context.Context, issueKey string) (*url.URL, error) {
+	return t.client.GetIssueURL(ctx, issueKey)
+}
+
+// AddComment implements the IssueTracker interface.
+func (t *jiraTracker) AddComment(ctx context.Context, issueKey string, text string) error {
+	return t.client.AddComment(ctx, issueKey, text)
+}
+
+// TransitionIssue implements the IssueTracker interface.
+func (t *jiraTracker) TransitionIssue(ctx context.Context, issueKey string, transition string) error {
+	return t.client.TransitionIssue(ctx, issueKey, transition)
+}
+
+// NewJira creates a new MergeRequestHandlerFunc that uses the provided jiraClient
+// to lookup the Jira issues associated with a merge request and adds the issue
+// data to the merge request comment, in the same way as NewYouTrack. The issue
+// keys referenced by the merge request are found using the extractor, and keys
+// that are not existing Jira issues are skipped. The descriptions of the issues
+// are truncated to at most maxDescriptionLength characters, followed by a link
+// to the issue, unless maxDescriptionLength is zero.
+func NewJira(client jiraClient, extractor *IssueKeyExtractor, maxDescriptionLength int) MergeRequestHandlerFunc {
+	if client == nil || extractor == nil {
+		panic("client and extractor must not be nil")
+	}
+	tracker := NewJiraTracker(client)
+	return NewIssues(func(*gitlab.Project) IssueTracker { return tracker }, extractor, maxDescriptionLength)
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/jira"
+)
+
+// jiraRemoteLinkClient is an interface abstracting the API call of the Jira
+// client for adding remote links, which the IssueTracker interface has no
+// call for, so that we can do unit tests against a non-network implementation.
+type jiraRemoteLinkClient interface {
+	AddRemoteLink(ctx context.Context, issueKey string, link jira.RemoteLink) error
+}
+
+// NewJiraRemoteLink creates a new MergeRequestHandlerFunc that adds a remote
+// link to the merge request on each of the Jira issues referenced by the merge
+// request, as found by the extractor. The link has the title of the merge
+// request, and its author as summary. Jira identifies remote links by their
+// URL, so an issue already linking to the merge request gets that link updated
+// instead of a new one added. Keys that are not existing Jira issues are
+// skipped. The handler never adds a message to the merge request note.
+func NewJiraRemoteLink(client jiraRemoteLinkClient, extractor *IssueKeyExtractor) MergeRequestHandlerFunc {
+	if client == nil || extractor == nil {
+		panic("client and extractor must not be nil")
+	}
+	return MergeRequestHandlerFunc(func(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
+		issueKeys, err := extractor.Extract(ctx, webhook)
+		if err != nil {
+			return "", err
+		}
+		if len(issueKeys) == 0 || webhook.ObjectAttributes.URL == "" {
+			return "", nil
+		}
+		link := jiraRemoteLink(webhook)
+		for _, issueKey := range issueKeys {
+			err := client.AddRemoteLink(ctx, issueKey, link)
+			if jira.IsHTTPStatusError(err, http.StatusNotFound) {
+				// Not an error, the issue key just looked like a Jira key
+				continue
+			}
+			if err != nil {
+				return "", errors.Wrapf(err, "could not add remote link for issueKey '%s'", issueKey)
+			}
+		}
+		return "", nil
+	})
+}
+
+// jiraRemoteLink returns the remote link to the merge request of the webhook.
+func jiraRemoteLink(webhook *gitlab.MergeRequestWebhook) jira.RemoteLink {
+	attrs := webhook.ObjectAttributes
+	link := jira.RemoteLink{
+		URL:   attrs.URL,
+		Title: fmt.Sprintf("!%d %s", attrs.IID, attrs.Title),
+	}
+	if author := mergeRequestAuthor(webhook); author != "" {
+		link.Summary = "Merge request by " + author
+	}
+	return link
+}
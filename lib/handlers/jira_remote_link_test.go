@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/verath/mrgitlab/lib/jira"
+)
+
+func TestJiraRemoteLinkHandler(t *testing.T) {
+	var objects []map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/rest/api/2/issue/ABC-1/remotelink" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body struct {
+			Object map[string]string `json:"object"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		objects = append(objects, body.Object)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 10000}`))
+	}))
+	defer server.Close()
+	client, err := jira.NewTokenClient(logrus.New(), server.URL, "pat-token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	h := NewJiraRemoteLink(client, testIssueKeyExtractor)
+	msg, err := h.HandleMergeRequest(context.Background(), newBackLinkWebhook("ABC-1 ABC-2: Title"))
+	if err != nil {
+		t.Fatalf("Unexpected error handling merge request: %+v", err)
+	}
+	if msg != "" {
+		t.Errorf("Expected msg to be empty, was '%s'", msg)
+	}
+	expected := map[string]string{
+		"url":     "https://gitlab.example.com/group/project/merge_requests/12",
+		"title":   "!12 ABC-1 ABC-2: Title",
+		"summary": "Merge request by Jane Doe (jane)",
+	}
+	if len(objects) != 1 || fmt.Sprint(objects[0]) != fmt.Sprint(expected) {
+		t.Errorf("Expected the link %v on ABC-1, was %v", expected, objects)
+	}
+}
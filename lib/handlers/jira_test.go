@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/verath/mrgitlab/lib/jira"
+)
+
+// newJiraTestServer returns an httptest stand-in for the Jira API, knowing
+// only the issue ABC-1.
+func newJiraTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/2/issue/ABC-1":
+			w.Write([]byte(`{"key": "ABC-1", "fields": {
+				"summary": "Fix @all the things",
+				"description": "Fixes #12",
+				"status": {"name": "Open"},
+				"assignee": {"displayName": "John Smith"},
+				"parent": {"key": "ABC-0"}
+			}}`))
+		case "/rest/api/2/issue/ABC-3":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestJiraHandler(t *testing.T) {
+	server := newJiraTestServer()
+	defer server.Close()
+	client, err := jira.NewTokenClient(logrus.New(), server.URL, "pat-token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	h := NewJira(client, testIssueKeyExtractor, 0)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ABC-1 ABC-2: Title"))
+	if err != nil {
+		t.Fatalf("Unexpected error handling merge request: %+v", err)
+	}
+	expected := fmt.Sprintf(""+
+		"# ABC-1: Fix `@`all the things\n"+
+		"%[1]s/browse/ABC-1\n\n"+
+		"**State:** Open · **Assignee:** John Smith · **Parent:** [ABC-0](%[1]s/browse/ABC-0)\n\n"+
+		"> Fixes `#`12\n", server.URL)
+	if msg != expected {
+		t.Errorf("Expected msg '%s', was '%s'", expected, msg)
+	}
+}
+
+func TestJiraHandler_FailFetchingIssue(t *testing.T) {
+	server := newJiraTestServer()
+	defer server.Close()
+	client, err := jira.NewTokenClient(logrus.New(), server.URL, "pat-token")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	h := NewJira(client, testIssueKeyExtractor, 0)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ABC-1 ABC-3: Title"))
+	if err == nil {
+		t.Fatal("Expected an error but got nil")
+	}
+	if msg != "" {
+		t.Errorf("Expected msg to be empty, was '%s'", msg)
+	}
+}
@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// youtrackWikiPattern matches constructs that only exist in the YouTrack
+// wiki markup, and not in YouTrack Markdown, e.g. "==Heading==" or "{code}".
+var youtrackWikiPattern = regexp.MustCompile(
+	`(?m)^\s*=+[^=].*=+\s*$|\{code[^}]*\}|\{noformat\}|\{quote\}|\{monospace\}|\[\[|^\s*\|\|`)
+
+var (
+	wikiHeadingPattern   = regexp.MustCompile(`^\s*(=+)\s*(.*?)\s*=+\s*$`)
+	wikiCodeOpenPattern  = regexp.MustCompile(`^\s*\{(code|noformat)(?:[:\s]+(?:lang=)?([\w+#-]*))?\}(.*)$`)
+	wikiBulletPattern    = regexp.MustCompile(`^\s*(\*+)\s+(.*)$`)
+	wikiNumberedPattern  = regexp.MustCompile(`^\s*(#+)\s+(.*)$`)
+	wikiRulePattern      = regexp.MustCompile(`^\s*-{4,}\s*$`)
+	wikiMonospacePattern = regexp.MustCompile(`\{(?:monospace|code)\}(.*?)\{(?:monospace|code)\}|\{\{(.*?)\}\}`)
+	wikiInlineCodeSplit  = regexp.MustCompile("`[^`]*`")
+)
+
+var (
+	jiraHeadingPattern   = regexp.MustCompile(`^\s*h([1-6])\.\s+(.*)$`)
+	jiraQuoteLinePattern = regexp.MustCompile(`^\s*bq\.\s+(.*)$`)
+	jiraCodeOpenPattern  = regexp.MustCompile(`^\s*\{(code|noformat)(?::([^}]*))?\}(.*)$`)
+	jiraListPattern      = regexp.MustCompile(`^\s*([*#]+|-)\s+(.*)$`)
+	jiraMonospacePattern = regexp.MustCompile(`\{\{(.*?)\}\}`)
+)
+
+// wikiReplacement is a replacement of inline wiki markup.
+type wikiReplacement struct {
+	pattern *regexp.Regexp
+	replace string
+}
+
+// wikiBoldReplacement replaces *bold* text, written the same way in the
+// YouTrack and the Jira wiki markup.
+var wikiBoldReplacement = wikiReplacement{
+	regexp.MustCompile(`(^|[\s(])\*([^\s*](?:[^*]*[^\s*])?)\*($|[\s).,:;!?])`), "$1**$2**$3",
+}
+
+// wikiInlineReplacements are the replacements of inline wiki markup,
+// applied in order to the text outside of inline code.
+var wikiInlineReplacements = []wikiReplacement{
+	// [[url|text]] and [[url text]] links
+	{regexp.MustCompile(`\[\[([a-z]+://[^\]|\s]+)[|\s]+([^\]]+)\]\]`), "[$2]($1)"},
+	// [[url]] links
+	{regexp.MustCompile(`\[\[([a-z]+://[^\]\s]+)\]\]`), "<$1>"},
+	// [url text] links
+	{regexp.MustCompile(`\[([a-z]+://[^\]\s]+)\s+([^\]]+)\]`), "[$2]($1)"},
+	wikiBoldReplacement,
+	// --strikethrough--
+	{regexp.MustCompile(`(^|[\s(])--([^\s-](?:.*?[^\s-])?)--($|[\s).,:;!?])`), "$1~~$2~~$3"},
+}
+
+// jiraInlineReplacements are the replacements of inline Jira wiki markup,
+// applied in order to the text outside of inline code. The _italic_ text
+// of the Jira wiki markup is already valid Markdown.
+var jiraInlineReplacements = []wikiReplacement{
+	// [text|url] links
+	{regexp.MustCompile(`\[([^\]|]+)\|([a-z]+://[^\]\s]+)\]`), "[$1]($2)"},
+	// [url] links
+	{regexp.MustCompile(`\[([a-z]+://[^\]|\s]+)\]`), "<$1>"},
+	// [~user] mentions, kept as the name of the user
+	{regexp.MustCompile(`\[~([^\]]+)\]`), "$1"},
+	// {color:red}text{color}, where the color is dropped
+	{regexp.MustCompile(`\{color(?::[^}]*)?\}`), ""},
+	wikiBoldReplacement,
+	// -strikethrough-
+	{regexp.MustCompile(`(^|[\s(])-([^\s-](?:.*?[^\s-])?)-($|[\s).,:;!?])`), "$1~~$2~~$3"},
+}
+
+// wikiSyntax describes the constructs of a wiki markup, e.g. that of YouTrack
+// or Jira, that differ between the markups converted by convertWiki.
+type wikiSyntax struct {
+	// codeOpenPattern matches a line opening a code block, where the first
+	// group is the name of the tag, e.g. "code", the second group are the
+	// parameters of the tag and the third group is the rest of the line.
+	codeOpenPattern *regexp.Regexp
+	// codeLanguage returns the language of a code block given the
+	// parameters of the tag opening it.
+	codeLanguage func(params string) string
+	// convertLine converts a line that is not part of a code block or a
+	// table.
+	convertLine func(line string) string
+	// convertInline converts the inline markup of text.
+	convertInline func(text string) string
+}
+
+// youtrackWikiSyntax is the syntax of the YouTrack wiki markup.
+var youtrackWikiSyntax = wikiSyntax{
+	codeOpenPattern: wikiCodeOpenPattern,
+	codeLanguage:    func(params string) string { return params },
+	convertLine:     convertWikiLine,
+	convertInline:   convertWikiInline,
+}
+
+// jiraWikiSyntax is the syntax of the Jira wiki markup.
+var jiraWikiSyntax = wikiSyntax{
+	codeOpenPattern: jiraCodeOpenPattern,
+	codeLanguage:    jiraCodeLanguage,
+	convertLine:     convertJiraLine,
+	convertInline:   convertJiraInline,
+}
+
+// convertYoutrackMarkup converts the text of a YouTrack issue, written in
+// either the YouTrack wiki markup or YouTrack Markdown, to GitLab Markdown.
+// Texts using the wiki markup are detected by the constructs that only exist
+// in it, and are converted line by line. YouTrack Markdown is already valid
+// GitLab Markdown, and is returned as is.
+func convertYoutrackMarkup(text string) string {
+	if !youtrackWikiPattern.MatchString(text) {
+		return text
+	}
+	return convertYoutrackWiki(text)
+}
+
+// convertYoutrackWiki converts text written in the YouTrack wiki markup
+// to GitLab Markdown.
+func convertYoutrackWiki(text string) string {
+	return convertWiki(text, youtrackWikiSyntax)
+}
+
+// convertJiraWiki converts text written in the Jira wiki markup, as the
+// descriptions of Jira issues are, to GitLab Markdown.
+func convertJiraWiki(text string) string {
+	return convertWiki(text, jiraWikiSyntax)
+}
+
+// convertWiki converts text written in the wiki markup of the syntax to
+// GitLab Markdown, line by line.
+func convertWiki(text string, syntax wikiSyntax) string {
+	var out []string
+	// codeEnd is the tag closing the current code block, or empty if
+	// the current line is not in a code block
+	codeEnd := ""
+	quoted := false
+	inTable := false
+	for _, line := range strings.Split(strings.Replace(text, "\r\n", "\n", -1), "\n") {
+		if codeEnd != "" {
+			if i := strings.Index(line, codeEnd); i >= 0 {
+				if before := line[:i]; strings.TrimSpace(before) != "" {
+					out = append(out, quotePrefix(quoted)+before)
+				}
+				out = append(out, quotePrefix(quoted)+"```")
+				codeEnd = ""
+				continue
+			}
+			out = append(out, quotePrefix(quoted)+line)
+			continue
+		}
+		if match := syntax.codeOpenPattern.FindStringSubmatch(line); match != nil {
+			tag := "{" + match[1] + "}"
+			rest := match[3]
+			if i := strings.Index(rest, tag); i >= 0 {
+				// The code block is opened and closed on the same line
+				out = append(out, quotePrefix(quoted)+"`"+rest[:i]+"`"+syntax.convertInline(rest[i+len(tag):]))
+				continue
+			}
+			out = append(out, quotePrefix(quoted)+"```"+syntax.codeLanguage(match[2]))
+			if strings.TrimSpace(rest) != "" {
+				out = append(out, quotePrefix(quoted)+rest)
+			}
+			codeEnd = tag
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "{quote}" {
+			quoted = !quoted
+			continue
+		}
+		if strings.HasPrefix(trimmed, "|") {
+			row, isHeader := convertWikiTableRow(trimmed, syntax.convertInline)
+			if !inTable && !isHeader {
+				// GitLab Markdown tables require a header, so an empty one
+				// is added for tables without one
+				cells := strings.Count(row, "|") - 1
+				out = append(out, quotePrefix(quoted)+strings.Repeat("|   ", cells)+"|")
+				out = append(out, quotePrefix(quoted)+strings.Repeat("|---", cells)+"|")
+			}
+			out = append(out, quotePrefix(quoted)+row)
+			if isHeader {
+				cells := strings.Count(row, "|") - 1
+				out = append(out, quotePrefix(quoted)+strings.Repeat("|---", cells)+"|")
+			}
+			inTable = true
+			continue
+		}
+		inTable = false
+		out = append(out, quotePrefix(quoted)+syntax.convertLine(line))
+	}
+	if codeEnd != "" {
+		// Close code blocks that were never closed
+		out = append(out, quotePrefix(quoted)+"```")
+	}
+	return strings.Join(out, "\n")
+}
+
+// quotePrefix returns the prefix of lines in a {quote} block if quoted is
+// true, or an empty string otherwise.
+func quotePrefix(quoted bool) string {
+	if quoted {
+		return "> "
+	}
+	return ""
+}
+
+// convertWikiLine converts a line of wiki markup, that is not part of a
+// code block or a table, to GitLab Markdown.
+func convertWikiLine(line string) string {
+	if match := wikiHeadingPattern.FindStringSubmatch(line); match != nil {
+		return strings.Repeat("#", len(match[1])) + " " + convertWikiInline(match[2])
+	}
+	if wikiRulePattern.MatchString(line) {
+		return "---"
+	}
+	if match := wikiBulletPattern.FindStringSubmatch(line); match != nil {
+		return strings.Repeat("  ", len(match[1])-1) + "- " + convertWikiInline(match[2])
+	}
+	if match := wikiNumberedPattern.FindStringSubmatch(line); match != nil {
+		return strings.Repeat("   ", len(match[1])-1) + "1. " + convertWikiInline(match[2])
+	}
+	return convertWikiInline(line)
+}
+
+// convertWikiTableRow converts a row of a wiki table, e.g. "|a|b|", to a
+// row of a GitLab Markdown table, converting the cells with convertInline.
+// Header rows, e.g. "||a||b||", are reported by isHeader.
+func convertWikiTableRow(line string, convertInline func(string) string) (row string, isHeader bool) {
+	separator := "|"
+	if strings.HasPrefix(line, "||") {
+		separator = "||"
+		isHeader = true
+	}
+	cells := splitWikiTableCells(strings.Trim(line, "|"), separator)
+	for i, cell := range cells {
+		cells[i] = convertInline(strings.TrimSpace(cell))
+	}
+	return "| " + strings.Join(cells, " | ") + " |", isHeader
+}
+
+// splitWikiTableCells splits the cells of a row of a wiki table at the
+// separator, except within brackets, so that links such as "[text|url]"
+// are kept within their cell.
+func splitWikiTableCells(row string, separator string) []string {
+	var cells []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '[':
+			depth++
+		case row[i] == ']' && depth > 0:
+			depth--
+		case depth == 0 && strings.HasPrefix(row[i:], separator):
+			cells = append(cells, row[start:i])
+			start = i + len(separator)
+			i = start - 1
+		}
+	}
+	return append(cells, row[start:])
+}
+
+// convertWikiInline converts the inline wiki markup of text, e.g. "*bold*"
+// and "{monospace}code{monospace}", to GitLab Markdown. Inline code is
+// kept as is.
+func convertWikiInline(text string) string {
+	return convertInlineMarkup(text, wikiMonospacePattern, wikiInlineReplacements)
+}
+
+// convertJiraLine converts a line of Jira wiki markup, that is not part of
+// a code block or a table, to GitLab Markdown.
+func convertJiraLine(line string) string {
+	if match := jiraHeadingPattern.FindStringSubmatch(line); match != nil {
+		level, _ := strconv.Atoi(match[1])
+		return strings.Repeat("#", level) + " " + convertJiraInline(match[2])
+	}
+	if match := jiraQuoteLinePattern.FindStringSubmatch(line); match != nil {
+		return "> " + convertJiraInline(match[1])
+	}
+	if wikiRulePattern.MatchString(line) {
+		return "---"
+	}
+	if match := jiraListPattern.FindStringSubmatch(line); match != nil {
+		// The type of a nested item, e.g. "*#", is given by its last marker
+		markers := match[1]
+		if strings.HasSuffix(markers, "#") {
+			return strings.Repeat("   ", len(markers)-1) + "1. " + convertJiraInline(match[2])
+		}
+		return strings.Repeat("  ", len(markers)-1) + "- " + convertJiraInline(match[2])
+	}
+	return convertJiraInline(line)
+}
+
+// convertJiraInline converts the inline Jira wiki markup of text, e.g.
+// "*bold*" and "{{code}}", to GitLab Markdown. Inline code is kept as is.
+func convertJiraInline(text string) string {
+	return convertInlineMarkup(text, jiraMonospacePattern, jiraInlineReplacements)
+}
+
+// jiraCodeLanguage returns the language of a Jira code block given the
+// parameters of its tag, e.g. "java" or "title=Foo.java|language=java".
+func jiraCodeLanguage(params string) string {
+	for _, param := range strings.Split(params, "|") {
+		if !strings.Contains(param, "=") {
+			return strings.TrimSpace(param)
+		}
+		if strings.HasPrefix(param, "language=") {
+			return strings.TrimSpace(strings.TrimPrefix(param, "language="))
+		}
+	}
+	return ""
+}
+
+// convertInlineMarkup converts the monospace text matched by the groups of the
+// monospacePattern to inline code, and then applies the replacements to the
+// text outside of inline code.
+func convertInlineMarkup(text string, monospacePattern *regexp.Regexp, replacements []wikiReplacement) string {
+	text = monospacePattern.ReplaceAllStringFunc(text, func(match string) string {
+		submatches := monospacePattern.FindStringSubmatch(match)
+		return "`" + strings.Join(submatches[1:], "") + "`"
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range wikiInlineCodeSplit.FindAllStringIndex(text, -1) {
+		buf.WriteString(replaceWikiInline(text[last:loc[0]], replacements))
+		buf.WriteString(text[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	buf.WriteString(replaceWikiInline(text[last:], replacements))
+	return buf.String()
+}
+
+// replaceWikiInline applies the replacements to text.
+func replaceWikiInline(text string, replacements []wikiReplacement) string {
+	for _, rep := range replacements {
+		text = rep.pattern.ReplaceAllString(text, rep.replace)
+	}
+	return text
+}
+
+// truncateMarkdown truncates the Markdown text to at most maxLength characters,
+// not counting the "Read more" link to readMoreURL that is added if the text is
+// truncated. The text is truncated after the last line that fits, or, if not even
+// the first line fits, after the last word that fits. Code blocks that are cut off
+// are closed. The text is not truncated if maxLength is zero or less.
+func truncateMarkdown(text string, maxLength int, readMoreURL *url.URL) string {
+	if maxLength <= 0 || utf8.RuneCountInString(text) <= maxLength {
+		return text
+	}
+	var kept []string
+	length := 0
+	inCode := false
+	for _, line := range strings.Split(text, "\n") {
+		lineLength := utf8.RuneCountInString(line)
+		if len(kept) > 0 {
+			lineLength++
+		}
+		if length+lineLength > maxLength {
+			break
+		}
+		kept = append(kept, line)
+		length += lineLength
+		if strings.HasPrefix(strings.TrimLeft(line, "> "), "```") {
+			inCode = !inCode
+		}
+	}
+	if len(kept) == 0 {
+		runes := []rune(text)[:maxLength]
+		cut := string(runes)
+		if i := strings.LastIndexAny(cut, " \t"); i > 0 {
+			cut = cut[:i]
+		}
+		kept = []string{cut + "…"}
+	}
+	if inCode {
+		kept = append(kept, "```")
+	}
+	return fmt.Sprintf("%s\n\n[Read more](%s)", strings.Join(kept, "\n"), readMoreURL)
+}
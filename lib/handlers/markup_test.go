@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testMarkupFixtures tests the conversion of each testdata/<dir>/<name>.input
+// fixture by convert, which is expected to equal the testdata/<dir>/<name>.golden
+// fixture.
+func testMarkupFixtures(t *testing.T, dir string, convert func(string) string) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", dir, "*.input"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("Expected markup fixtures")
+	}
+	for _, inputPath := range inputs {
+		input, err := ioutil.ReadFile(inputPath)
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		goldenPath := strings.TrimSuffix(inputPath, ".input") + ".golden"
+		expected, err := ioutil.ReadFile(goldenPath)
+		if err != nil {
+			t.Fatalf("Unexpected error: %+v", err)
+		}
+		actual := convert(strings.TrimSuffix(string(input), "\n"))
+		if actual != strings.TrimSuffix(string(expected), "\n") {
+			t.Errorf(""+
+				"conversion of %s\n"+
+				"\t expected:\n"+
+				"'%s'\n"+
+				"\t actual:\n"+
+				"'%s'\n",
+				inputPath, expected, actual)
+		}
+	}
+}
+
+func TestConvertYoutrackMarkup(t *testing.T) {
+	testMarkupFixtures(t, "markup", convertYoutrackMarkup)
+}
+
+func TestConvertJiraWiki(t *testing.T) {
+	testMarkupFixtures(t, "jira_markup", convertJiraWiki)
+}
+
+func TestTruncateMarkdown(t *testing.T) {
+	readMoreURL, _ := url.Parse("http://youtrack.test/issue/ISSUE-1")
+	tests := []struct {
+		text      string
+		maxLength int
+		expected  string
+	}{
+		// Not truncated
+		{"abc\ndef", 0, "abc\ndef"},
+		{"abc\ndef", 7, "abc\ndef"},
+		// Truncated after the last line that fits
+		{"abc\ndef\nghi", 8, "abc\ndef\n\n[Read more](http://youtrack.test/issue/ISSUE-1)"},
+		// Truncated after the last word, if no line fits
+		{"abc def ghi", 9, "abc def…\n\n[Read more](http://youtrack.test/issue/ISSUE-1)"},
+		{"abcdefghi", 4, "abcd…\n\n[Read more](http://youtrack.test/issue/ISSUE-1)"},
+		// Code blocks that are cut off are closed
+		{"abc\n```\ncode\nmore code", 12, "abc\n```\ncode\n```\n\n[Read more](http://youtrack.test/issue/ISSUE-1)"},
+		{"```\ncode\n```\nabc def", 13, "```\ncode\n```\n\n[Read more](http://youtrack.test/issue/ISSUE-1)"},
+		// Characters, not bytes, are counted
+		{"åäö\nåäö", 3, "åäö\n\n[Read more](http://youtrack.test/issue/ISSUE-1)"},
+	}
+	for _, test := range tests {
+		actual := truncateMarkdown(test.text, test.maxLength, readMoreURL)
+		if actual != test.expected {
+			t.Errorf("Expected '%s' for text '%s' and max length %d, was: '%s'",
+				test.expected, test.text, test.maxLength, actual)
+		}
+	}
+}
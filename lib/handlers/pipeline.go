@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// NewPipelineFailure creates a new PipelineHandlerFunc that, for failed
+// pipelines, returns a summary of the jobs that failed. Each failed job
+// is listed with its stage and a link to the job. Jobs that are allowed
+// to fail are not included.
+func NewPipelineFailure() PipelineHandlerFunc {
+	return PipelineHandlerFunc(func(ctx context.Context, webhook *gitlab.PipelineWebhook) (string, error) {
+		if webhook.ObjectAttributes.Status != "failed" {
+			return "", nil
+		}
+		var failedBuilds []gitlab.PipelineBuild
+		for _, build := range webhook.Builds {
+			if build.Status == "failed" && !build.AllowFailure {
+				failedBuilds = append(failedBuilds, build)
+			}
+		}
+		var buf bytes.Buffer
+		projectURL := strings.TrimSuffix(webhook.Project.WebURL, "/")
+		// The pipeline is linked, rather than referenced as "#<id>",
+		// which GitLab would take as a reference to the issue <id>
+		fmt.Fprintf(&buf, "# [Pipeline %[2]d](%[1]s/-/pipelines/%[2]d) failed\n",
+			projectURL, webhook.ObjectAttributes.ID)
+		if len(failedBuilds) == 0 {
+			return buf.String(), nil
+		}
+		buf.WriteString("The following jobs failed:\n\n")
+		for _, build := range failedBuilds {
+			fmt.Fprintf(&buf, "- **%s**: [%s](%s/-/jobs/%d)\n",
+				sanitizeInlineMarkdown(build.Stage), sanitizeInlineMarkdown(build.Name),
+				projectURL, build.ID)
+		}
+		return buf.String(), nil
+	})
+}
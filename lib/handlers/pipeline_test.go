@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+var failedPipelineWebhookJSON = []byte(`{
+	"object_kind": "pipeline",
+	"object_attributes": {
+		"id": 31,
+		"ref": "feature/xyz982",
+		"tag": false,
+		"status": "failed",
+		"stages": ["build", "test"]
+	},
+	"project": {
+		"id": 1,
+		"path_with_namespace": "group/project",
+		"web_url": "http://gitlab.test/group/project"
+	},
+	"builds": [
+		{"id": 380, "stage": "build", "name": "compile", "status": "success"},
+		{"id": 381, "stage": "test", "name": "unit", "status": "failed"},
+		{"id": 382, "stage": "test", "name": "lint", "status": "failed", "allow_failure": true}
+	]
+}`)
+
+func TestPipelineFailureHandler(t *testing.T) {
+	webhook := &gitlab.PipelineWebhook{}
+	if err := json.Unmarshal(failedPipelineWebhookJSON, webhook); err != nil {
+		panic(err) // json decode not part of what we test
+	}
+	h := NewPipelineFailure()
+	msg, err := h.HandlePipeline(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("Unexpected error handling pipeline: %+v", err)
+	}
+	expectedHeading := "# [Pipeline 31](http://gitlab.test/group/project/-/pipelines/31) failed\n"
+	if !strings.HasPrefix(msg, expectedHeading) {
+		t.Errorf("Expected msg to start with '%s', was '%s'", expectedHeading, msg)
+	}
+	expectedLink := "[unit](http://gitlab.test/group/project/-/jobs/381)"
+	if !strings.Contains(msg, expectedLink) {
+		t.Errorf("Expected msg to contain '%s', was '%s'", expectedLink, msg)
+	}
+	if strings.Contains(msg, "compile") {
+		t.Errorf("Expected msg to not contain successful job, was '%s'", msg)
+	}
+	if strings.Contains(msg, "lint") {
+		t.Errorf("Expected msg to not contain job allowed to fail, was '%s'", msg)
+	}
+}
+
+func TestPipelineFailureHandler_NotFailed(t *testing.T) {
+	webhook := &gitlab.PipelineWebhook{}
+	webhook.ObjectAttributes.Status = "success"
+	h := NewPipelineFailure()
+	msg, err := h.HandlePipeline(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("Unexpected error handling pipeline: %+v", err)
+	}
+	if msg != "" {
+		t.Errorf("Expected msg to be empty, was '%s'", msg)
+	}
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/redmine"
+)
+
+// redmineClient is an interface abstracting the Redmine client used for API
+// calls, so that we can do unit tests against a non-network implementation.
+type redmineClient interface {
+	GetIssue(ctx context.Context, issueID int64) (*redmine.Issue, error)
+	GetIssueURL(ctx context.Context, issueID int64) (*url.URL, error)
+	AddNote(ctx context.Context, issueID int64, notes string) error
+	SetIssueStatus(ctx context.Context, issueID int64, name string) error
+}
+
+// redmineTracker is the IssueTracker of a redmineClient.
+type redmineTracker struct {
+	client redmineClient
+}
+
+// NewRedmineTracker creates an IssueTracker for the issues of the Redmine
+// server of the client. The issues are identified by their number, with or
+// without a leading "#", e.g. "#1234". Issues are transitioned by setting
+// their status to the status with the name of the transition.
+func NewRedmineTracker(client redmineClient) IssueTracker {
+	if client == nil {
+		panic("client must not be nil")
+	}
+	return &redmineTracker{client: client}
+}
+
+// redmineNotesLimit is the max number of notes of an issue that are included
+// after its description, keeping the latest notes.
+const redmineNotesLimit = 3
+
+// GetIssue implements the IssueTracker interface. The description of the
+// issue is included as is, as Redmine servers using Markdown for the text
+// formatting are assumed, followed by the latest notes of the issue.
+func (t *redmineTracker) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
+	id, err := parseNumericIssueID(issueID)
+	if err != nil {
+		// Not an error, the issue id just does not look like a Redmine id
+		return nil, nil
+	}
+	issue, err := t.client.GetIssue(ctx, id)
+	if err != nil {
+		if redmine.IsHTTPStatusError(err, http.StatusNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := &Issue{
+		ID:          strconv.FormatInt(issue.ID, 10),
+		Summary:     issue.Subject,
+		Description: redmineDescription(issue),
+		State:       issue.Status.Name,
+	}
+	if issue.AssignedTo != nil {
+		result.Assignee = issue.AssignedTo.Name
+	}
+	if issue.Parent != nil {
+		result.Parent = strconv.FormatInt(issue.Parent.ID, 10)
+	}
+	return result, nil
+}
+
+// redmineDescription returns the description of the issue, followed by the
+// at most redmineNotesLimit latest notes of its journals, each headed by
+// the user and date of the note. Journals without notes are left out.
+func redmineDescription(issue *redmine.Issue) string {
+	var notes []string
+	for _, journal := range issue.Journals {
+		if strings.TrimSpace(journal.Notes) == "" {
+			continue
+		}
+		notes = append(notes, fmt.Sprintf("**%s**, %s:\n\n%s",
+			journal.User.Name, journal.CreatedOn.Format("2006-01-02"), strings.TrimSpace(journal.Notes)))
+	}
+	if len(notes) > redmineNotesLimit {
+		notes = notes[len(notes)-redmineNotesLimit:]
+	}
+	if description := strings.TrimSpace(issue.Description); description != "" {
+		notes = append([]string{description}, notes...)
+	}
+	return strings.Join(notes, "\n\n---\n\n")
+}
+
+// GetIssueURL implements the IssueTracker interface.
+func (t *redmineTracker) GetIssueURL(ctx context.Context, issueID string) (*url.URL, error) {
+	id, err := parseNumericIssueID(issueID)
+	if err != nil {
+		return nil, err
+	}
+	return t.client.GetIssueURL(ctx, id)
+}
+
+// AddComment implements the IssueTracker interface, adding the text as a
+// note of the issue.
+func (t *redmineTracker) AddComment(ctx context.Context, issueID string, text string) error {
+	id, err := parseNumericIssueID(issueID)
+	if err != nil {
+		return err
+	}
+	return t.client.AddNote(ctx, id, text)
+}
+
+// TransitionIssue implements the IssueTracker interface, setting the
+// status of the issue to the status named by the transition.
+func (t *redmineTracker) TransitionIssue(ctx context.Context, issueID string, transition string) error {
+	id, err := parseNumericIssueID(issueID)
+	if err != nil {
+		return err
+	}
+	return t.client.SetIssueStatus(ctx, id, transition)
+}
+
+// NewRedmine creates a new MergeRequestHandlerFunc that uses the provided
+// redmineClient to lookup the Redmine issues associated with a merge request
+// and adds the issue data to the merge request comment, in the same way as
+// NewYouTrack. The issue ids referenced by the merge request, e.g. "1234",
+// are found using the extractor, and ids that are not existing Redmine issues
+// are skipped. The descriptions of the issues are truncated to at most
+// maxDescriptionLength characters, followed by a link to the issue, unless
+// maxDescriptionLength is zero.
+func NewRedmine(client redmineClient, extractor *IssueKeyExtractor, maxDescriptionLength int) MergeRequestHandlerFunc {
+	if client == nil || extractor == nil {
+		panic("client and extractor must not be nil")
+	}
+	tracker := NewRedmineTracker(client)
+	return NewIssues(func(*gitlab.Project) IssueTracker { return tracker }, extractor, maxDescriptionLength)
+}
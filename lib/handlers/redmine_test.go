@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/verath/mrgitlab/lib/redmine"
+)
+
+// newRedmineTestServer returns an httptest stand-in for the Redmine API,
+// knowing only the issue 1234.
+func newRedmineTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/issues/1234.json":
+			w.Write([]byte(`{"issue": {
+				"id": 1234,
+				"tracker": {"id": 1, "name": "Bug"},
+				"status": {"id": 2, "name": "In Progress"},
+				"assigned_to": {"id": 5, "name": "Jane Doe"},
+				"parent": {"id": 1200},
+				"subject": "Crash on start",
+				"description": "Ping @all",
+				"journals": [
+					{"id": 1, "user": {"id": 5, "name": "Jane Doe"}, "notes": "", "created_on": "2026-01-02T10:00:00Z"},
+					{"id": 2, "user": {"id": 5, "name": "Jane Doe"}, "notes": "Looking into it", "created_on": "2026-01-03T10:00:00Z"}
+				]
+			}}`))
+		case "/issues/1235.json":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+// testRedmineExtractor extracts issue ids like "1234" from branches
+// like "feature/1234-foo".
+var testRedmineExtractor = NewIssueKeyExtractor(nil, IssueKeyPattern{
+	Regexp:   regexp.MustCompile(`^feature/([0-9]+)`),
+	Template: "$1",
+	Sources:  []string{IssueKeySourceBranch},
+})
+
+func TestRedmineHandler(t *testing.T) {
+	server := newRedmineTestServer()
+	defer server.Close()
+	client, err := redmine.NewClient(logrus.New(), server.URL, "api-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	h := NewRedmine(client, testRedmineExtractor, 0)
+	webhook := newTitleWebhook("Title")
+	webhook.ObjectAttributes.SourceBranch = "feature/1234-foo"
+	msg, err := h.HandleMergeRequest(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("Unexpected error handling merge request: %+v", err)
+	}
+	expected := fmt.Sprintf(""+
+		"# 1234: Crash on start\n"+
+		"%[1]s/issues/1234\n\n"+
+		"**State:** In Progress · **Assignee:** Jane Doe · **Parent:** [1200](%[1]s/issues/1200)\n\n"+
+		"> Ping `@`all\n"+
+		"> \n"+
+		"> ---\n"+
+		"> \n"+
+		"> **Jane Doe**, 2026-01-03:\n"+
+		"> \n"+
+		"> Looking into it\n", server.URL)
+	if msg != expected {
+		t.Errorf("Expected msg '%s', was '%s'", expected, msg)
+	}
+
+	// Issues that do not exist are skipped
+	webhook.ObjectAttributes.SourceBranch = "feature/99-foo"
+	msg, err = h.HandleMergeRequest(context.Background(), webhook)
+	if err != nil || msg != "" {
+		t.Errorf("Expected no msg and no error, was '%s', %v", msg, err)
+	}
+}
+
+func TestRedmineHandler_FailFetchingIssue(t *testing.T) {
+	server := newRedmineTestServer()
+	defer server.Close()
+	client, err := redmine.NewClient(logrus.New(), server.URL, "api-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	h := NewRedmine(client, testRedmineExtractor, 0)
+	webhook := newTitleWebhook("Title")
+	webhook.ObjectAttributes.SourceBranch = "feature/1235-foo"
+	msg, err := h.HandleMergeRequest(context.Background(), webhook)
+	if err == nil {
+		t.Fatal("Expected an error but got nil")
+	}
+	if msg != "" {
+		t.Errorf("Expected msg to be empty, was '%s'", msg)
+	}
+}
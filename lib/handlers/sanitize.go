@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/text"
+)
+
+// markdownParser parses GitLab flavoured Markdown, including the GFM
+// extensions, such as tables and autolinked URLs, supported by GitLab.
+var markdownParser = goldmark.New(goldmark.WithExtensions(extension.GFM)).Parser()
+
+// gitLabReferencePattern matches the GitLab references in a text, e.g.
+// "@user", "@group/subgroup", "#12", "group/project#12", "!12", "$12", "&12",
+// "~label", "~\"a label\"", "%milestone" and "%\"a milestone\"". The project of
+// cross-project references needs no escaping, as the references are broken by
+// escaping their sigil. HTML entities, e.g. "&#35;", are matched so that they
+// can be kept as is.
+// See https://docs.gitlab.com/ee/user/markdown.html#gitlab-specific-references
+var gitLabReferencePattern = regexp.MustCompile(
+	`&#?\w+;|@[\w.-]*\w|[#!$&]\d+|[~%](?:"[^"\n]*"|'[^'\n]*'|\w+)`)
+
+// quickActionPattern matches a GitLab quick action, e.g. "/close", at the
+// start of a line.
+var quickActionPattern = regexp.MustCompile(`^\s*/[a-z_]`)
+
+// markdownEdit is a replacement of the bytes [start, end) of a Markdown
+// source.
+type markdownEdit struct {
+	start, end  int
+	replacement []byte
+}
+
+// sanitizeMarkdown neutralizes the GitLab references, quick actions and HTML in
+// the Markdown text, so that the text can be included in a note without e.g.
+// mentioning users, closing the merge request or injecting HTML. The text is
+// parsed as Markdown, so that code and links, where GitLab does not expand
+// references, are left as is. References are neutralized by putting their sigil
+// in inline code, e.g. "@user" -> "`@`user", quick actions by putting their slash
+// in inline code, and HTML by escaping its "<" as "&lt;".
+func sanitizeMarkdown(markdown string) string {
+	source := []byte(markdown)
+	edits := sanitizeMarkdownEdits(source)
+	if len(edits) == 0 {
+		return markdown
+	}
+	return string(applyMarkdownEdits(source, edits))
+}
+
+// inlineMarkdownPrefix is prepended to inline Markdown text before it is
+// parsed, so that the text is parsed as the inline content of a paragraph
+// rather than as e.g. a code block or a heading.
+const inlineMarkdownPrefix = "a "
+
+// sanitizeInlineMarkdown is like sanitizeMarkdown, but for text that is
+// included inline in a note, e.g. in a heading or a table cell, rather than
+// as blocks of its own. Line breaks are collapsed to spaces, and the text is
+// parsed as the content of a paragraph, as it is rendered in the note. Text
+// that would start e.g. a code block on a line of its own is therefore not
+// left as is.
+func sanitizeInlineMarkdown(markdown string) string {
+	markdown = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ").Replace(markdown)
+	source := []byte(inlineMarkdownPrefix + markdown)
+	edits := sanitizeMarkdownEdits(source)
+	if len(edits) == 0 {
+		return markdown
+	}
+	return string(applyMarkdownEdits(source, edits)[len(inlineMarkdownPrefix):])
+}
+
+// sanitizeMarkdownEdits parses the Markdown source, returning the edits that
+// neutralize its GitLab references, quick actions and HTML, ordered by their
+// position in the source.
+func sanitizeMarkdownEdits(source []byte) []markdownEdit {
+	doc := markdownParser.Parse(text.NewReader(source))
+	var edits []markdownEdit
+	ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node := node.(type) {
+		case *ast.CodeSpan, *ast.CodeBlock, *ast.FencedCodeBlock, *ast.Link, *ast.Image, *ast.AutoLink:
+			return ast.WalkSkipChildren, nil
+		case *ast.HTMLBlock:
+			edits = append(edits, sanitizeHTMLSegments(source, node.Lines())...)
+			if node.HasClosure() {
+				closure := text.NewSegments()
+				closure.Append(node.ClosureLine)
+				edits = append(edits, sanitizeHTMLSegments(source, closure)...)
+			}
+		case *ast.RawHTML:
+			edits = append(edits, sanitizeHTMLSegments(source, node.Segments)...)
+		case *ast.Text:
+			// The parser splits text at characters that may be delimiters,
+			// e.g. the "~" of strikethrough, so the text of contiguous Text
+			// nodes is sanitized as a whole by the first of the nodes
+			if prev, ok := node.PreviousSibling().(*ast.Text); ok && prev.Segment.Stop == node.Segment.Start {
+				return ast.WalkContinue, nil
+			}
+			start, stop := node.Segment.Start, node.Segment.Stop
+			for next, ok := node.NextSibling().(*ast.Text); ok && next.Segment.Start == stop; next, ok = next.NextSibling().(*ast.Text) {
+				stop = next.Segment.Stop
+			}
+			if sanitized, changed := sanitizeMarkdownText(source, start, stop); changed {
+				edits = append(edits, markdownEdit{start, stop, sanitized})
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	return edits
+}
+
+// applyMarkdownEdits returns a copy of the source with the edits, which must
+// be ordered by their position, applied.
+func applyMarkdownEdits(source []byte, edits []markdownEdit) []byte {
+	var buf bytes.Buffer
+	last := 0
+	for _, edit := range edits {
+		if edit.start < last {
+			// Overlapping edits are not expected, but are skipped to
+			// never duplicate any of the source
+			continue
+		}
+		buf.Write(source[last:edit.start])
+		buf.Write(edit.replacement)
+		last = edit.end
+	}
+	buf.Write(source[last:])
+	return buf.Bytes()
+}
+
+// sanitizeMarkdownText neutralizes the GitLab references of the text in the
+// bytes [start, stop) of the source, and the quick action if the text is at
+// the start of a line. Returns false if the text was not changed.
+func sanitizeMarkdownText(source []byte, start int, stop int) ([]byte, bool) {
+	value := source[start:stop]
+	changed := false
+	sanitized := gitLabReferencePattern.ReplaceAllFunc(value, func(match []byte) []byte {
+		if match[0] == '&' && match[len(match)-1] == ';' {
+			return match
+		}
+		changed = true
+		return append([]byte("`"+string(match[0])+"`"), match[1:]...)
+	})
+	lineStart := bytes.LastIndexByte(source[:start], '\n') + 1
+	if quickActionPattern.Match(source[lineStart:stop]) && len(bytes.TrimSpace(source[lineStart:start])) == 0 {
+		i := bytes.IndexByte(sanitized, '/')
+		sanitized = append(append(append([]byte{}, sanitized[:i]...), "`/`"...), sanitized[i+1:]...)
+		changed = true
+	}
+	return sanitized, changed
+}
+
+// sanitizeHTMLSegments returns the edits neutralizing the HTML in the segments
+// of the source. Escaping the "<" of the HTML makes GitLab render it as text,
+// so the GitLab references and quick actions of the segments are neutralized
+// as well.
+func sanitizeHTMLSegments(source []byte, segments *text.Segments) []markdownEdit {
+	var edits []markdownEdit
+	for i := 0; i < segments.Len(); i++ {
+		segment := segments.At(i)
+		value, changed := sanitizeMarkdownText(source, segment.Start, segment.Stop)
+		if bytes.IndexByte(value, '<') >= 0 {
+			value = bytes.Replace(value, []byte("<"), []byte("&lt;"), -1)
+			changed = true
+		}
+		if changed {
+			edits = append(edits, markdownEdit{segment.Start, segment.Stop, value})
+		}
+	}
+	return edits
+}
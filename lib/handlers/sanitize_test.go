@@ -0,0 +1,138 @@
+package handlers
+
+import "testing"
+
+func TestSanitizeMarkdown(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"abc\ndef", "abc\ndef"},
+		{"", ""},
+		// @ user mention
+		{"@petere", "`@`petere"},
+		{"aa@petere", "aa`@`petere"},
+		{"aa@", "aa@"},
+		{"@all please review", "`@`all please review"},
+		{"@pet.ere_x-y", "`@`pet.ere_x-y"},
+		// @ group mention
+		{"@group/subgroup", "`@`group/subgroup"},
+		{"@group/subgroup/team.", "`@`group/subgroup/team."},
+		// # issue
+		{"#123", "`#`123"},
+		{"#abc", "#abc"},
+		{"123#", "123#"},
+		{"project#123", "project`#`123"},
+		{"group/project#123", "group/project`#`123"},
+		{"group/sub/project#123.", "group/sub/project`#`123."},
+		// ! merge request
+		{"!123", "`!`123"},
+		{"!abc", "!abc"},
+		{"123!", "123!"},
+		{"group/project!123", "group/project`!`123"},
+		// $ snippet
+		{"$123", "`$`123"},
+		{"$abc", "$abc"},
+		{"123$", "123$"},
+		// & epic
+		{"&123", "`&`123"},
+		{"group&123", "group`&`123"},
+		{"&epic", "&epic"},
+		// ~ label
+		{"~123", "`~`123"},
+		{"~abc", "`~`abc"},
+		{"~\"feature request\"", "`~`\"feature request\""},
+		{"~'feature request'", "`~`'feature request'"},
+		{"group/project~bug", "group/project`~`bug"},
+		{"123~", "123~"},
+		// % milestone
+		{"%123", "`%`123"},
+		{"%abc", "`%`abc"},
+		{"%\"release candidate\"", "`%`\"release candidate\""},
+		{"123%", "123%"},
+		{"50% done", "50% done"},
+		// Multiple references
+		{"@a and @b fixed #1, !2 and ~bug", "`@`a and `@`b fixed `#`1, `!`2 and `~`bug"},
+		// HTML entities are kept
+		{"&amp; &#35;1 &lt;", "&amp; &#35;1 &lt;"},
+		// Markdown formatting is kept
+		{"**@user** and _#12_", "**`@`user** and _`#`12_"},
+		{"# Heading #12", "# Heading `#`12"},
+		{"~~@user~~ ~bug", "~~`@`user~~ `~`bug"},
+		{"- item @user\n- item #1", "- item `@`user\n- item `#`1"},
+		{"> quoted @user", "> quoted `@`user"},
+		{"| a | b |\n|---|---|\n| @user | #1 |", "| a | b |\n|---|---|\n| `@`user | `#`1 |"},
+		// Inline code is left alone
+		{"`@user #1`", "`@user #1`"},
+		{"run `cmd` @user", "run `cmd` `@`user"},
+		{"``a ` @b``", "``a ` @b``"},
+		// Code blocks are left alone
+		{"```\n@user #1\n/close\n```", "```\n@user #1\n/close\n```"},
+		{"```go\nx := a!1\n```\n@user", "```go\nx := a!1\n```\n`@`user"},
+		{"text\n\n    @user #1", "text\n\n    @user #1"},
+		// Links are left alone
+		{"[@user #1](https://example.com/#1)", "[@user #1](https://example.com/#1)"},
+		{"![@user](https://example.com/a.png)", "![@user](https://example.com/a.png)"},
+		{"<https://example.com/@user>", "<https://example.com/@user>"},
+		{"see https://example.com/@user#12 or @user", "see https://example.com/@user#12 or `@`user"},
+		{"[ref]: https://example.com/@user\n\n[@user][ref]", "[ref]: https://example.com/@user\n\n[@user][ref]"},
+		// Quick actions are neutralized
+		{"/close", "`/`close"},
+		{"text\n/assign @user", "text\n`/`assign `@`user"},
+		{"  /label ~bug", "  `/`label `~`bug"},
+		{"a /close", "a /close"},
+		{"/", "/"},
+		{"/1", "/1"},
+		// HTML is escaped
+		{"<script>alert(1)</script>", "&lt;script>alert(1)&lt;/script>"},
+		{"<div>\n@user\n</div>", "&lt;div>\n`@`user\n&lt;/div>"},
+		{"<div>\n/close #1\n</div>", "&lt;div>\n`/`close `#`1\n&lt;/div>"},
+		{"a <span title=\"@all\">b</span>", "a &lt;span title=\"`@`all\">b&lt;/span>"},
+		{"a <b>bold</b> @user", "a &lt;b>bold&lt;/b> `@`user"},
+		{"<!-- comment -->", "&lt;!-- comment -->"},
+		{"1 < 2", "1 < 2"},
+	}
+	for _, test := range tests {
+		actual := sanitizeMarkdown(test.text)
+		if actual != test.expected {
+			t.Errorf(""+
+				"sanitizeMarkdown\n"+
+				"\t text:\n"+
+				"'%s'\n"+
+				"\t expected:\n"+
+				"'%s'\n"+
+				"\t actual:\n"+
+				"'%s'\n",
+				test.text, test.expected, actual)
+		}
+	}
+}
+
+func TestSanitizeInlineMarkdown(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected string
+	}{
+		{"", ""},
+		{"Summary", "Summary"},
+		{"@all please review", "`@`all please review"},
+		{"`@user` and @user", "`@user` and `@`user"},
+		{"[@user](https://example.com/)", "[@user](https://example.com/)"},
+		// Text that would be a block of its own is parsed as inline text
+		{"```x @all", "```x `@`all"},
+		{"    @all #1", "    `@`all `#`1"},
+		{"# @all", "# `@`all"},
+		{"- @all", "- `@`all"},
+		{"<div>@all</div>", "&lt;div>`@`all&lt;/div>"},
+		// Line breaks are collapsed
+		{"a\n```\n@all", "a ``` `@`all"},
+		{"a\r\n@all\rb", "a `@`all b"},
+	}
+	for _, test := range tests {
+		actual := sanitizeInlineMarkdown(test.text)
+		if actual != test.expected {
+			t.Errorf("sanitizeInlineMarkdown: expected '%s' for '%s', was: '%s'",
+				test.expected, test.text, actual)
+		}
+	}
+}
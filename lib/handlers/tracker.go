@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// Issue is an issue of an IssueTracker, normalized to the data that is
+// included in the merge request notes.
+type Issue struct {
+	// ID is the id of the issue, e.g. "XYZ-982".
+	ID      string
+	Summary string
+	// Description is the description of the issue, as GitLab Markdown.
+	Description string
+	// State is the name of the state, or status, of the issue, or
+	// empty if the tracker has no state for the issue.
+	State string
+	// Assignee is the name of the assignee, or empty if unassigned.
+	Assignee string
+	// Parent is the id of the parent issue, or empty if the issue
+	// is not a subtask.
+	Parent string
+}
+
+// IssueTracker is an issue tracker, e.g. YouTrack or Jira, that holds the
+// issues referenced by merge requests.
+type IssueTracker interface {
+	// GetIssue returns the issue identified by issueID, or nil if no
+	// such issue exists.
+	GetIssue(ctx context.Context, issueID string) (*Issue, error)
+	// GetIssueURL returns the browsable URL of the issue identified
+	// by issueID.
+	GetIssueURL(ctx context.Context, issueID string) (*url.URL, error)
+	// AddComment comments on the issue identified by issueID.
+	AddComment(ctx context.Context, issueID string, text string) error
+	// TransitionIssue changes the state of the issue identified by
+	// issueID. The transition is specific to the tracker, e.g. a
+	// command for YouTrack or the name of a transition for Jira.
+	TransitionIssue(ctx context.Context, issueID string, transition string) error
+}
+
+// TrackerFunc returns the IssueTracker of the issues referenced by the
+// merge requests of the project, or nil if the project has no tracker.
+type TrackerFunc func(project *gitlab.Project) IssueTracker
+
+// parseNumericIssueID parses the number of a numeric issueID, with or
+// without a leading "#", e.g. "#12", as used by GitLab and Redmine.
+func parseNumericIssueID(issueID string) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimPrefix(issueID, "#"), 10, 64)
+	if err != nil {
+		return 0, errors.Errorf("invalid numeric issue id '%s'", issueID)
+	}
+	return n, nil
+}
+
+// NewIssues creates a new MergeRequestHandlerFunc that looks up the issues
+// associated with a merge request in the IssueTracker of its project, given
+// by trackerFor, and adds the issue data to the merge request comment. The
+// issue ids referenced by the merge request are found using the extractor,
+// and ids that are not existing issues are skipped. Merge requests without
+// any existing issue, or of projects without a tracker, are ignored. The
+// descriptions of the issues are truncated to at most maxDescriptionLength
+// characters, followed by a link to the issue, unless maxDescriptionLength
+// is zero.
+func NewIssues(trackerFor TrackerFunc, extractor *IssueKeyExtractor, maxDescriptionLength int) MergeRequestHandlerFunc {
+	if trackerFor == nil || extractor == nil {
+		panic("trackerFor and extractor must not be nil")
+	}
+	return MergeRequestHandlerFunc(func(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
+		tracker := trackerFor(&webhook.Project)
+		if tracker == nil {
+			return "", nil
+		}
+		issueIDs, err := extractor.Extract(ctx, webhook)
+		if err != nil {
+			return "", err
+		}
+		if len(issueIDs) == 0 {
+			return "", nil
+		}
+		issues, err := fetchIssues(ctx, issueIDs, func(ctx context.Context, issueID string) (*noteIssue, error) {
+			return fetchTrackerIssue(ctx, tracker, issueID)
+		})
+		if err != nil {
+			return "", err
+		}
+		return issuesMessage(issues, maxDescriptionLength), nil
+	})
+}
+
+// fetchTrackerIssue fetches the issue identified by issueID from the tracker,
+// or returns nil if no such issue exists. The URL of the issue is only
+// resolved once the issue is known to exist, as trackers may not be able to
+// resolve the URL of ids of other trackers, e.g. "XYZ-982" for Redmine.
+func fetchTrackerIssue(ctx context.Context, tracker IssueTracker, issueID string) (*noteIssue, error) {
+	issue, err := tracker.GetIssue(ctx, issueID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get issue for issueID '%s'", issueID)
+	}
+	if issue == nil {
+		return nil, nil
+	}
+	issueURL, err := tracker.GetIssueURL(ctx, issueID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not resolve issue URL for issueID '%s'", issueID)
+	}
+	// We sanitize the GitLab references here, so that we don't accidentally
+	// spam users by mentioning them in the comment
+	result := &noteIssue{
+		ID:          issueID,
+		URL:         issueURL,
+		Summary:     sanitizeInlineMarkdown(issue.Summary),
+		Description: sanitizeMarkdown(issue.Description),
+		State:       sanitizeInlineMarkdown(issue.State),
+		Assignee:    sanitizeInlineMarkdown(issue.Assignee),
+	}
+	if issue.Parent != "" {
+		parentURL, err := tracker.GetIssueURL(ctx, issue.Parent)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not resolve issue URL for issueID '%s'", issue.Parent)
+		}
+		result.ParentID = issue.Parent
+		result.ParentURL = parentURL
+	}
+	return result, nil
+}
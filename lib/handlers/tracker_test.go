@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/redmine"
+)
+
+// mockIssueTracker is an IssueTracker of a fixed set of issues.
+type mockIssueTracker struct {
+	baseURL string
+	issues  map[string]*Issue
+}
+
+func (t *mockIssueTracker) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
+	return t.issues[issueID], nil
+}
+
+func (t *mockIssueTracker) GetIssueURL(ctx context.Context, issueID string) (*url.URL, error) {
+	return url.Parse(t.baseURL + issueID)
+}
+
+func (t *mockIssueTracker) AddComment(ctx context.Context, issueID string, text string) error {
+	return nil
+}
+
+func (t *mockIssueTracker) TransitionIssue(ctx context.Context, issueID string, transition string) error {
+	return nil
+}
+
+func TestIssuesHandler_TrackerPerProject(t *testing.T) {
+	trackers := map[string]IssueTracker{
+		"group/a": &mockIssueTracker{
+			baseURL: "http://a.test/",
+			issues:  map[string]*Issue{"ISSUE-1": {ID: "ISSUE-1", Summary: "From A", Description: "Desc A", Assignee: "@jane"}},
+		},
+		"group/b": &mockIssueTracker{
+			baseURL: "http://b.test/",
+			issues:  map[string]*Issue{"ISSUE-1": {ID: "ISSUE-1", Summary: "From B", Description: "Desc B", Parent: "ISSUE-0"}},
+		},
+	}
+	h := NewIssues(func(project *gitlab.Project) IssueTracker {
+		return trackers[project.PathWithNamespace]
+	}, testIssueKeyExtractor, 0)
+
+	tests := []struct {
+		project  string
+		expected string
+	}{
+		{"group/a", "# ISSUE-1: From A\nhttp://a.test/ISSUE-1\n\n**Assignee:** `@`jane\n\n> Desc A\n"},
+		{"group/b", "# ISSUE-1: From B\nhttp://b.test/ISSUE-1\n\n**Parent:** [ISSUE-0](http://b.test/ISSUE-0)\n\n> Desc B\n"},
+		{"group/c", ""},
+	}
+	for _, test := range tests {
+		webhook := newTitleWebhook("ISSUE-1 ISSUE-2: Title")
+		webhook.Project.PathWithNamespace = test.project
+		msg, err := h.HandleMergeRequest(context.Background(), webhook)
+		if err != nil {
+			t.Fatalf("Unexpected error for project '%s': %+v", test.project, err)
+		}
+		if msg != test.expected {
+			t.Errorf("Expected msg '%s' for project '%s', was '%s'", test.expected, test.project, msg)
+		}
+	}
+}
+
+// Test that ids that are not ids of the tracker, e.g. "XYZ-982" for the
+// numeric ids of Redmine and GitLab, are skipped rather than failing.
+func TestIssuesHandler_SkipsIssueIDsOfOtherTrackers(t *testing.T) {
+	server := newRedmineTestServer()
+	defer server.Close()
+	redmineClient, err := redmine.NewClient(logrus.New(), server.URL, "api-key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	trackers := map[string]IssueTracker{
+		"group/redmine": NewRedmineTracker(redmineClient),
+		"group/gitlab":  NewGitLabTracker(&mockGitLabIssuesClient{}, &gitlab.Project{ID: 1}),
+	}
+	h := NewIssues(func(project *gitlab.Project) IssueTracker {
+		return trackers[project.PathWithNamespace]
+	}, testIssueKeyExtractor, 0)
+	for project := range trackers {
+		webhook := newTitleWebhook("XYZ-982: Title")
+		webhook.Project.PathWithNamespace = project
+		msg, err := h.HandleMergeRequest(context.Background(), webhook)
+		if err != nil || msg != "" {
+			t.Errorf("Expected no msg and no error for project '%s', was '%s', %+v", project, msg, err)
+		}
+	}
+}
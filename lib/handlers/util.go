@@ -2,7 +2,6 @@ package handlers
 
 import (
 	"context"
-	"regexp"
 	"strings"
 
 	"github.com/verath/mrgitlab/lib/gitlab"
@@ -17,6 +16,87 @@ func (f MergeRequestHandlerFunc) HandleMergeRequest(ctx context.Context, webhook
 	return f(ctx, webhook)
 }
 
+// PipelineHandlerFunc is a wrapper allowing a func to implement the
+// PipelineHandler interface
+type PipelineHandlerFunc func(context.Context, *gitlab.PipelineWebhook) (string, error)
+
+// HandlePipeline implements the PipelineHandler by calling itself.
+func (f PipelineHandlerFunc) HandlePipeline(ctx context.Context, webhook *gitlab.PipelineWebhook) (string, error) {
+	return f(ctx, webhook)
+}
+
+// PushHandlerFunc is a wrapper allowing a func to implement the
+// PushHandler interface
+type PushHandlerFunc func(context.Context, *gitlab.PushWebhook) error
+
+// HandlePush implements the PushHandler by calling itself.
+func (f PushHandlerFunc) HandlePush(ctx context.Context, webhook *gitlab.PushWebhook) error {
+	return f(ctx, webhook)
+}
+
+// TagPushHandlerFunc is a wrapper allowing a func to implement the
+// TagPushHandler interface
+type TagPushHandlerFunc func(context.Context, *gitlab.TagPushWebhook) error
+
+// HandleTagPush implements the TagPushHandler by calling itself.
+func (f TagPushHandlerFunc) HandleTagPush(ctx context.Context, webhook *gitlab.TagPushWebhook) error {
+	return f(ctx, webhook)
+}
+
+// IssueHandlerFunc is a wrapper allowing a func to implement the
+// IssueHandler interface
+type IssueHandlerFunc func(context.Context, *gitlab.IssueWebhook) error
+
+// HandleIssue implements the IssueHandler by calling itself.
+func (f IssueHandlerFunc) HandleIssue(ctx context.Context, webhook *gitlab.IssueWebhook) error {
+	return f(ctx, webhook)
+}
+
+// NoteHandlerFunc is a wrapper allowing a func to implement the
+// NoteHandler interface
+type NoteHandlerFunc func(context.Context, *gitlab.NoteWebhook) error
+
+// HandleNote implements the NoteHandler by calling itself.
+func (f NoteHandlerFunc) HandleNote(ctx context.Context, webhook *gitlab.NoteWebhook) error {
+	return f(ctx, webhook)
+}
+
+// JobHandlerFunc is a wrapper allowing a func to implement the
+// JobHandler interface
+type JobHandlerFunc func(context.Context, *gitlab.JobWebhook) error
+
+// HandleJob implements the JobHandler by calling itself.
+func (f JobHandlerFunc) HandleJob(ctx context.Context, webhook *gitlab.JobWebhook) error {
+	return f(ctx, webhook)
+}
+
+// WikiPageHandlerFunc is a wrapper allowing a func to implement the
+// WikiPageHandler interface
+type WikiPageHandlerFunc func(context.Context, *gitlab.WikiPageWebhook) error
+
+// HandleWikiPage implements the WikiPageHandler by calling itself.
+func (f WikiPageHandlerFunc) HandleWikiPage(ctx context.Context, webhook *gitlab.WikiPageWebhook) error {
+	return f(ctx, webhook)
+}
+
+// DeploymentHandlerFunc is a wrapper allowing a func to implement the
+// DeploymentHandler interface
+type DeploymentHandlerFunc func(context.Context, *gitlab.DeploymentWebhook) error
+
+// HandleDeployment implements the DeploymentHandler by calling itself.
+func (f DeploymentHandlerFunc) HandleDeployment(ctx context.Context, webhook *gitlab.DeploymentWebhook) error {
+	return f(ctx, webhook)
+}
+
+// ReleaseHandlerFunc is a wrapper allowing a func to implement the
+// ReleaseHandler interface
+type ReleaseHandlerFunc func(context.Context, *gitlab.ReleaseWebhook) error
+
+// HandleRelease implements the ReleaseHandler by calling itself.
+func (f ReleaseHandlerFunc) HandleRelease(ctx context.Context, webhook *gitlab.ReleaseWebhook) error {
+	return f(ctx, webhook)
+}
+
 // markdownQuote takes a text as input and adds `> ` in front of each line,
 // making the text render as a quote in markdown. Returns an empty string
 // if the provided text is empty or the provided text only contains whitespace.
@@ -30,34 +110,3 @@ func markdownQuote(text string) string {
 	}
 	return strings.Join(lines, "\n")
 }
-
-var gitLabReferenceReplaceTables = []struct {
-	pattern *regexp.Regexp
-	replace string
-}{
-	// @ user mention
-	{regexp.MustCompile(`@(\w+)`), "`@`$1"},
-	// # issue
-	{regexp.MustCompile(`#(\d+)`), "`#`$1"},
-	// ! merge request
-	{regexp.MustCompile(`!(\d+)`), "`!`$1"},
-	// $ snippet
-	{regexp.MustCompile(`\$(\d+)`), "`$$`$1"},
-	// ~ label
-	{regexp.MustCompile(`~((\w|"|')+)`), "`~`$1"},
-	// % milestone
-	{regexp.MustCompile(`%((\w|"|')+)`), "`%`$1"},
-}
-
-// filterGitLabReferences takes a text and "escapes" any GitLab
-// special references in it by putting them in an inline code
-// block. E.g. "@user" -> "`@`user", "!123" -> "`!`123"
-// See https://docs.gitlab.com/ee/user/markdown.html#special-gitlab-references
-// Note: this should only be considered a best effort, bypassing this
-// filter is certainly possible.
-func filterGitLabReferences(text string) string {
-	for _, rep := range gitLabReferenceReplaceTables {
-		text = rep.pattern.ReplaceAllString(text, rep.replace)
-	}
-	return text
-}
@@ -2,11 +2,9 @@ package handlers
 
 import (
 	"context"
-	"fmt"
 	"net/http"
 	"net/url"
 
-	"github.com/pkg/errors"
 	"github.com/verath/mrgitlab/lib/gitlab"
 	"github.com/verath/mrgitlab/lib/youtrack"
 )
@@ -17,59 +15,81 @@ import (
 type youTrackClient interface {
 	GetIssue(ctx context.Context, issueID string) (*youtrack.Issue, error)
 	GetIssueURL(ctx context.Context, issueID string) (*url.URL, error)
+	AddComment(ctx context.Context, issueID string, text string) error
+	ExecuteCommand(ctx context.Context, issueID string, command string) error
 }
 
-// youtrackWebhookFilterFunc is a function that, given a webhook, returns the YouTrack
-// issue id associated with it. If no id could be extracted from the webhook, the
-// function should return an empty string.
-type youtrackWebhookFilterFunc func(webhook *gitlab.MergeRequestWebhook) (issueID string)
+// youTrackTracker is the IssueTracker of a youTrackClient.
+type youTrackTracker struct {
+	client youTrackClient
+}
 
-// NewYouTrack creates a new MergeRequestHandlerFunc that uses the provided YouTrackClient
-// to lookup the YouTrack issue associated with a merge request and adds the issue
-// data to the merge request comment. The filter parameter specifies a filter that is
-// used to discard merge requests that are not associated with YouTrack.
-func NewYouTrack(client youTrackClient, filter youtrackWebhookFilterFunc) MergeRequestHandlerFunc {
-	if client == nil || filter == nil {
-		panic("client and filter must not be nil")
+// NewYouTrackTracker creates an IssueTracker for the issues of the YouTrack
+// server of the client. Issues are transitioned by applying the transition
+// as a YouTrack command, e.g. "State Fixed".
+func NewYouTrackTracker(client youTrackClient) IssueTracker {
+	if client == nil {
+		panic("client must not be nil")
 	}
-	return MergeRequestHandlerFunc(func(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
-		issueID := filter(webhook)
-		if issueID == "" {
-			return "", nil
-		}
-		issueURL, err := client.GetIssueURL(ctx, issueID)
-		if err != nil {
-			return "", errors.Wrapf(err, "could not resolve issue URL for issueID '%s'", issueID)
-		}
-		issue, err := client.GetIssue(ctx, issueID)
-		if err != nil {
-			if youtrack.IsHTTPStatusError(err, http.StatusNotFound) {
-				// We don't treat not found as an error as it could just
-				// be that the branch name just looked like a youtrack id.
-				return "", nil
-			}
-			return "", errors.Wrapf(err, "could not get issue for issueID '%s'", issueID)
-		}
-		issueSummary, err := issue.FieldStringValue("summary")
-		if err != nil {
-			return "", errors.Wrap(err, "could not get value for 'summary'")
+	return &youTrackTracker{client: client}
+}
+
+// GetIssue implements the IssueTracker interface. The description of the
+// issue is converted from YouTrack wiki markup or Markdown to GitLab Markdown.
+func (t *youTrackTracker) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
+	issue, err := t.client.GetIssue(ctx, issueID)
+	if err != nil {
+		if youtrack.IsHTTPStatusError(err, http.StatusNotFound) {
+			// We don't treat not found as an error as it could just
+			// be that the issue key just looked like a youtrack id.
+			return nil, nil
 		}
-		issueDescription, err := issue.FieldStringValue("description")
-		if err != nil {
-			// We don't see the description missing as an error as
-			// description is not a mandatory field in YouTrack.
-			issueDescription = ""
+		return nil, err
+	}
+	result := &Issue{
+		ID:          issue.ID,
+		Summary:     issue.Summary,
+		Description: convertYoutrackMarkup(issue.Description),
+		State:       issue.State,
+		Parent:      issue.Parent(),
+	}
+	if issue.Assignee != nil {
+		result.Assignee = issue.Assignee.FullName
+		if result.Assignee == "" {
+			result.Assignee = issue.Assignee.Login
 		}
-		// We filter special GitLab reference here, so that we don't accidentally
-		// spam users by mentioning them in the comment
-		issueSummary = filterGitLabReferences(issueSummary)
-		issueDescription = filterGitLabReferences(issueDescription)
-		issueDescription = markdownQuote(issueDescription)
-		issueTitle := issueID + ": " + issueSummary
-		return fmt.Sprintf(""+
-			"# %s\n"+
-			"%s\n\n"+
-			"%s\n",
-			issueTitle, issueURL, issueDescription), nil
-	})
+	}
+	return result, nil
+}
+
+// GetIssueURL implements the IssueTracker interface.
+func (t *youTrackTracker) GetIssueURL(ctx context.Context, issueID string) (*url.URL, error) {
+	return t.client.GetIssueURL(ctx, issueID)
+}
+
+// AddComment implements the IssueTracker interface.
+func (t *youTrackTracker) AddComment(ctx context.Context, issueID string, text string) error {
+	return t.client.AddComment(ctx, issueID, text)
+}
+
+// TransitionIssue implements the IssueTracker interface, applying the
+// transition as a YouTrack command.
+func (t *youTrackTracker) TransitionIssue(ctx context.Context, issueID string, transition string) error {
+	return t.client.ExecuteCommand(ctx, issueID, transition)
+}
+
+// NewYouTrack creates a new MergeRequestHandlerFunc that uses the provided YouTrackClient
+// to lookup the YouTrack issues associated with a merge request and adds the issue
+// data to the merge request comment. The issue keys referenced by the merge request
+// are found using the extractor, and keys that are not existing YouTrack issues are
+// skipped. Merge requests without any existing issue are ignored. The descriptions
+// of the issues are converted to GitLab Markdown, and truncated to at most
+// maxDescriptionLength characters, followed by a link to the issue. Descriptions
+// are not truncated if maxDescriptionLength is zero.
+func NewYouTrack(client youTrackClient, extractor *IssueKeyExtractor, maxDescriptionLength int) MergeRequestHandlerFunc {
+	if client == nil || extractor == nil {
+		panic("client and extractor must not be nil")
+	}
+	tracker := NewYouTrackTracker(client)
+	return NewIssues(func(*gitlab.Project) IssueTracker { return tracker }, extractor, maxDescriptionLength)
 }
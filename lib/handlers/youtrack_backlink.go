@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/youtrack"
+)
+
+// youTrackCommentClient is an interface abstracting the API calls of the
+// YouTrack client for finding and updating existing comments, which the
+// IssueTracker interface has no calls for, so that we can do unit tests
+// against a non-network implementation.
+type youTrackCommentClient interface {
+	CurrentUserLogin(ctx context.Context) (string, error)
+	GetComments(ctx context.Context, issueID string) ([]*youtrack.Comment, error)
+	UpdateComment(ctx context.Context, issueID string, commentID string, text string) error
+}
+
+// NewYouTrackBackLink creates a new MergeRequestHandlerFunc that adds a comment,
+// linking back to the merge request, on each of the YouTrack issues referenced
+// by the merge request. The comment includes the title, URL and author of the
+// merge request. The comment is found by its author, the user of the client,
+// and the URL of the merge request, so that an issue that already has a comment
+// for the merge request gets that comment updated instead of a new one added.
+// New comments are added through the tracker, and existing comments are found
+// and updated using the client. The handler never adds a message to the merge
+// request note.
+func NewYouTrackBackLink(tracker IssueTracker, client youTrackCommentClient, extractor *IssueKeyExtractor) MergeRequestHandlerFunc {
+	if tracker == nil || client == nil || extractor == nil {
+		panic("tracker, client and extractor must not be nil")
+	}
+	return MergeRequestHandlerFunc(func(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
+		issueIDs, err := extractor.Extract(ctx, webhook)
+		if err != nil {
+			return "", err
+		}
+		if len(issueIDs) == 0 || webhook.ObjectAttributes.URL == "" {
+			return "", nil
+		}
+		login, err := client.CurrentUserLogin(ctx)
+		if err != nil {
+			return "", errors.Wrap(err, "could not get the login of the YouTrack user")
+		}
+		text := youtrackBackLinkText(webhook)
+		for _, issueID := range issueIDs {
+			if err := upsertYoutrackBackLink(ctx, tracker, client, issueID, login, webhook.ObjectAttributes.URL, text); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	})
+}
+
+// upsertYoutrackBackLink updates the comment by the user with the login and
+// containing the mergeRequestURL on the issue identified by issueID to the
+// text, or adds the text as a new comment if there is no such comment. The
+// comments of other users are never updated, even if they link to the merge
+// request. Issues that do not exist are skipped.
+func upsertYoutrackBackLink(ctx context.Context, tracker IssueTracker, client youTrackCommentClient, issueID string, login string, mergeRequestURL string, text string) error {
+	comments, err := client.GetComments(ctx, issueID)
+	if err != nil {
+		if youtrack.IsHTTPStatusError(err, http.StatusNotFound) {
+			// Not an error, the issue key just looked like a youtrack id
+			return nil
+		}
+		return errors.Wrapf(err, "could not get comments for issueID '%s'", issueID)
+	}
+	for _, comment := range comments {
+		if comment.Author != login || !strings.Contains(comment.Text, mergeRequestURL) {
+			continue
+		}
+		if comment.Text == text {
+			return nil
+		}
+		err := client.UpdateComment(ctx, issueID, comment.ID, text)
+		return errors.Wrapf(err, "could not update comment '%s' for issueID '%s'", comment.ID, issueID)
+	}
+	err = tracker.AddComment(ctx, issueID, text)
+	return errors.Wrapf(err, "could not add comment for issueID '%s'", issueID)
+}
+
+// linkTextReplacer escapes the backslashes, brackets and parentheses of the
+// text of a Markdown link, which would otherwise end the link text early.
+var linkTextReplacer = strings.NewReplacer("\\", "\\\\", "[", "\\[", "]", "\\]", "(", "\\(", ")", "\\)")
+
+// youtrackBackLinkText returns the text of the comment linking back to
+// the merge request of the webhook. The title of the merge request is
+// sanitized, so that it neither mentions users nor breaks the link.
+func youtrackBackLinkText(webhook *gitlab.MergeRequestWebhook) string {
+	attrs := webhook.ObjectAttributes
+	title := linkTextReplacer.Replace(sanitizeInlineMarkdown(attrs.Title))
+	text := fmt.Sprintf("Merge request [!%d %s](%s)", attrs.IID, title, attrs.URL)
+	if author := mergeRequestAuthor(webhook); author != "" {
+		text += " by " + author
+	}
+	return text
+}
+
+// mergeRequestAuthor returns the name and username of the author of the
+// merge request of the webhook, e.g. "Jane Doe (jane)", or empty if not
+// known. The user of the webhook is used as the author, as the backlink
+// handlers are meant to be run when the merge request is opened, which is
+// done by its author.
+func mergeRequestAuthor(webhook *gitlab.MergeRequestWebhook) string {
+	author := webhook.User.Name
+	if author == "" {
+		author = webhook.User.Username
+	} else if webhook.User.Username != "" {
+		author = fmt.Sprintf("%s (%s)", author, webhook.User.Username)
+	}
+	return author
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+	"github.com/verath/mrgitlab/lib/youtrack"
+)
+
+// mock implementation of the youTrackCommentClient and IssueTracker
+// interfaces, storing the comments of each issue. Comments are added by
+// the user "bot".
+type mockYouTrackCommentClient struct {
+	comments map[string][]*youtrack.Comment
+	added    int
+	updated  int
+}
+
+func (c *mockYouTrackCommentClient) CurrentUserLogin(ctx context.Context) (string, error) {
+	return "bot", nil
+}
+
+func (c *mockYouTrackCommentClient) GetComments(ctx context.Context, issueID string) ([]*youtrack.Comment, error) {
+	return c.comments[issueID], nil
+}
+
+func (c *mockYouTrackCommentClient) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
+	return &Issue{ID: issueID}, nil
+}
+
+func (c *mockYouTrackCommentClient) GetIssueURL(ctx context.Context, issueID string) (*url.URL, error) {
+	return url.Parse("http://youtrack.test/issue/" + issueID)
+}
+
+func (c *mockYouTrackCommentClient) TransitionIssue(ctx context.Context, issueID string, transition string) error {
+	return nil
+}
+
+func (c *mockYouTrackCommentClient) AddComment(ctx context.Context, issueID string, text string) error {
+	c.added++
+	c.comments[issueID] = append(c.comments[issueID], &youtrack.Comment{ID: issueID, Text: text, Author: "bot"})
+	return nil
+}
+
+func (c *mockYouTrackCommentClient) UpdateComment(ctx context.Context, issueID string, commentID string, text string) error {
+	for _, comment := range c.comments[issueID] {
+		if comment.ID == commentID {
+			c.updated++
+			comment.Text = text
+			return nil
+		}
+	}
+	return errors.Errorf("no comment '%s'", commentID)
+}
+
+// newBackLinkWebhook returns a merge request webhook with the given title,
+// opened by "Jane Doe".
+func newBackLinkWebhook(title string) *gitlab.MergeRequestWebhook {
+	webhook := newTitleWebhook(title)
+	webhook.ObjectAttributes.IID = 12
+	webhook.ObjectAttributes.URL = "https://gitlab.example.com/group/project/merge_requests/12"
+	webhook.User.Name = "Jane Doe"
+	webhook.User.Username = "jane"
+	return webhook
+}
+
+func TestYouTrackBackLinkHandler(t *testing.T) {
+	client := &mockYouTrackCommentClient{comments: map[string][]*youtrack.Comment{
+		"ISSUE-1": {{ID: "1", Text: "Unrelated comment"}},
+	}}
+	h := NewYouTrackBackLink(client, client, testIssueKeyExtractor)
+	webhook := newBackLinkWebhook("ISSUE-1 ISSUE-2: Title")
+	msg, err := h.HandleMergeRequest(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("Unexpected error handling merge request: %+v", err)
+	}
+	if msg != "" {
+		t.Errorf("Expected msg to be empty, was '%s'", msg)
+	}
+	if client.added != 2 {
+		t.Errorf("Expected 2 comments to be added, was: %d", client.added)
+	}
+	expected := "Merge request [!12 ISSUE-1 ISSUE-2: Title]" +
+		"(https://gitlab.example.com/group/project/merge_requests/12) by Jane Doe (jane)"
+	if comments := client.comments["ISSUE-2"]; len(comments) != 1 || comments[0].Text != expected {
+		t.Errorf("Expected a comment '%s', was: %+v", expected, comments)
+	}
+}
+
+// Test that the comment of the merge request is updated, instead of
+// another comment being added, when the handler is run again.
+func TestYouTrackBackLinkHandler_UpdatesComment(t *testing.T) {
+	client := &mockYouTrackCommentClient{comments: map[string][]*youtrack.Comment{}}
+	h := NewYouTrackBackLink(client, client, testIssueKeyExtractor)
+	for _, title := range []string{"ISSUE-1: Title", "ISSUE-1: Title", "ISSUE-1: New title"} {
+		if _, err := h.HandleMergeRequest(context.Background(), newBackLinkWebhook(title)); err != nil {
+			t.Fatalf("Unexpected error handling merge request: %+v", err)
+		}
+	}
+	if client.added != 1 || client.updated != 1 {
+		t.Errorf("Expected 1 added and 1 updated comment, was: %d and %d", client.added, client.updated)
+	}
+	comments := client.comments["ISSUE-1"]
+	if len(comments) != 1 || !strings.Contains(comments[0].Text, "New title") {
+		t.Errorf("Expected the comment to be updated, was: %+v", comments)
+	}
+}
+
+// Test that a comment linking to the merge request, but written by another
+// user than the one of the client, is not updated.
+func TestYouTrackBackLinkHandler_IgnoresCommentsOfOtherUsers(t *testing.T) {
+	userText := "See https://gitlab.example.com/group/project/merge_requests/12"
+	client := &mockYouTrackCommentClient{comments: map[string][]*youtrack.Comment{
+		"ISSUE-1": {{ID: "1", Text: userText, Author: "jane"}},
+	}}
+	h := NewYouTrackBackLink(client, client, testIssueKeyExtractor)
+	if _, err := h.HandleMergeRequest(context.Background(), newBackLinkWebhook("ISSUE-1: Title")); err != nil {
+		t.Fatalf("Unexpected error handling merge request: %+v", err)
+	}
+	if client.added != 1 || client.updated != 0 {
+		t.Errorf("Expected 1 added and 0 updated comments, was: %d and %d", client.added, client.updated)
+	}
+	if comments := client.comments["ISSUE-1"]; len(comments) != 2 || comments[0].Text != userText {
+		t.Errorf("Expected the comment of the user to be kept, was: %+v", comments)
+	}
+}
+
+func TestYouTrackBackLinkText_EscapesTitle(t *testing.T) {
+	webhook := newBackLinkWebhook("ISSUE-1: Fix [x](y) for @all")
+	expected := "Merge request [!12 ISSUE-1: Fix \\[x\\]\\(y\\) for `@`all]" +
+		"(https://gitlab.example.com/group/project/merge_requests/12) by Jane Doe (jane)"
+	if text := youtrackBackLinkText(webhook); text != expected {
+		t.Errorf("Expected text '%s', was '%s'", expected, text)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// YouTrackCommand is a YouTrack command, e.g. "State Fixed", applied to the
+// issues referenced by merge requests targeting some branches.
+type YouTrackCommand struct {
+	// TargetBranch is a pattern, e.g. "release/*", of the target branches
+	// the command is applied for. The pattern uses the syntax of path.Match.
+	TargetBranch string
+	// Command is the YouTrack command.
+	Command string
+}
+
+// NewYouTrackCommand creates a new MergeRequestHandlerFunc that applies a YouTrack
+// command to each of the issues of the YouTrack tracker referenced by the merge
+// request, as found by the extractor. The command is applied as the transition of
+// the issue, see NewYouTrackTracker. The command applied is that of the first of
+// the commands with a TargetBranch matching the target branch of the merge request,
+// and merge requests targeting other branches are ignored. Keys that are not
+// existing YouTrack issues are skipped. The message lists the issues the command
+// was applied to. If dryRun is true, the commands are not applied, but the message
+// lists the issues they would have been applied to.
+//
+// Commands are not necessarily idempotent, so an issue the command failed for does
+// not stop the command from being applied to the other issues. If the command was
+// applied to some issues, the failures are listed in the message instead of being
+// returned as an error, so that the handler is not retried. Only if the command
+// failed for every issue is the error of the first failure returned.
+func NewYouTrackCommand(tracker IssueTracker, extractor *IssueKeyExtractor, commands []YouTrackCommand, dryRun bool) MergeRequestHandlerFunc {
+	if tracker == nil || extractor == nil {
+		panic("tracker and extractor must not be nil")
+	}
+	return MergeRequestHandlerFunc(func(ctx context.Context, webhook *gitlab.MergeRequestWebhook) (string, error) {
+		command, ok := youtrackCommandForBranch(commands, webhook.ObjectAttributes.TargetBranch)
+		if !ok {
+			return "", nil
+		}
+		issueIDs, err := extractor.Extract(ctx, webhook)
+		if err != nil {
+			return "", err
+		}
+		var appliedIDs []string
+		var failures []error
+		for _, issueID := range issueIDs {
+			applied, err := applyYoutrackCommand(ctx, tracker, issueID, command, dryRun)
+			if err != nil {
+				failures = append(failures, err)
+			} else if applied {
+				appliedIDs = append(appliedIDs, issueID)
+			}
+		}
+		if len(appliedIDs) == 0 {
+			if len(failures) > 0 {
+				return "", failures[0]
+			}
+			return "", nil
+		}
+		var buf bytes.Buffer
+		if dryRun {
+			fmt.Fprintf(&buf, "_Dry run: would apply YouTrack command `%s` to %s_\n",
+				command, strings.Join(appliedIDs, ", "))
+		} else {
+			fmt.Fprintf(&buf, "_Applied YouTrack command `%s` to %s_\n",
+				command, strings.Join(appliedIDs, ", "))
+		}
+		// The failures include text from YouTrack, which is sanitized
+		// like the other tracker text included in the note
+		for _, err := range failures {
+			fmt.Fprintf(&buf, "_Failed: %s_\n", sanitizeInlineMarkdown(err.Error()))
+		}
+		return buf.String(), nil
+	})
+}
+
+// youtrackCommandForBranch returns the command of the first of the commands
+// with a TargetBranch pattern matching the targetBranch.
+func youtrackCommandForBranch(commands []YouTrackCommand, targetBranch string) (string, bool) {
+	for _, command := range commands {
+		if ok, _ := path.Match(command.TargetBranch, targetBranch); ok {
+			return command.Command, true
+		}
+	}
+	return "", false
+}
+
+// applyYoutrackCommand applies the command to the issue identified by issueID,
+// unless dryRun is true. Returns false if no such issue exists.
+func applyYoutrackCommand(ctx context.Context, tracker IssueTracker, issueID string, command string, dryRun bool) (bool, error) {
+	issue, err := tracker.GetIssue(ctx, issueID)
+	if err != nil {
+		return false, errors.Wrapf(err, "could not get issue for issueID '%s'", issueID)
+	}
+	if issue == nil {
+		// Not an error, the issue key just looked like a youtrack id
+		return false, nil
+	}
+	if dryRun {
+		return true, nil
+	}
+	if err := tracker.TransitionIssue(ctx, issueID, command); err != nil {
+		return false, errors.Wrapf(err, "could not apply command '%s' to issueID '%s'", command, issueID)
+	}
+	return true, nil
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+// mock implementation of the IssueTracker interface, recording the
+// commands applied to each issue.
+type mockYouTrackCommandTracker struct {
+	TransitionIssueFunc func(ctx context.Context, issueID string, command string) error
+	commands            map[string]string
+}
+
+func (t *mockYouTrackCommandTracker) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
+	return &Issue{ID: issueID}, nil
+}
+
+func (t *mockYouTrackCommandTracker) GetIssueURL(ctx context.Context, issueID string) (*url.URL, error) {
+	return url.Parse("http://youtrack.test/issue/" + issueID)
+}
+
+func (t *mockYouTrackCommandTracker) AddComment(ctx context.Context, issueID string, text string) error {
+	return nil
+}
+
+func (t *mockYouTrackCommandTracker) TransitionIssue(ctx context.Context, issueID string, command string) error {
+	if t.TransitionIssueFunc != nil {
+		return t.TransitionIssueFunc(ctx, issueID, command)
+	}
+	if t.commands == nil {
+		t.commands = make(map[string]string)
+	}
+	t.commands[issueID] = command
+	return nil
+}
+
+var testYouTrackCommands = []YouTrackCommand{
+	{TargetBranch: "master", Command: "State Fixed"},
+	{TargetBranch: "release/*", Command: "Fixed in build Next"},
+}
+
+func TestYouTrackCommandHandler(t *testing.T) {
+	tests := []struct {
+		targetBranch    string
+		expectedCommand string
+		expectedMessage string
+	}{
+		{"master", "State Fixed", "_Applied YouTrack command `State Fixed` to ISSUE-1, ISSUE-2_\n"},
+		{"release/1.0", "Fixed in build Next", "_Applied YouTrack command `Fixed in build Next` to ISSUE-1, ISSUE-2_\n"},
+		{"develop", "", ""},
+	}
+	for _, test := range tests {
+		tracker := &mockYouTrackCommandTracker{}
+		h := NewYouTrackCommand(tracker, testIssueKeyExtractor, testYouTrackCommands, false)
+		webhook := newTitleWebhook("ISSUE-1 ISSUE-2: Title")
+		webhook.ObjectAttributes.TargetBranch = test.targetBranch
+		msg, err := h.HandleMergeRequest(context.Background(), webhook)
+		if err != nil {
+			t.Fatalf("Unexpected error handling merge request: %+v", err)
+		}
+		if msg != test.expectedMessage {
+			t.Errorf("Expected message '%s' for target branch '%s', was: '%s'",
+				test.expectedMessage, test.targetBranch, msg)
+		}
+		for _, issueID := range []string{"ISSUE-1", "ISSUE-2"} {
+			if tracker.commands[issueID] != test.expectedCommand {
+				t.Errorf("Expected command '%s' for %s and target branch '%s', was: '%s'",
+					test.expectedCommand, issueID, test.targetBranch, tracker.commands[issueID])
+			}
+		}
+	}
+}
+
+func TestYouTrackCommandHandler_DryRun(t *testing.T) {
+	tracker := &mockYouTrackCommandTracker{}
+	h := NewYouTrackCommand(tracker, testIssueKeyExtractor, testYouTrackCommands, true)
+	webhook := newTitleWebhook("ISSUE-1: Title")
+	webhook.ObjectAttributes.TargetBranch = "master"
+	msg, err := h.HandleMergeRequest(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("Unexpected error handling merge request: %+v", err)
+	}
+	expected := "_Dry run: would apply YouTrack command `State Fixed` to ISSUE-1_\n"
+	if msg != expected {
+		t.Errorf("Expected message '%s', was: '%s'", expected, msg)
+	}
+	if len(tracker.commands) != 0 {
+		t.Errorf("Expected no commands to be applied, was: %v", tracker.commands)
+	}
+}
+
+func TestYouTrackCommandHandler_CommandFailure(t *testing.T) {
+	tracker := &mockYouTrackCommandTracker{}
+	tracker.TransitionIssueFunc = func(context.Context, string, string) error {
+		return errors.New("testerr")
+	}
+	h := NewYouTrackCommand(tracker, testIssueKeyExtractor, testYouTrackCommands, false)
+	webhook := newTitleWebhook("ISSUE-1: Title")
+	webhook.ObjectAttributes.TargetBranch = "master"
+	msg, err := h.HandleMergeRequest(context.Background(), webhook)
+	if err == nil {
+		t.Fatal("Expected an error but got nil")
+	}
+	if msg != "" {
+		t.Errorf("Expected msg to be empty, was '%s'", msg)
+	}
+}
+
+// Test that a failure for one issue does not stop the command from being
+// applied to the other issues, and that the failure is listed in the message
+// instead of failing the handler.
+func TestYouTrackCommandHandler_PartialFailure(t *testing.T) {
+	tracker := &mockYouTrackCommandTracker{commands: make(map[string]string)}
+	tracker.TransitionIssueFunc = func(ctx context.Context, issueID string, command string) error {
+		if issueID == "ISSUE-1" {
+			return errors.New("testerr for @all")
+		}
+		tracker.commands[issueID] = command
+		return nil
+	}
+	h := NewYouTrackCommand(tracker, testIssueKeyExtractor, testYouTrackCommands, false)
+	webhook := newTitleWebhook("ISSUE-1 ISSUE-2 ISSUE-3: Title")
+	webhook.ObjectAttributes.TargetBranch = "master"
+	msg, err := h.HandleMergeRequest(context.Background(), webhook)
+	if err != nil {
+		t.Fatalf("Unexpected error handling merge request: %+v", err)
+	}
+	expected := "" +
+		"_Applied YouTrack command `State Fixed` to ISSUE-2, ISSUE-3_\n" +
+		"_Failed: could not apply command 'State Fixed' to issueID 'ISSUE-1': testerr for `@`all_\n"
+	if msg != expected {
+		t.Errorf("Expected message '%s', was: '%s'", expected, msg)
+	}
+	if len(tracker.commands) != 2 {
+		t.Errorf("Expected the command to be applied to 2 issues, was: %v", tracker.commands)
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"context"
 	"encoding/json"
 	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/verath/mrgitlab/lib/gitlab"
@@ -24,6 +28,8 @@ var issueWithoutDescJSON = []byte(`{
 type mockYouTrackClient struct {
 	GetIssueFunc    func(ctx context.Context, issueID string) (*youtrack.Issue, error)
 	GetIssueURLFunc func(ctx context.Context, issueID string) (*url.URL, error)
+	AddCommentFunc  func(ctx context.Context, issueID string, text string) error
+	CommandFunc     func(ctx context.Context, issueID string, command string) error
 }
 
 func (c *mockYouTrackClient) GetIssue(ctx context.Context, issueID string) (*youtrack.Issue, error) {
@@ -34,15 +40,33 @@ func (c *mockYouTrackClient) GetIssueURL(ctx context.Context, issueID string) (*
 	return c.GetIssueURLFunc(ctx, issueID)
 }
 
-// Test that we don't send a message if the branch filter
-// function returns an empty issueID
-func TestYouTrackHandler_NoBranchID(t *testing.T) {
+func (c *mockYouTrackClient) AddComment(ctx context.Context, issueID string, text string) error {
+	return c.AddCommentFunc(ctx, issueID, text)
+}
+
+func (c *mockYouTrackClient) ExecuteCommand(ctx context.Context, issueID string, command string) error {
+	return c.CommandFunc(ctx, issueID, command)
+}
+
+// testIssueKeyExtractor extracts issue keys like "ISSUE-1" from the title.
+var testIssueKeyExtractor = NewIssueKeyExtractor(nil, IssueKeyPattern{
+	Regexp:  regexp.MustCompile(`[A-Z]+-[0-9]+`),
+	Sources: []string{IssueKeySourceTitle},
+})
+
+// newTitleWebhook returns a merge request webhook with the given title.
+func newTitleWebhook(title string) *gitlab.MergeRequestWebhook {
+	webhook := &gitlab.MergeRequestWebhook{}
+	webhook.ObjectAttributes.Title = title
+	return webhook
+}
+
+// Test that we don't send a message if the extractor
+// finds no issue key
+func TestYouTrackHandler_NoIssueKey(t *testing.T) {
 	mockClient := &mockYouTrackClient{}
-	filterFunc := func(*gitlab.MergeRequestWebhook) string {
-		return ""
-	}
-	h := NewYouTrack(mockClient, filterFunc)
-	msg, err := h.HandleMergeRequest(context.Background(), nil)
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("No issue"))
 	if err != nil {
 		t.Fatalf("Unexpected error handling merge request: %+v", err)
 	}
@@ -53,14 +77,14 @@ func TestYouTrackHandler_NoBranchID(t *testing.T) {
 
 func TestYouTrackHandler_NoIssueURL(t *testing.T) {
 	mockClient := &mockYouTrackClient{}
+	mockClient.GetIssueFunc = func(context.Context, string) (*youtrack.Issue, error) {
+		return newTestIssue("Summary", ""), nil
+	}
 	mockClient.GetIssueURLFunc = func(context.Context, string) (*url.URL, error) {
 		return nil, errors.New("testerr")
 	}
-	filterFunc := func(*gitlab.MergeRequestWebhook) string {
-		return "ISSUEID"
-	}
-	h := NewYouTrack(mockClient, filterFunc)
-	msg, err := h.HandleMergeRequest(context.Background(), nil)
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ISSUE-1: Title"))
 	if err == nil {
 		t.Fatal("Expected an error but got nil")
 	}
@@ -77,11 +101,8 @@ func TestYouTrackHandler_FailFetchingIssue(t *testing.T) {
 	mockClient.GetIssueFunc = func(context.Context, string) (*youtrack.Issue, error) {
 		return nil, errors.New("testerr")
 	}
-	filterFunc := func(*gitlab.MergeRequestWebhook) string {
-		return "ISSUEID"
-	}
-	h := NewYouTrack(mockClient, filterFunc)
-	msg, err := h.HandleMergeRequest(context.Background(), nil)
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ISSUE-1: Title"))
 	if err == nil {
 		t.Fatal("Expected an error but got nil")
 	}
@@ -104,12 +125,162 @@ func TestYouTrackHandler_EmptyDescription(t *testing.T) {
 	mockClient.GetIssueFunc = func(context.Context, string) (*youtrack.Issue, error) {
 		return issueWithoutDesc, nil
 	}
-	filterFunc := func(*gitlab.MergeRequestWebhook) string {
-		return "ISSUEID"
-	}
-	h := NewYouTrack(mockClient, filterFunc)
-	_, err := h.HandleMergeRequest(context.Background(), nil)
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	_, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ISSUE-1: Title"))
 	if err != nil {
 		t.Fatalf("Expected no error, but got: %+v", err)
 	}
 }
+
+// newTestIssue returns an issue with the given summary and description.
+func newTestIssue(summary string, description string) *youtrack.Issue {
+	return &youtrack.Issue{Summary: summary, Description: description}
+}
+
+// newTestIssuesClient returns a mockYouTrackClient returning an issue with
+// the issue id as summary for each issue id. The returned func returns the
+// max number of concurrent GetIssue calls.
+func newTestIssuesClient() (*mockYouTrackClient, func() int32) {
+	var running, maxRunning int32
+	mockClient := &mockYouTrackClient{}
+	mockClient.GetIssueURLFunc = func(ctx context.Context, issueID string) (*url.URL, error) {
+		return url.Parse("http://youtrack.test/issue/" + issueID)
+	}
+	mockClient.GetIssueFunc = func(ctx context.Context, issueID string) (*youtrack.Issue, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			max := atomic.LoadInt32(&maxRunning)
+			if n <= max || atomic.CompareAndSwapInt32(&maxRunning, max, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return newTestIssue("Summary of "+issueID, "Description"), nil
+	}
+	return mockClient, func() int32 { return atomic.LoadInt32(&maxRunning) }
+}
+
+func TestYouTrackHandler_MultipleIssuesAsSections(t *testing.T) {
+	mockClient, _ := newTestIssuesClient()
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ISSUE-1 and ISSUE-2"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expected := "" +
+		"# ISSUE-1: Summary of ISSUE-1\n" +
+		"http://youtrack.test/issue/ISSUE-1\n\n" +
+		"> Description\n" +
+		"# ISSUE-2: Summary of ISSUE-2\n" +
+		"http://youtrack.test/issue/ISSUE-2\n\n" +
+		"> Description\n"
+	if msg != expected {
+		t.Errorf("Expected msg '%s', was '%s'", expected, msg)
+	}
+}
+
+// Test that many issues are rendered as a table, in the order of the
+// issue keys, and that no more than the max number of issues are
+// fetched concurrently.
+func TestYouTrackHandler_ManyIssuesAsTable(t *testing.T) {
+	mockClient, maxRunning := newTestIssuesClient()
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	title := "ISSUE-1 ISSUE-2 ISSUE-3 ISSUE-4 ISSUE-5 ISSUE-6 ISSUE-7 ISSUE-8"
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook(title))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(msg), "\n")
+	if len(lines) != 10 {
+		t.Fatalf("Expected a table of 10 lines, was: '%s'", msg)
+	}
+	if lines[2] != "| [ISSUE-1](http://youtrack.test/issue/ISSUE-1) | Summary of ISSUE-1 |" {
+		t.Errorf("Unexpected first row: '%s'", lines[2])
+	}
+	if !strings.HasPrefix(lines[9], "| [ISSUE-8]") {
+		t.Errorf("Unexpected last row: '%s'", lines[9])
+	}
+	if max := maxRunning(); max > maxConcurrentIssueFetches {
+		t.Errorf("Expected at most %d concurrent fetches, was: %d", maxConcurrentIssueFetches, max)
+	}
+}
+
+// Test that pipes and line breaks in summaries do not break the table rows.
+func TestIssuesTable_EscapesSummary(t *testing.T) {
+	issueURL, _ := url.Parse("http://youtrack.test/issue/ISSUE-1")
+	issues := []*noteIssue{{ID: "ISSUE-1", URL: issueURL, Summary: "a | b\r\nc\nd\re"}}
+	expected := "" +
+		"| Issue | Summary |\n" +
+		"|-------|---------|\n" +
+		"| [ISSUE-1](http://youtrack.test/issue/ISSUE-1) | a \\| b c d e |\n"
+	if table := issuesTable(issues); table != expected {
+		t.Errorf("Expected table '%s', was '%s'", expected, table)
+	}
+}
+
+func TestYouTrackHandler_FailingIssueFailsAll(t *testing.T) {
+	mockClient, _ := newTestIssuesClient()
+	getIssue := mockClient.GetIssueFunc
+	mockClient.GetIssueFunc = func(ctx context.Context, issueID string) (*youtrack.Issue, error) {
+		if issueID == "ISSUE-2" {
+			return nil, errors.New("testerr")
+		}
+		return getIssue(ctx, issueID)
+	}
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	_, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ISSUE-1 ISSUE-2 ISSUE-3"))
+	if err == nil || !strings.Contains(err.Error(), "ISSUE-2") {
+		t.Errorf("Expected error for ISSUE-2, got: %v", err)
+	}
+}
+
+// Test that the state, assignee and parent of an issue are included
+// in its section.
+func TestYouTrackHandler_IssueDetails(t *testing.T) {
+	mockClient, _ := newTestIssuesClient()
+	mockClient.GetIssueFunc = func(ctx context.Context, issueID string) (*youtrack.Issue, error) {
+		issue := newTestIssue("Summary", "Description")
+		issue.State = "In Progress"
+		issue.Assignee = &youtrack.User{Login: "jsmith", FullName: "John Smith"}
+		issue.Links = []youtrack.IssueLink{{Role: "subtask of", Type: "Subtask", IssueID: "ISSUE-0"}}
+		return issue, nil
+	}
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 0)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ISSUE-1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expected := "" +
+		"# ISSUE-1: Summary\n" +
+		"http://youtrack.test/issue/ISSUE-1\n\n" +
+		"**State:** In Progress · **Assignee:** John Smith · " +
+		"**Parent:** [ISSUE-0](http://youtrack.test/issue/ISSUE-0)\n\n" +
+		"> Description\n"
+	if msg != expected {
+		t.Errorf("Expected msg '%s', was '%s'", expected, msg)
+	}
+}
+
+// Test that wiki descriptions are converted and truncated.
+func TestYouTrackHandler_ConvertsDescription(t *testing.T) {
+	mockClient, _ := newTestIssuesClient()
+	mockClient.GetIssueFunc = func(ctx context.Context, issueID string) (*youtrack.Issue, error) {
+		return newTestIssue("Summary", "==Description==\nSome *bold* text\nMore text"), nil
+	}
+	h := NewYouTrack(mockClient, testIssueKeyExtractor, 40)
+	msg, err := h.HandleMergeRequest(context.Background(), newTitleWebhook("ISSUE-1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %+v", err)
+	}
+	expected := "" +
+		"# ISSUE-1: Summary\n" +
+		"http://youtrack.test/issue/ISSUE-1\n\n" +
+		"> ## Description\n" +
+		"> Some **bold** text\n" +
+		"> \n" +
+		"> [Read more](http://youtrack.test/issue/ISSUE-1)\n"
+	if msg != expected {
+		t.Errorf("Expected msg '%s', was '%s'", expected, msg)
+	}
+}
@@ -0,0 +1,144 @@
+package mrgitlab
+
+import (
+	"context"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// HandlerSet is a set of handlers, registered for the webhooks they handle.
+// The handlers of an App are kept in a HandlerSet, but a HandlerSet can also
+// be built separately and then swapped in using App.ReplaceHandlers, e.g.
+// when reloading the configuration.
+type HandlerSet struct {
+	// mergeRequest is a map from a merge request webhook action
+	// (i.e. "open", "close", ...) to a slice of handlers for that action.
+	mergeRequest map[string][]mergeRequestRegistration
+	// pipeline is a map from a pipeline status (i.e. "failed",
+	// "success", ...) to a slice of handlers for that status.
+	pipeline   map[string][]pipelineRegistration
+	push       []eventRegistration
+	tagPush    []eventRegistration
+	issue      []eventRegistration
+	note       []eventRegistration
+	job        []eventRegistration
+	wikiPage   []eventRegistration
+	deployment []eventRegistration
+	release    []eventRegistration
+}
+
+// mergeRequestRegistration is a registered MergeRequestHandler together
+// with the options it was registered with.
+type mergeRequestRegistration struct {
+	handler MergeRequestHandler
+	options handlerOptions
+}
+
+// pipelineRegistration is a registered PipelineHandler together with the
+// options it was registered with.
+type pipelineRegistration struct {
+	handler PipelineHandler
+	options handlerOptions
+}
+
+// NewHandlerSet creates a new, empty, HandlerSet.
+func NewHandlerSet() *HandlerSet {
+	return &HandlerSet{
+		mergeRequest: make(map[string][]mergeRequestRegistration),
+		pipeline:     make(map[string][]pipelineRegistration),
+	}
+}
+
+// RegisterMergeRequestHandler registers a MergeRequestHandler to the specified
+// action. See App.RegisterMergeRequestHandler.
+func (set *HandlerSet) RegisterMergeRequestHandler(action string, handler MergeRequestHandler, opts ...HandlerOption) {
+	registration := mergeRequestRegistration{handler, newHandlerOptions(handler, opts)}
+	set.mergeRequest[action] = append(set.mergeRequest[action], registration)
+}
+
+// RegisterPipelineHandler registers a PipelineHandler to the specified pipeline
+// status. See App.RegisterPipelineHandler.
+func (set *HandlerSet) RegisterPipelineHandler(status string, handler PipelineHandler, opts ...HandlerOption) {
+	registration := pipelineRegistration{handler, newHandlerOptions(handler, opts)}
+	set.pipeline[status] = append(set.pipeline[status], registration)
+}
+
+// RegisterPushHandler registers a PushHandler. See App.RegisterPushHandler.
+func (set *HandlerSet) RegisterPushHandler(handler PushHandler, opts ...HandlerOption) {
+	set.push = append(set.push, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandlePush(ctx, webhook.(*gitlab.PushWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
+
+// RegisterTagPushHandler registers a TagPushHandler. See App.RegisterTagPushHandler.
+func (set *HandlerSet) RegisterTagPushHandler(handler TagPushHandler, opts ...HandlerOption) {
+	set.tagPush = append(set.tagPush, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandleTagPush(ctx, webhook.(*gitlab.TagPushWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
+
+// RegisterIssueHandler registers an IssueHandler. See App.RegisterIssueHandler.
+func (set *HandlerSet) RegisterIssueHandler(handler IssueHandler, opts ...HandlerOption) {
+	set.issue = append(set.issue, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandleIssue(ctx, webhook.(*gitlab.IssueWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
+
+// RegisterNoteHandler registers a NoteHandler. See App.RegisterNoteHandler.
+func (set *HandlerSet) RegisterNoteHandler(handler NoteHandler, opts ...HandlerOption) {
+	set.note = append(set.note, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandleNote(ctx, webhook.(*gitlab.NoteWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
+
+// RegisterJobHandler registers a JobHandler. See App.RegisterJobHandler.
+func (set *HandlerSet) RegisterJobHandler(handler JobHandler, opts ...HandlerOption) {
+	set.job = append(set.job, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandleJob(ctx, webhook.(*gitlab.JobWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
+
+// RegisterWikiPageHandler registers a WikiPageHandler. See App.RegisterWikiPageHandler.
+func (set *HandlerSet) RegisterWikiPageHandler(handler WikiPageHandler, opts ...HandlerOption) {
+	set.wikiPage = append(set.wikiPage, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandleWikiPage(ctx, webhook.(*gitlab.WikiPageWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
+
+// RegisterDeploymentHandler registers a DeploymentHandler. See App.RegisterDeploymentHandler.
+func (set *HandlerSet) RegisterDeploymentHandler(handler DeploymentHandler, opts ...HandlerOption) {
+	set.deployment = append(set.deployment, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandleDeployment(ctx, webhook.(*gitlab.DeploymentWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
+
+// RegisterReleaseHandler registers a ReleaseHandler. See App.RegisterReleaseHandler.
+func (set *HandlerSet) RegisterReleaseHandler(handler ReleaseHandler, opts ...HandlerOption) {
+	set.release = append(set.release, eventRegistration{
+		handle: func(ctx context.Context, webhook interface{}) error {
+			return handler.HandleRelease(ctx, webhook.(*gitlab.ReleaseWebhook))
+		},
+		options: newHandlerOptions(handler, opts),
+	})
+}
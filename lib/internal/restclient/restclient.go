@@ -0,0 +1,96 @@
+// Package restclient implements the plumbing shared by the clients of the
+// JSON REST APIs, i.e. building JSON requests, performing them and the
+// errors returned for responses with unexpected status codes.
+package restclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/redact"
+)
+
+// HTTPError is the error returned for http requests whose responses
+// are not of an expected status code.
+type HTTPError struct {
+	StatusCode int
+}
+
+// NewHTTPError returns a new HTTPError for the given response.
+func NewHTTPError(res *http.Response) HTTPError {
+	return HTTPError{StatusCode: res.StatusCode}
+}
+
+// Error implements the error interface
+func (err HTTPError) Error() string {
+	return fmt.Sprintf("bad status code: %d", err.StatusCode)
+}
+
+// Temporary returns true if the status code indicates a failure that
+// might not occur if the request is retried, i.e. a server error or
+// the request being rate limited.
+func (err HTTPError) Temporary() bool {
+	return err.StatusCode >= 500 || err.StatusCode == http.StatusTooManyRequests
+}
+
+// IsHTTPStatusError returns true if the cause of the given error was
+// an HTTPError with the given statusCode.
+func IsHTTPStatusError(err error, statusCode int) bool {
+	httpErr, ok := errors.Cause(err).(HTTPError)
+	return ok && httpErr.StatusCode == statusCode
+}
+
+// NewJSONRequest creates a new http request, with the provided context, method
+// and path, accepting JSON. The body, if provided, is JSON-encoded. The path is
+// resolved against the baseURL. The caller adds the authentication.
+func NewJSONRequest(ctx context.Context, baseURL *url.URL, method string, path string, body interface{}) (*http.Request, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing path: %s", path)
+	}
+	reqURL := baseURL.ResolveReference(u)
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, errors.Wrap(err, "could not encode body as JSON")
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, reqURL.String(), reader)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create request for path: %s", path)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req.WithContext(ctx), nil
+}
+
+// DoJSON performs the request with the httpClient, and checks that the
+// response status indicates success, returning an HTTPError otherwise. If v
+// is non-nil, the response body is decoded as JSON into v. The request is
+// logged, with its URL redacted, to the logger.
+func DoJSON(httpClient *http.Client, logger *logrus.Entry, req *http.Request, v interface{}) error {
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "error performing request")
+	}
+	defer res.Body.Close()
+	logger.Debugf("%s %s - %d", req.Method, redact.URL(req.URL), res.StatusCode)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Wrap(NewHTTPError(res), "bad response")
+	}
+	if v == nil {
+		return nil
+	}
+	return errors.Wrap(json.NewDecoder(res.Body).Decode(v), "could not decode response")
+}
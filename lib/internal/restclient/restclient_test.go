@@ -0,0 +1,40 @@
+package restclient
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestHTTPErrorTemporary(t *testing.T) {
+	tests := []struct {
+		statusCode int
+		expected   bool
+	}{
+		{400, false},
+		{404, false},
+		{429, true},
+		{500, true},
+		{503, true},
+	}
+	for _, test := range tests {
+		actual := HTTPError{StatusCode: test.statusCode}.Temporary()
+		if actual != test.expected {
+			t.Errorf("expected Temporary() to be %v for status code %d, was: %v",
+				test.expected, test.statusCode, actual)
+		}
+	}
+}
+
+func TestIsHTTPStatusError(t *testing.T) {
+	err := errors.Wrap(HTTPError{StatusCode: 404}, "wrapped HTTPError")
+	if !IsHTTPStatusError(err, 404) {
+		t.Error("expected wrapped HTTPError to match its status code")
+	}
+	if IsHTTPStatusError(err, 500) {
+		t.Error("expected wrapped HTTPError to not match another status code")
+	}
+	if IsHTTPStatusError(errors.New("generic error"), 404) {
+		t.Error("expected generic error to not match")
+	}
+}
@@ -0,0 +1,205 @@
+// Package jira is a client for the REST API of Jira.
+package jira
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/internal/restclient"
+)
+
+// issueFields are the fields of an issue requested from the API.
+const issueFields = "summary,description,status,issuetype,assignee,parent"
+
+// Client is a rest client for Jira, using version 2 of the REST API, where
+// descriptions are returned in the Jira wiki markup.
+type Client struct {
+	logger     *logrus.Entry
+	baseURL    *url.URL
+	httpClient *http.Client
+
+	// username is the username used for basic auth, together with the
+	// token. If empty, the token is a personal access token.
+	username string
+	token    string
+}
+
+// NewClient creates a new Jira API client, authenticating with basic auth. The
+// rawBaseURL should point to the root of the Jira instance, e.g.
+// "https://example.atlassian.net/". The username and token are the email and
+// an API token for Jira Cloud, or the username and password for Jira Server.
+func NewClient(logger *logrus.Logger, rawBaseURL string, username string, token string) (*Client, error) {
+	if username == "" || token == "" {
+		return nil, errors.New("both username and token is required")
+	}
+	return newClient(logger, rawBaseURL, username, token)
+}
+
+// NewTokenClient creates a new Jira API client, authenticating with a personal
+// access token, as supported by Jira Server and Data Center. The rawBaseURL
+// should point to the root of the Jira instance, e.g. "https://jira.example.com/".
+func NewTokenClient(logger *logrus.Logger, rawBaseURL string, token string) (*Client, error) {
+	if token == "" {
+		return nil, errors.New("token is required")
+	}
+	return newClient(logger, rawBaseURL, "", token)
+}
+
+// newClient creates a new Client, using basic auth if the username is set.
+func newClient(logger *logrus.Logger, rawBaseURL string, username string, token string) (*Client, error) {
+	logEntry := logger.WithField("module", "jira")
+	baseURL, err := url.Parse(rawBaseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing apiURL: %s", rawBaseURL)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	return &Client{
+		logger:     logEntry,
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+		username:   username,
+		token:      token,
+	}, nil
+}
+
+// resolvePath resolves a given path against the Client's baseURL.
+func (c *Client) resolvePath(path string) (*url.URL, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing path: %s", path)
+	}
+	return c.baseURL.ResolveReference(u), nil
+}
+
+// newRequest creates a new http request, with the provided context, method and
+// path, authenticated with the credentials of the client. The body, if provided,
+// is JSON-encoded. The path is resolved against the Client's baseURL.
+func (c *Client) newRequest(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+	req, err := restclient.NewJSONRequest(ctx, c.baseURL, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// do performs the request with the Client's httpClient, and checks that the
+// response status indicates success. If v is non-nil, the response body is
+// decoded as JSON into v.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	return restclient.DoJSON(c.httpClient, c.logger, req, v)
+}
+
+// GetIssueURL returns the browsable (i.e. non-api) URL for the given issueKey.
+func (c *Client) GetIssueURL(ctx context.Context, issueKey string) (*url.URL, error) {
+	path := fmt.Sprintf("browse/%s", url.PathEscape(issueKey))
+	u, err := c.resolvePath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not resolve path: %s", path)
+	}
+	return u, nil
+}
+
+// GetIssue returns the Issue identified by the given issueKey.
+func (c *Client) GetIssue(ctx context.Context, issueKey string) (*Issue, error) {
+	path := fmt.Sprintf("rest/api/2/issue/%s?fields=%s", url.PathEscape(issueKey), issueFields)
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	issue := &Issue{}
+	if err := c.do(req, issue); err != nil {
+		return nil, err
+	}
+	return issue, nil
+}
+
+// AddRemoteLink adds the link to the issue identified by issueKey. The URL of
+// the link identifies it, so adding a link with the same URL again updates the
+// existing link instead of adding another.
+func (c *Client) AddRemoteLink(ctx context.Context, issueKey string, link RemoteLink) error {
+	path := fmt.Sprintf("rest/api/2/issue/%s/remotelink", url.PathEscape(issueKey))
+	body := map[string]interface{}{
+		"globalId": link.URL,
+		"object": map[string]string{
+			"url":     link.URL,
+			"title":   link.Title,
+			"summary": link.Summary,
+		},
+	}
+	req, err := c.newRequest(ctx, "POST", path, body)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	return c.do(req, nil)
+}
+
+// AddComment adds a comment with the text, in Jira wiki markup, to the
+// issue identified by issueKey.
+func (c *Client) AddComment(ctx context.Context, issueKey string, text string) error {
+	path := fmt.Sprintf("rest/api/2/issue/%s/comment", url.PathEscape(issueKey))
+	req, err := c.newRequest(ctx, "POST", path, map[string]string{"body": text})
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	return c.do(req, nil)
+}
+
+// GetTransitions returns the transitions currently available for the
+// issue identified by issueKey.
+func (c *Client) GetTransitions(ctx context.Context, issueKey string) ([]Transition, error) {
+	path := fmt.Sprintf("rest/api/2/issue/%s/transitions", url.PathEscape(issueKey))
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	var body struct {
+		Transitions []Transition `json:"transitions"`
+	}
+	if err := c.do(req, &body); err != nil {
+		return nil, err
+	}
+	return body.Transitions, nil
+}
+
+// DoTransition performs the transition identified by transitionID on the
+// issue identified by issueKey.
+func (c *Client) DoTransition(ctx context.Context, issueKey string, transitionID string) error {
+	path := fmt.Sprintf("rest/api/2/issue/%s/transitions", url.PathEscape(issueKey))
+	body := map[string]interface{}{
+		"transition": map[string]string{"id": transitionID},
+	}
+	req, err := c.newRequest(ctx, "POST", path, body)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	return c.do(req, nil)
+}
+
+// TransitionIssue transitions the issue identified by issueKey using the
+// available transition with the given name, or to the status with the given
+// name. The names are compared case-insensitively. Returns an error if no
+// such transition is available.
+func (c *Client) TransitionIssue(ctx context.Context, issueKey string, name string) error {
+	transitions, err := c.GetTransitions(ctx, issueKey)
+	if err != nil {
+		return errors.Wrap(err, "could not get transitions")
+	}
+	for _, transition := range transitions {
+		if strings.EqualFold(transition.Name, name) || strings.EqualFold(transition.To, name) {
+			return c.DoTransition(ctx, issueKey, transition.ID)
+		}
+	}
+	return errors.Errorf("no transition '%s' is available", name)
+}
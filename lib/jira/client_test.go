@@ -0,0 +1,217 @@
+package jira
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var issueJSON = `{
+    "id": "10002",
+    "key": "ABC-123",
+    "self": "https://jira.example.com/rest/api/2/issue/10002",
+    "fields": {
+        "summary": "Product X example code problems",
+        "description": "h2. Description\nSolve issues.",
+        "status": {"name": "In Progress", "id": "3"},
+        "issuetype": {"name": "Sub-task", "subtask": true},
+        "assignee": {
+            "name": "jsmith",
+            "key": "jsmith",
+            "displayName": "John Smith",
+            "emailAddress": "jsmith@example.com"
+        },
+        "parent": {"id": "10001", "key": "ABC-100"}
+    }
+}`
+
+var transitionsJSON = `{
+    "expand": "transitions",
+    "transitions": [
+        {"id": "11", "name": "Start Progress", "to": {"name": "In Progress"}},
+        {"id": "31", "name": "Resolve Issue", "to": {"name": "Resolved"}}
+    ]
+}`
+
+// newTestServer returns a test server stand-in for the Jira API, calling
+// the handler for each request after checking its authentication.
+func newTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		basicAuth := ok && username == "user@example.com" && password == "api-token"
+		if !basicAuth && r.Header.Get("Authorization") != "Bearer pat-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}))
+}
+
+func TestGetIssueURL(t *testing.T) {
+	c, err := NewTokenClient(logrus.New(), "https://jira.example.com/jira", "pat-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	actual, err := c.GetIssueURL(context.Background(), "ABC-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	expected := "https://jira.example.com/jira/browse/ABC-123"
+	if actual.String() != expected {
+		t.Errorf("expected '%s', got: '%s'", expected, actual)
+	}
+}
+
+func TestGetIssue(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rest/api/2/issue/ABC-123" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("fields") != issueFields {
+			t.Errorf("unexpected fields: %s", r.URL.Query().Get("fields"))
+		}
+		w.Write([]byte(issueJSON))
+	})
+	defer server.Close()
+	basicClient, err := NewClient(logrus.New(), server.URL, "user@example.com", "api-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	tokenClient, err := NewTokenClient(logrus.New(), server.URL, "pat-token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	expected := &Issue{
+		Key:         "ABC-123",
+		Summary:     "Product X example code problems",
+		Description: "h2. Description\nSolve issues.",
+		Status:      "In Progress",
+		Type:        "Sub-task",
+		Assignee:    &User{Name: "jsmith", DisplayName: "John Smith"},
+		Parent:      "ABC-100",
+	}
+	for _, c := range []*Client{basicClient, tokenClient} {
+		issue, err := c.GetIssue(context.Background(), "ABC-123")
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if !reflect.DeepEqual(issue, expected) {
+			t.Errorf("expected issue %+v, was: %+v", expected, issue)
+		}
+	}
+}
+
+func TestGetIssue_Errors(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer server.Close()
+	c, _ := NewTokenClient(logrus.New(), server.URL, "pat-token")
+	_, err := c.GetIssue(context.Background(), "ABC-123")
+	if !IsHTTPStatusError(err, http.StatusNotFound) {
+		t.Errorf("expected a not found error, got: %+v", err)
+	}
+	c, _ = NewTokenClient(logrus.New(), server.URL, "wrong-token")
+	_, err = c.GetIssue(context.Background(), "ABC-123")
+	if !IsHTTPStatusError(err, http.StatusUnauthorized) {
+		t.Errorf("expected an unauthorized error, got: %+v", err)
+	}
+}
+
+func TestAddRemoteLink(t *testing.T) {
+	var body struct {
+		GlobalID string            `json:"globalId"`
+		Object   map[string]string `json:"object"`
+	}
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/rest/api/2/issue/ABC-123/remotelink" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": 10000, "self": "https://jira.example.com/rest/api/2/issue/ABC-123/remotelink/10000"}`))
+	})
+	defer server.Close()
+	c, _ := NewTokenClient(logrus.New(), server.URL, "pat-token")
+	link := RemoteLink{URL: "https://gitlab.example.com/group/project/merge_requests/12", Title: "!12 Title"}
+	if err := c.AddRemoteLink(context.Background(), "ABC-123", link); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if body.GlobalID != link.URL || body.Object["url"] != link.URL || body.Object["title"] != link.Title {
+		t.Errorf("unexpected remote link body: %+v", body)
+	}
+}
+
+func TestAddComment(t *testing.T) {
+	var body map[string]string
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/rest/api/2/issue/ABC-123/comment" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id": "10001", "body": "A comment"}`))
+	})
+	defer server.Close()
+	c, _ := NewClient(logrus.New(), server.URL, "user@example.com", "api-token")
+	if err := c.AddComment(context.Background(), "ABC-123", "A comment"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if body["body"] != "A comment" {
+		t.Errorf("unexpected comment body: %+v", body)
+	}
+}
+
+func TestTransitionIssue(t *testing.T) {
+	tests := []struct {
+		name          string
+		expectedID    string
+		expectedError string
+	}{
+		{"Resolve Issue", "31", ""},
+		{"resolved", "31", ""},
+		{"In Progress", "11", ""},
+		{"Closed", "", "no transition 'Closed' is available"},
+	}
+	for _, test := range tests {
+		var transitionID string
+		server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/rest/api/2/issue/ABC-123/transitions" {
+				t.Errorf("unexpected path: %s", r.URL.Path)
+			}
+			if r.Method == "GET" {
+				w.Write([]byte(transitionsJSON))
+				return
+			}
+			var body struct {
+				Transition struct {
+					ID string `json:"id"`
+				} `json:"transition"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			transitionID = body.Transition.ID
+			w.WriteHeader(http.StatusNoContent)
+		})
+		c, _ := NewTokenClient(logrus.New(), server.URL, "pat-token")
+		err := c.TransitionIssue(context.Background(), "ABC-123", test.name)
+		server.Close()
+		if test.expectedError != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+				t.Errorf("expected error containing '%s' for '%s', got: %v", test.expectedError, test.name, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if transitionID != test.expectedID {
+			t.Errorf("expected transition '%s' for '%s', was: '%s'", test.expectedID, test.name, transitionID)
+		}
+	}
+}
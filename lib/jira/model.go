@@ -0,0 +1,121 @@
+package jira
+
+import "encoding/json"
+
+// Issue is a Jira issue as it is returned by the API.
+type Issue struct {
+	// Key is the human readable id of the issue, e.g. "ABC-123".
+	Key     string
+	Summary string
+	// Description is the description of the issue, in the Jira wiki
+	// markup.
+	Description string
+	// Status is the name of the status of the issue, e.g. "In Progress".
+	Status string
+	// Type is the name of the type of the issue, e.g. "Bug".
+	Type string
+	// Assignee is the user the issue is assigned to, or nil if the
+	// issue is not assigned.
+	Assignee *User
+	// Parent is the key of the parent issue, or empty if the issue
+	// is not a subtask.
+	Parent string
+}
+
+// User is a Jira user, as referenced by fields of an issue.
+type User struct {
+	// Name is the username of the user on Jira Server. It is empty on
+	// Jira Cloud, where users are identified by their AccountID.
+	Name        string
+	AccountID   string
+	DisplayName string
+}
+
+// jsonName is an object of the API identified by its name, e.g. a status.
+type jsonName struct {
+	Name string `json:"name"`
+}
+
+// rawIssue is the data of an issue returned by the API.
+type rawIssue struct {
+	Key    string `json:"key"`
+	Fields struct {
+		Summary     string    `json:"summary"`
+		Description string    `json:"description"`
+		Status      *jsonName `json:"status"`
+		IssueType   *jsonName `json:"issuetype"`
+		Assignee    *struct {
+			Name        string `json:"name"`
+			AccountID   string `json:"accountId"`
+			DisplayName string `json:"displayName"`
+		} `json:"assignee"`
+		Parent *struct {
+			Key string `json:"key"`
+		} `json:"parent"`
+	} `json:"fields"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding an
+// issue returned by the API.
+func (issue *Issue) UnmarshalJSON(data []byte) error {
+	var raw rawIssue
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	fields := raw.Fields
+	*issue = Issue{
+		Key:         raw.Key,
+		Summary:     fields.Summary,
+		Description: fields.Description,
+	}
+	if fields.Status != nil {
+		issue.Status = fields.Status.Name
+	}
+	if fields.IssueType != nil {
+		issue.Type = fields.IssueType.Name
+	}
+	if fields.Assignee != nil {
+		issue.Assignee = &User{
+			Name:        fields.Assignee.Name,
+			AccountID:   fields.Assignee.AccountID,
+			DisplayName: fields.Assignee.DisplayName,
+		}
+	}
+	if fields.Parent != nil {
+		issue.Parent = fields.Parent.Key
+	}
+	return nil
+}
+
+// RemoteLink is a link from a Jira issue to an object outside of Jira,
+// e.g. a merge request.
+type RemoteLink struct {
+	URL   string
+	Title string
+	// Summary is an optional description of the linked object.
+	Summary string
+}
+
+// Transition is a transition of an issue from its current status to
+// another status.
+type Transition struct {
+	ID   string
+	Name string
+	// To is the name of the status the issue transitions to.
+	To string
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding a
+// transition returned by the API.
+func (transition *Transition) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID   string   `json:"id"`
+		Name string   `json:"name"`
+		To   jsonName `json:"to"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*transition = Transition{ID: raw.ID, Name: raw.Name, To: raw.To.Name}
+	return nil
+}
@@ -0,0 +1,139 @@
+package queue
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DeadLetter is a job that could not be handled successfully, stored
+// together with information about why it failed.
+type DeadLetter struct {
+	// ID is the id of the dead letter, assigned by the DeadLetterStore.
+	ID uint64 `json:"id"`
+	// Job is the job that failed.
+	Job *Job `json:"job"`
+	// Attempts is the number of times handling the job was attempted.
+	Attempts int `json:"attempts"`
+	// Error is the error of the last attempt to handle the job.
+	Error string `json:"error"`
+	// FailedAt is the time of the last attempt to handle the job.
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// DeadLetterStore is a store for jobs that failed to be handled, so
+// that they can be inspected and possibly replayed. The store is backed
+// by a single JSON file, that is rewritten on each change. Dead letters
+// are expected to be rare, so this is not a performance concern.
+type DeadLetterStore struct {
+	path string
+
+	mu      sync.Mutex
+	nextID  uint64
+	letters map[uint64]*DeadLetter
+}
+
+// OpenDeadLetters opens the DeadLetterStore backed by the file at path.
+// The file is created on the first change to the store if it does not
+// already exist.
+func OpenDeadLetters(path string) (*DeadLetterStore, error) {
+	s := &DeadLetterStore{
+		path:    path,
+		nextID:  1,
+		letters: make(map[uint64]*DeadLetter),
+	}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "could not read dead letter file: %s", path)
+	}
+	var letters []*DeadLetter
+	if err := json.Unmarshal(data, &letters); err != nil {
+		return nil, errors.Wrapf(err, "could not decode dead letter file: %s", path)
+	}
+	for _, letter := range letters {
+		s.letters[letter.ID] = letter
+		if letter.ID >= s.nextID {
+			s.nextID = letter.ID + 1
+		}
+	}
+	return s, nil
+}
+
+// save writes all dead letters to the store's file. The letters are first
+// written to a temporary file which is then renamed over the old file.
+// Must be called with the mu held.
+func (s *DeadLetterStore) save() error {
+	data, err := json.MarshalIndent(s.list(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "could not encode dead letters")
+	}
+	tmpPath := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, data, 0600); err != nil {
+		return errors.Wrap(err, "could not write temporary file")
+	}
+	return errors.Wrap(os.Rename(tmpPath, s.path), "could not replace dead letter file")
+}
+
+// list returns the dead letters, sorted by id. Must be called with
+// the mu held.
+func (s *DeadLetterStore) list() []*DeadLetter {
+	letters := make([]*DeadLetter, 0, len(s.letters))
+	for _, letter := range s.letters {
+		letters = append(letters, letter)
+	}
+	sort.Slice(letters, func(i, j int) bool { return letters[i].ID < letters[j].ID })
+	return letters
+}
+
+// Add adds the job as a dead letter to the store. The attempts is the number
+// of times handling the job was attempted, and jobErr the error of the last
+// of those attempts.
+func (s *DeadLetterStore) Add(job *Job, attempts int, jobErr error) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	letter := &DeadLetter{
+		ID:       s.nextID,
+		Job:      job,
+		Attempts: attempts,
+		Error:    jobErr.Error(),
+		FailedAt: time.Now().UTC(),
+	}
+	s.letters[letter.ID] = letter
+	if err := s.save(); err != nil {
+		delete(s.letters, letter.ID)
+		return nil, err
+	}
+	s.nextID++
+	return letter, nil
+}
+
+// List returns all dead letters in the store, ordered by id.
+func (s *DeadLetterStore) List() []*DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.list()
+}
+
+// Remove removes the dead letter identified by id from the store, returning
+// the removed dead letter. Returns nil if no such dead letter exists.
+func (s *DeadLetterStore) Remove(id uint64) (*DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	letter, ok := s.letters[id]
+	if !ok {
+		return nil, nil
+	}
+	delete(s.letters, id)
+	if err := s.save(); err != nil {
+		s.letters[id] = letter
+		return nil, err
+	}
+	return letter, nil
+}
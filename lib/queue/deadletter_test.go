@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestDeadLetterStore_PersistsLetters(t *testing.T) {
+	path, cleanup := newTestQueuePath(t)
+	defer cleanup()
+	s, err := OpenDeadLetters(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	job := &Job{ID: 7, Event: "Push Hook", Payload: []byte(`{}`)}
+	first, err := s.Add(job, 5, errors.New("first error"))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if _, err := s.Add(job, 1, errors.New("second error")); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if removed, err := s.Remove(first.ID); err != nil || removed == nil {
+		t.Fatalf("expected first letter to be removed, got: %+v, %+v", removed, err)
+	}
+
+	s, err = OpenDeadLetters(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	letters := s.List()
+	if len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got: %d", len(letters))
+	}
+	if letters[0].Error != "second error" || letters[0].Job.ID != 7 {
+		t.Errorf("unexpected dead letter: %+v", letters[0])
+	}
+	if letter, _ := s.Remove(first.ID); letter != nil {
+		t.Errorf("expected no letter for removed id, got: %+v", letter)
+	}
+}
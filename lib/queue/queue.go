@@ -0,0 +1,290 @@
+package queue
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// compactThreshold is the minimum number of records that the queue file
+// must contain before it is compacted, i.e. rewritten to only contain
+// the jobs that are not yet done.
+const compactThreshold = 1000
+
+// Job is a single webhook, persisted in the queue until it has been
+// marked as done.
+type Job struct {
+	// ID is the id of the job, assigned by the queue when the job
+	// is pushed.
+	ID uint64 `json:"id"`
+	// Event is the type of event, i.e. the "X-Gitlab-Event" header
+	// value, of the webhook.
+	Event string `json:"event"`
+	// Payload is the raw JSON body of the webhook.
+	Payload json.RawMessage `json:"payload"`
+}
+
+// record is a single entry in the append-only queue file. A record
+// either adds a job to the queue (Job is set) or marks a previously
+// added job as done (DoneID is set).
+type record struct {
+	Job    *Job   `json:"job,omitempty"`
+	DoneID uint64 `json:"done,omitempty"`
+}
+
+// Queue is a durable FIFO queue of jobs, backed by an append-only file.
+// Every job pushed to the queue is written to the file before Push returns,
+// and remains in the file until it is marked as done. Jobs that were not
+// marked as done, for example because the process was stopped while they
+// were being handled, are available from the queue again when the file is
+// re-opened.
+type Queue struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+	// numRecords is the number of records in the file, used to
+	// decide when the file should be compacted.
+	numRecords int
+	nextID     uint64
+	// pending are the jobs that have not yet been returned by Next.
+	pending []*Job
+	// inFlight are the jobs that have been returned by Next, but
+	// that have not yet been marked as done.
+	inFlight map[uint64]*Job
+
+	// notifyCh is signalled when a job is added to pending.
+	notifyCh chan struct{}
+}
+
+// Open opens the queue backed by the file at path, creating the file if it
+// does not exist. Any jobs in the file that were not marked as done are
+// made available to Next, in the order they were pushed.
+func Open(path string) (*Queue, error) {
+	q := &Queue{
+		path:     path,
+		nextID:   1,
+		inFlight: make(map[uint64]*Job),
+		notifyCh: make(chan struct{}, 1),
+	}
+	if err := q.load(); err != nil {
+		return nil, errors.Wrapf(err, "could not load queue file: %s", path)
+	}
+	if err := q.compact(); err != nil {
+		return nil, errors.Wrapf(err, "could not compact queue file: %s", path)
+	}
+	if len(q.pending) > 0 {
+		q.notify()
+	}
+	return q, nil
+}
+
+// load reads the records of the queue file, restoring the jobs that are
+// not yet done as pending. A trailing record that is not terminated by a
+// newline is assumed to be the result of an interrupted write and is
+// ignored.
+func (q *Queue) load() error {
+	f, err := os.Open(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "could not open file")
+	}
+	defer f.Close()
+	jobs := make(map[uint64]*Job)
+	var order []uint64
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrap(err, "could not read record")
+		}
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		rec := record{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return errors.Wrap(err, "could not decode record")
+		}
+		if rec.Job != nil {
+			jobs[rec.Job.ID] = rec.Job
+			order = append(order, rec.Job.ID)
+			if rec.Job.ID >= q.nextID {
+				q.nextID = rec.Job.ID + 1
+			}
+		} else {
+			delete(jobs, rec.DoneID)
+		}
+	}
+	for _, id := range order {
+		if job, ok := jobs[id]; ok {
+			q.pending = append(q.pending, job)
+		}
+	}
+	return nil
+}
+
+// compact rewrites the queue file so that it only contains the jobs
+// that are not yet done, and (re)opens it for appending. The new
+// file is written to a temporary file which is then renamed over the
+// old file, so that the queue file is never left half-written.
+func (q *Queue) compact() error {
+	tmpPath := q.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return errors.Wrap(err, "could not create temporary file")
+	}
+	bufWriter := bufio.NewWriter(tmpFile)
+	enc := json.NewEncoder(bufWriter)
+	var jobs []*Job
+	for _, job := range q.inFlight {
+		jobs = append(jobs, job)
+	}
+	jobs = append(jobs, q.pending...)
+	// The in-flight jobs are in random map order, so the jobs are sorted
+	// to keep them in the order they were pushed when the file is loaded.
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].ID < jobs[j].ID })
+	for _, job := range jobs {
+		if err := enc.Encode(record{Job: job}); err != nil {
+			tmpFile.Close()
+			return errors.Wrap(err, "could not write record")
+		}
+	}
+	if err := bufWriter.Flush(); err != nil {
+		tmpFile.Close()
+		return errors.Wrap(err, "could not write records")
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return errors.Wrap(err, "could not sync temporary file")
+	}
+	if err := tmpFile.Close(); err != nil {
+		return errors.Wrap(err, "could not close temporary file")
+	}
+	if q.file != nil {
+		q.file.Close()
+		q.file = nil
+	}
+	if err := os.Rename(tmpPath, q.path); err != nil {
+		return errors.Wrap(err, "could not replace queue file")
+	}
+	f, err := os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.Wrap(err, "could not open queue file")
+	}
+	q.file = f
+	q.numRecords = len(jobs)
+	return nil
+}
+
+// appendRecord writes the record to the end of the queue file and syncs
+// the file to disk. Must be called with the mu held.
+func (q *Queue) appendRecord(rec record) error {
+	if q.file == nil {
+		return errors.New("queue is closed")
+	}
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return errors.Wrap(err, "could not encode record")
+	}
+	data = append(data, '\n')
+	if _, err := q.file.Write(data); err != nil {
+		return errors.Wrap(err, "could not write record")
+	}
+	if err := q.file.Sync(); err != nil {
+		return errors.Wrap(err, "could not sync queue file")
+	}
+	q.numRecords++
+	return nil
+}
+
+// notify signals that a job has been added to pending, waking up one
+// caller blocked in Next.
+func (q *Queue) notify() {
+	select {
+	case q.notifyCh <- struct{}{}:
+	default:
+	}
+}
+
+// Push adds a new job for the webhook with the given event and payload
+// to the queue. The job is persisted to the queue file before Push returns.
+func (q *Queue) Push(event string, payload []byte) (*Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := &Job{ID: q.nextID, Event: event, Payload: payload}
+	if err := q.appendRecord(record{Job: job}); err != nil {
+		return nil, err
+	}
+	q.nextID++
+	q.pending = append(q.pending, job)
+	q.notify()
+	return job, nil
+}
+
+// Next returns the oldest job that has not yet been returned by Next,
+// blocking until such a job is available or the context is cancelled.
+// The returned job must be marked as done by calling Done once it has
+// been handled.
+func (q *Queue) Next(ctx context.Context) (*Job, error) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) > 0 {
+			job := q.pending[0]
+			q.pending = q.pending[1:]
+			q.inFlight[job.ID] = job
+			if len(q.pending) > 0 {
+				// Pass the signal on, so that another waiting
+				// caller can pick up the remaining jobs.
+				q.notify()
+			}
+			q.mu.Unlock()
+			return job, nil
+		}
+		q.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-q.notifyCh:
+		}
+	}
+}
+
+// Done marks the job identified by id as done, removing it from the queue.
+func (q *Queue) Done(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.appendRecord(record{DoneID: id}); err != nil {
+		return err
+	}
+	delete(q.inFlight, id)
+	// Compact once the file is mostly made up of jobs that are done
+	numJobs := len(q.pending) + len(q.inFlight)
+	if q.numRecords >= compactThreshold && q.numRecords > 2*numJobs {
+		return errors.Wrap(q.compact(), "could not compact queue file")
+	}
+	return nil
+}
+
+// Close closes the queue file. Jobs that are not yet done remain in the
+// file, and are available again the next time the queue is opened.
+func (q *Queue) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.file == nil {
+		return nil
+	}
+	err := q.file.Close()
+	q.file = nil
+	return err
+}
@@ -0,0 +1,174 @@
+package queue
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestQueuePath returns the path of a queue file in a new temporary
+// directory, and a func removing that directory.
+func newTestQueuePath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "mrgitlab-queue")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	return filepath.Join(dir, "queue"), func() { os.RemoveAll(dir) }
+}
+
+func mustNext(t *testing.T, q *Queue) *Job {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	job, err := q.Next(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	return job
+}
+
+func TestQueue_PushNextDone(t *testing.T) {
+	path, cleanup := newTestQueuePath(t)
+	defer cleanup()
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	defer q.Close()
+	if _, err := q.Push("Push Hook", []byte(`{"a":1}`)); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if _, err := q.Push("Note Hook", []byte(`{"b":2}`)); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	job := mustNext(t, q)
+	if job.Event != "Push Hook" || string(job.Payload) != `{"a":1}` {
+		t.Errorf("unexpected first job: %+v", job)
+	}
+	if err := q.Done(job.ID); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	job = mustNext(t, q)
+	if job.Event != "Note Hook" {
+		t.Errorf("unexpected second job: %+v", job)
+	}
+}
+
+func TestQueue_NextBlocksUntilCancelled(t *testing.T) {
+	path, cleanup := newTestQueuePath(t)
+	defer cleanup()
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	defer q.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Next(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got: %+v", err)
+	}
+}
+
+// Test that jobs that were not done when the queue was closed, including
+// jobs that were returned by Next, are replayed when the queue is re-opened.
+func TestQueue_ReplaysUnfinishedJobs(t *testing.T) {
+	path, cleanup := newTestQueuePath(t)
+	defer cleanup()
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	for _, payload := range []string{`1`, `2`, `3`} {
+		if _, err := q.Push("Push Hook", []byte(payload)); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	job := mustNext(t, q)
+	if err := q.Done(job.ID); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	mustNext(t, q) // In-flight, but never done
+	q.Close()
+
+	q, err = Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	defer q.Close()
+	for _, expected := range []string{`2`, `3`} {
+		job := mustNext(t, q)
+		if string(job.Payload) != expected {
+			t.Errorf("expected payload '%s', got: '%s'", expected, job.Payload)
+		}
+	}
+	newJob, err := q.Push("Push Hook", []byte(`4`))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if newJob.ID != 4 {
+		t.Errorf("expected new job to get id 4, got: %d", newJob.ID)
+	}
+}
+
+// Test that compacting the queue keeps in-flight and pending jobs in the
+// order they were pushed.
+func TestQueue_CompactKeepsOrder(t *testing.T) {
+	path, cleanup := newTestQueuePath(t)
+	defer cleanup()
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	payloads := []string{`1`, `2`, `3`, `4`, `5`, `6`, `7`, `8`}
+	for _, payload := range payloads {
+		if _, err := q.Push("Push Hook", []byte(payload)); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	for i := 0; i < 6; i++ {
+		mustNext(t, q) // In-flight, but never done
+	}
+	if err := q.compact(); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	q.Close()
+
+	q, err = Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	defer q.Close()
+	for _, expected := range payloads {
+		job := mustNext(t, q)
+		if string(job.Payload) != expected {
+			t.Errorf("expected payload '%s', got: '%s'", expected, job.Payload)
+		}
+	}
+}
+
+// Test that a partially written trailing record, as left by an interrupted
+// write, is ignored.
+func TestQueue_IgnoresPartialRecord(t *testing.T) {
+	path, cleanup := newTestQueuePath(t)
+	defer cleanup()
+	contents := `{"job":{"id":1,"event":"Push Hook","payload":1}}` + "\n" + `{"job":{"id":2,"ev`
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	defer q.Close()
+	job := mustNext(t, q)
+	if job.ID != 1 {
+		t.Errorf("expected job with id 1, got: %+v", job)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if job, err := q.Next(ctx); err == nil {
+		t.Errorf("expected no more jobs, got: %+v", job)
+	}
+}
@@ -0,0 +1,194 @@
+// Package redact masks secrets, such as tokens and passwords, in values
+// that are logged.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// Mask is the value that secrets are replaced with.
+const Mask = "[REDACTED]"
+
+// sensitiveKeys are the names of query parameters and JSON fields whose
+// values are always masked. A name is also considered sensitive if it
+// ends with "_" followed by one of the keys, e.g. "private_token".
+var sensitiveKeys = []string{
+	"password",
+	"passwd",
+	"token",
+	"secret",
+	"apikey",
+	"api_key",
+	"authorization",
+}
+
+// isSensitiveKey returns true if values with the given name should be
+// masked. The extraKeys are names that are sensitive in addition to
+// the sensitiveKeys.
+func isSensitiveKey(name string, extraKeys []string) bool {
+	name = strings.ToLower(name)
+	for _, keys := range [][]string{sensitiveKeys, extraKeys} {
+		for _, key := range keys {
+			key = strings.ToLower(key)
+			if name == key || strings.HasSuffix(name, "_"+key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// URL returns the string representation of u, with the password of
+// the user info and the values of sensitive query parameters masked.
+func URL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	masked := *u
+	if masked.User != nil {
+		if _, ok := masked.User.Password(); ok {
+			masked.User = url.UserPassword(masked.User.Username(), Mask)
+		}
+	}
+	query := masked.Query()
+	changed := false
+	for name, values := range query {
+		if isSensitiveKey(name, nil) {
+			for i := range values {
+				values[i] = Mask
+			}
+			changed = true
+		}
+	}
+	if changed {
+		masked.RawQuery = query.Encode()
+	}
+	return masked.String()
+}
+
+// JSON returns the JSON encoding of v, with the values of sensitive
+// fields masked. The fields are names of JSON fields that are sensitive
+// in addition to the always sensitive ones, e.g. "password". If v can
+// not be encoded, the error is returned as the string instead.
+func JSON(v interface{}, fields ...string) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<could not encode %T: %v>", v, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return fmt.Sprintf("<could not encode %T: %v>", v, err)
+	}
+	data, err = json.Marshal(maskFields(decoded, fields))
+	if err != nil {
+		return fmt.Sprintf("<could not encode %T: %v>", v, err)
+	}
+	return string(data)
+}
+
+// maskFields masks the values of sensitive fields in the decoded JSON
+// value v, recursively.
+func maskFields(v interface{}, fields []string) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for name, value := range v {
+			if isSensitiveKey(name, fields) && value != nil {
+				v[name] = Mask
+			} else {
+				v[name] = maskFields(value, fields)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = maskFields(value, fields)
+		}
+	}
+	return v
+}
+
+// Hook is a logrus.Hook that masks secrets in the messages and string
+// fields of all log entries.
+type Hook struct {
+	mu      sync.RWMutex
+	secrets []string
+}
+
+// NewHook creates a new Hook, masking the given secrets.
+func NewHook(secrets ...string) *Hook {
+	hook := &Hook{}
+	hook.SetSecrets(secrets...)
+	return hook
+}
+
+// SetSecrets replaces the secrets masked by the hook. Empty secrets
+// are ignored.
+func (hook *Hook) SetSecrets(secrets ...string) {
+	var nonEmpty []string
+	for _, secret := range secrets {
+		if secret != "" {
+			nonEmpty = append(nonEmpty, secret)
+		}
+	}
+	hook.mu.Lock()
+	hook.secrets = nonEmpty
+	hook.mu.Unlock()
+}
+
+// AddSecrets adds the secrets to the secrets masked by the hook, keeping
+// the secrets already masked. Empty secrets are ignored.
+func (hook *Hook) AddSecrets(secrets ...string) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	known := make(map[string]bool, len(hook.secrets))
+	for _, secret := range hook.secrets {
+		known[secret] = true
+	}
+	for _, secret := range secrets {
+		if secret != "" && !known[secret] {
+			known[secret] = true
+			hook.secrets = append(hook.secrets, secret)
+		}
+	}
+}
+
+// String returns s with all secrets of the hook masked.
+func (hook *Hook) String(s string) string {
+	hook.mu.RLock()
+	defer hook.mu.RUnlock()
+	for _, secret := range hook.secrets {
+		s = strings.Replace(s, secret, Mask, -1)
+	}
+	return s
+}
+
+// Levels implements the logrus.Hook interface, returning all levels.
+func (hook *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements the logrus.Hook interface, masking the secrets of
+// the entry.
+func (hook *Hook) Fire(entry *logrus.Entry) error {
+	entry.Message = hook.String(entry.Message)
+	// The Data is shared with the logger's Entry, so the masked
+	// fields are set on a copy of it
+	data := make(logrus.Fields, len(entry.Data))
+	for name, value := range entry.Data {
+		switch value := value.(type) {
+		case string:
+			data[name] = hook.String(value)
+		case error:
+			data[name] = hook.String(value.Error())
+		default:
+			data[name] = value
+		}
+	}
+	entry.Data = data
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package redmine is a client for the JSON REST API of Redmine.
+package redmine
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/internal/restclient"
+)
+
+// Client is a rest client for Redmine, authenticating with an API key.
+type Client struct {
+	logger     *logrus.Entry
+	baseURL    *url.URL
+	httpClient *http.Client
+	apiKey     string
+}
+
+// NewClient creates a new Redmine API client. The rawBaseURL should point to
+// the root of the Redmine instance, e.g. "https://redmine.example.com/". The
+// apiKey is the API key of the user, found on the "My account" page.
+func NewClient(logger *logrus.Logger, rawBaseURL string, apiKey string) (*Client, error) {
+	if apiKey == "" {
+		return nil, errors.New("apiKey is required")
+	}
+	logEntry := logger.WithField("module", "redmine")
+	baseURL, err := url.Parse(rawBaseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing apiURL: %s", rawBaseURL)
+	}
+	if !strings.HasSuffix(baseURL.Path, "/") {
+		baseURL.Path += "/"
+	}
+	return &Client{
+		logger:     logEntry,
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+		apiKey:     apiKey,
+	}, nil
+}
+
+// resolvePath resolves a given path against the Client's baseURL.
+func (c *Client) resolvePath(path string) (*url.URL, error) {
+	u, err := url.Parse(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing path: %s", path)
+	}
+	return c.baseURL.ResolveReference(u), nil
+}
+
+// newRequest creates a new http request, with the provided context, method and
+// path, authenticated with the API key of the client. The body, if provided,
+// is JSON-encoded. The path is resolved against the Client's baseURL.
+func (c *Client) newRequest(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+	req, err := restclient.NewJSONRequest(ctx, c.baseURL, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Redmine-API-Key", c.apiKey)
+	return req, nil
+}
+
+// do performs the request with the Client's httpClient, and checks that the
+// response status indicates success. If v is non-nil, the response body is
+// decoded as JSON into v.
+func (c *Client) do(req *http.Request, v interface{}) error {
+	return restclient.DoJSON(c.httpClient, c.logger, req, v)
+}
+
+// GetIssueURL returns the browsable (i.e. non-api) URL for the given issueID.
+func (c *Client) GetIssueURL(ctx context.Context, issueID int64) (*url.URL, error) {
+	path := fmt.Sprintf("issues/%d", issueID)
+	u, err := c.resolvePath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not resolve path: %s", path)
+	}
+	return u, nil
+}
+
+// GetIssue returns the Issue identified by the given issueID, including
+// its journals.
+func (c *Client) GetIssue(ctx context.Context, issueID int64) (*Issue, error) {
+	path := fmt.Sprintf("issues/%d.json?include=journals", issueID)
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	var body struct {
+		Issue *Issue `json:"issue"`
+	}
+	if err := c.do(req, &body); err != nil {
+		return nil, err
+	}
+	if body.Issue == nil {
+		return nil, errors.New("response has no issue")
+	}
+	return body.Issue, nil
+}
+
+// updateIssue updates the issue identified by issueID with the given
+// attributes, e.g. "notes" or "status_id".
+func (c *Client) updateIssue(ctx context.Context, issueID int64, attributes map[string]interface{}) error {
+	path := fmt.Sprintf("issues/%d.json", issueID)
+	body := map[string]interface{}{"issue": attributes}
+	req, err := c.newRequest(ctx, "PUT", path, body)
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	return c.do(req, nil)
+}
+
+// AddNote adds the notes, in the text formatting of the server, to the
+// issue identified by issueID.
+func (c *Client) AddNote(ctx context.Context, issueID int64, notes string) error {
+	return c.updateIssue(ctx, issueID, map[string]interface{}{"notes": notes})
+}
+
+// GetIssueStatuses returns all statuses that issues can have.
+func (c *Client) GetIssueStatuses(ctx context.Context) ([]IssueStatus, error) {
+	req, err := c.newRequest(ctx, "GET", "issue_statuses.json", nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	var body struct {
+		IssueStatuses []IssueStatus `json:"issue_statuses"`
+	}
+	if err := c.do(req, &body); err != nil {
+		return nil, err
+	}
+	return body.IssueStatuses, nil
+}
+
+// SetIssueStatus sets the status of the issue identified by issueID to the
+// status with the given name. The names are compared case-insensitively.
+// Returns an error if no such status exists.
+func (c *Client) SetIssueStatus(ctx context.Context, issueID int64, name string) error {
+	statuses, err := c.GetIssueStatuses(ctx)
+	if err != nil {
+		return errors.Wrap(err, "could not get issue statuses")
+	}
+	for _, status := range statuses {
+		if strings.EqualFold(status.Name, name) {
+			return c.updateIssue(ctx, issueID, map[string]interface{}{"status_id": status.ID})
+		}
+	}
+	return errors.Errorf("no issue status '%s' exists", name)
+}
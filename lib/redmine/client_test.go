@@ -0,0 +1,158 @@
+package redmine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+)
+
+var issueJSON = `{"issue": {
+	"id": 1234,
+	"project": {"id": 1, "name": "Legacy"},
+	"tracker": {"id": 1, "name": "Bug"},
+	"status": {"id": 2, "name": "In Progress"},
+	"priority": {"id": 4, "name": "Normal"},
+	"author": {"id": 3, "name": "John Smith"},
+	"assigned_to": {"id": 5, "name": "Jane Doe"},
+	"parent": {"id": 1200},
+	"subject": "Crash on start",
+	"description": "It crashes *every* time",
+	"journals": [
+		{"id": 1, "user": {"id": 3, "name": "John Smith"}, "notes": "", "created_on": "2024-01-02T10:00:00Z",
+			"details": [{"property": "attr", "name": "status_id", "old_value": "1", "new_value": "2"}]},
+		{"id": 2, "user": {"id": 5, "name": "Jane Doe"}, "notes": "Looking into it", "created_on": "2024-01-03T09:30:00Z"}
+	]
+}}`
+
+// newTestServer returns a test server stand-in for the Redmine API, calling
+// the handler for each request after checking its API key.
+func newTestServer(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Redmine-API-Key") != "api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}))
+}
+
+func TestGetIssueURL(t *testing.T) {
+	c, err := NewClient(logrus.New(), "https://redmine.example.com/redmine", "api-key")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	actual, err := c.GetIssueURL(context.Background(), 1234)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	expected := "https://redmine.example.com/redmine/issues/1234"
+	if actual.String() != expected {
+		t.Errorf("expected '%s', got: '%s'", expected, actual)
+	}
+}
+
+func TestGetIssue(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/issues/1234.json" || r.URL.Query().Get("include") != "journals" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.Write([]byte(issueJSON))
+	})
+	defer server.Close()
+	c, _ := NewClient(logrus.New(), server.URL, "api-key")
+	issue, err := c.GetIssue(context.Background(), 1234)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if issue.ID != 1234 || issue.Subject != "Crash on start" || issue.Description != "It crashes *every* time" {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+	if issue.Status.Name != "In Progress" || issue.Tracker.Name != "Bug" {
+		t.Errorf("unexpected status or tracker: %+v, %+v", issue.Status, issue.Tracker)
+	}
+	if issue.AssignedTo == nil || issue.AssignedTo.Name != "Jane Doe" {
+		t.Errorf("unexpected assignee: %+v", issue.AssignedTo)
+	}
+	if issue.Parent == nil || issue.Parent.ID != 1200 {
+		t.Errorf("unexpected parent: %+v", issue.Parent)
+	}
+	if len(issue.Journals) != 2 || issue.Journals[1].Notes != "Looking into it" || issue.Journals[1].User.Name != "Jane Doe" {
+		t.Errorf("unexpected journals: %+v", issue.Journals)
+	}
+	if issue.Journals[0].CreatedOn.Day() != 2 {
+		t.Errorf("unexpected journal time: %s", issue.Journals[0].CreatedOn)
+	}
+}
+
+func TestGetIssue_Errors(t *testing.T) {
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer server.Close()
+	c, _ := NewClient(logrus.New(), server.URL, "api-key")
+	if _, err := c.GetIssue(context.Background(), 1); !IsHTTPStatusError(err, http.StatusNotFound) {
+		t.Errorf("expected a not found error, got: %v", err)
+	}
+	c, _ = NewClient(logrus.New(), server.URL, "wrong-key")
+	if _, err := c.GetIssue(context.Background(), 1); !IsHTTPStatusError(err, http.StatusUnauthorized) {
+		t.Errorf("expected an unauthorized error, got: %v", err)
+	}
+}
+
+func TestAddNote(t *testing.T) {
+	var body struct {
+		Issue map[string]interface{} `json:"issue"`
+	}
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/issues/1234.json" {
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	defer server.Close()
+	c, _ := NewClient(logrus.New(), server.URL, "api-key")
+	if err := c.AddNote(context.Background(), 1234, "A note"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if body.Issue["notes"] != "A note" {
+		t.Errorf("unexpected note body: %+v", body)
+	}
+}
+
+func TestSetIssueStatus(t *testing.T) {
+	var statusID float64
+	server := newTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/issue_statuses.json":
+			w.Write([]byte(`{"issue_statuses": [
+				{"id": 1, "name": "New", "is_closed": false},
+				{"id": 5, "name": "Closed", "is_closed": true}
+			]}`))
+		case r.Method == "PUT" && r.URL.Path == "/issues/1234.json":
+			var body struct {
+				Issue map[string]interface{} `json:"issue"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			statusID, _ = body.Issue["status_id"].(float64)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	})
+	defer server.Close()
+	c, _ := NewClient(logrus.New(), server.URL, "api-key")
+	if err := c.SetIssueStatus(context.Background(), 1234, "closed"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if statusID != 5 {
+		t.Errorf("expected status_id 5, was: %v", statusID)
+	}
+	if err := c.SetIssueStatus(context.Background(), 1234, "Done"); err == nil {
+		t.Error("expected an error for an unknown status")
+	}
+}
@@ -0,0 +1,9 @@
+package redmine
+
+import "github.com/verath/mrgitlab/lib/internal/restclient"
+
+// IsHTTPStatusError returns true if the cause of the given error
+// was that the Redmine API responded with the given statusCode.
+func IsHTTPStatusError(err error, statusCode int) bool {
+	return restclient.IsHTTPStatusError(err, statusCode)
+}
@@ -0,0 +1,49 @@
+package redmine
+
+import "time"
+
+// Issue is a Redmine issue as it is returned by the API.
+type Issue struct {
+	ID      int64  `json:"id"`
+	Subject string `json:"subject"`
+	// Description is the description of the issue, in the text
+	// formatting of the server, i.e. Textile or Markdown.
+	Description string `json:"description"`
+	// Status is the status of the issue, e.g. "In Progress".
+	Status Reference `json:"status"`
+	// Tracker is the tracker, i.e. type, of the issue, e.g. "Bug".
+	Tracker Reference `json:"tracker"`
+	// AssignedTo is the user, or group, the issue is assigned to, or
+	// nil if the issue is not assigned.
+	AssignedTo *Reference `json:"assigned_to"`
+	// Parent is the parent issue, or nil if the issue is not a subtask.
+	Parent *struct {
+		ID int64 `json:"id"`
+	} `json:"parent"`
+	// Journals are the changes and notes of the issue, oldest first.
+	// They are only included if requested.
+	Journals []Journal `json:"journals"`
+}
+
+// Reference is a reference to a named object, e.g. a user or a status.
+type Reference struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// Journal is a change of an issue, optionally with notes.
+type Journal struct {
+	ID   int64     `json:"id"`
+	User Reference `json:"user"`
+	// Notes are the notes added by the change, or empty if the change
+	// only changed the fields of the issue.
+	Notes     string    `json:"notes"`
+	CreatedOn time.Time `json:"created_on"`
+}
+
+// IssueStatus is a status that issues can have.
+type IssueStatus struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	IsClosed bool   `json:"is_closed"`
+}
@@ -0,0 +1,98 @@
+package mrgitlab
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// backoff describes how failed attempts at handling a webhook are retried.
+// The delay before each retry grows exponentially, from initialDelay up to
+// maxDelay, with a random jitter applied so that retries of many webhooks
+// failing at the same time are spread out.
+type backoff struct {
+	// maxAttempts is the maximum number of attempts, including the
+	// first one, made at handling a webhook.
+	maxAttempts  int
+	initialDelay time.Duration
+	maxDelay     time.Duration
+}
+
+// defaultBackoff is the backoff used by the app for retrying webhooks.
+var defaultBackoff = backoff{
+	maxAttempts:  5,
+	initialDelay: 2 * time.Second,
+	maxDelay:     time.Minute,
+}
+
+// delay returns the time to wait before making the given attempt, where
+// attempt 1 is the first attempt. The returned delay is a random duration
+// in the range [d/2, d), where d is initialDelay*2^(attempt-2) capped at
+// maxDelay.
+func (b backoff) delay(attempt int) time.Duration {
+	d := b.initialDelay
+	for i := 2; i < attempt && d < b.maxDelay; i++ {
+		d *= 2
+	}
+	if d > b.maxDelay {
+		d = b.maxDelay
+	}
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// isTransient returns true if the error is one that might not occur if
+// the action causing it is retried. This is the case for errors whose
+// cause implements a Temporary method returning true, which includes
+// timeouts, context deadlines and the HTTP errors of the API clients
+// for server errors.
+func isTransient(err error) bool {
+	temporary, ok := errors.Cause(err).(interface {
+		Temporary() bool
+	})
+	return ok && temporary.Temporary()
+}
+
+// jobProgress records the results of the handlers of a job across the
+// attempts at handling it, so that a retry only calls the handlers that
+// failed with a transient error. This keeps handlers with side effects,
+// e.g. commenting on issues, from repeating them when another handler of
+// the job is retried. A nil jobProgress records nothing.
+type jobProgress struct {
+	// results are the recorded results, keyed by handler.
+	results map[string]handlerResult
+}
+
+// newJobProgress returns a new jobProgress, without any results.
+func newJobProgress() *jobProgress {
+	return &jobProgress{results: make(map[string]handlerResult)}
+}
+
+// progressKey returns the key of the handler at index i of the handlers
+// of a webhook, named name.
+func progressKey(i int, name string) string {
+	return fmt.Sprintf("%d/%s", i, name)
+}
+
+// result returns the recorded result of the handler at index i, named
+// name, and true if there was a recorded result.
+func (p *jobProgress) result(i int, name string) (handlerResult, bool) {
+	if p == nil {
+		return handlerResult{}, false
+	}
+	res, ok := p.results[progressKey(i, name)]
+	return res, ok
+}
+
+// record records the result of the handler at index i, named name.
+func (p *jobProgress) record(i int, name string, res handlerResult) {
+	if p == nil {
+		return
+	}
+	p.results[progressKey(i, name)] = res
+}
@@ -0,0 +1,62 @@
+package mrgitlab
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// temporaryError is an error implementing the Temporary method.
+type temporaryError bool
+
+func (err temporaryError) Error() string   { return "temporary error" }
+func (err temporaryError) Temporary() bool { return bool(err) }
+
+func TestBackoffDelay(t *testing.T) {
+	b := backoff{maxAttempts: 10, initialDelay: 100 * time.Millisecond, maxDelay: time.Second}
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{2, 100 * time.Millisecond},
+		{3, 200 * time.Millisecond},
+		{4, 400 * time.Millisecond},
+		{5, 800 * time.Millisecond},
+		{6, time.Second},
+		{9, time.Second},
+	}
+	for _, test := range tests {
+		for i := 0; i < 100; i++ {
+			actual := b.delay(test.attempt)
+			if actual < test.max/2 || actual >= test.max {
+				t.Fatalf("expected delay for attempt %d to be in [%s, %s), was: %s",
+					test.attempt, test.max/2, test.max, actual)
+			}
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected bool
+	}{
+		{errors.New("generic error"), false},
+		{temporaryError(true), true},
+		{temporaryError(false), false},
+		{errors.Wrap(temporaryError(true), "wrapped"), true},
+		{errors.Wrap(context.DeadlineExceeded, "wrapped"), true},
+		{errors.Wrap(&url.Error{Op: "Get", URL: "http://test", Err: &net.DNSError{IsTimeout: true}}, "wrapped"), true},
+	}
+	for _, test := range tests {
+		actual := isTransient(test.err)
+		if actual != test.expected {
+			t.Errorf("expected isTransient to be %v for '%v', was: %v",
+				test.expected, test.err, actual)
+		}
+	}
+}
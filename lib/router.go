@@ -0,0 +1,66 @@
+package mrgitlab
+
+import (
+	"context"
+
+	"github.com/verath/mrgitlab/lib/gitlab"
+)
+
+// eventRoute describes how a webhook of a single type of event is decoded
+// and dispatched to the handlers of that event.
+type eventRoute struct {
+	// newWebhook returns a new, empty, webhook model that the
+	// webhook payload is decoded into.
+	newWebhook func() interface{}
+	// handle dispatches a decoded webhook to the handlers of the event.
+	// The webhook is always of the type returned by newWebhook. The
+	// progress records the results of the handlers across attempts.
+	handle func(ctx context.Context, webhook interface{}, progress *jobProgress) error
+}
+
+// newRoutes returns the routes of all the webhook events supported by
+// the app, keyed by the value of the "X-Gitlab-Event" header.
+func (app *App) newRoutes() map[string]eventRoute {
+	issueRoute := app.newEventRoute("issue",
+		func() interface{} { return &gitlab.IssueWebhook{} },
+		func(set *HandlerSet) []eventRegistration { return set.issue })
+	noteRoute := app.newEventRoute("note",
+		func() interface{} { return &gitlab.NoteWebhook{} },
+		func(set *HandlerSet) []eventRegistration { return set.note })
+	return map[string]eventRoute{
+		gitlab.EventMergeRequest: {
+			newWebhook: func() interface{} { return &gitlab.MergeRequestWebhook{} },
+			handle: func(ctx context.Context, webhook interface{}, progress *jobProgress) error {
+				return app.onMergeRequestWebhook(ctx, webhook.(*gitlab.MergeRequestWebhook), progress)
+			},
+		},
+		gitlab.EventPipeline: {
+			newWebhook: func() interface{} { return &gitlab.PipelineWebhook{} },
+			handle: func(ctx context.Context, webhook interface{}, progress *jobProgress) error {
+				return app.onPipelineWebhook(ctx, webhook.(*gitlab.PipelineWebhook), progress)
+			},
+		},
+		gitlab.EventPush: app.newEventRoute("push",
+			func() interface{} { return &gitlab.PushWebhook{} },
+			func(set *HandlerSet) []eventRegistration { return set.push }),
+		gitlab.EventTagPush: app.newEventRoute("tag push",
+			func() interface{} { return &gitlab.TagPushWebhook{} },
+			func(set *HandlerSet) []eventRegistration { return set.tagPush }),
+		gitlab.EventIssue:             issueRoute,
+		gitlab.EventConfidentialIssue: issueRoute,
+		gitlab.EventNote:              noteRoute,
+		gitlab.EventConfidentialNote:  noteRoute,
+		gitlab.EventJob: app.newEventRoute("job",
+			func() interface{} { return &gitlab.JobWebhook{} },
+			func(set *HandlerSet) []eventRegistration { return set.job }),
+		gitlab.EventWikiPage: app.newEventRoute("wiki page",
+			func() interface{} { return &gitlab.WikiPageWebhook{} },
+			func(set *HandlerSet) []eventRegistration { return set.wikiPage }),
+		gitlab.EventDeployment: app.newEventRoute("deployment",
+			func() interface{} { return &gitlab.DeploymentWebhook{} },
+			func(set *HandlerSet) []eventRegistration { return set.deployment }),
+		gitlab.EventRelease: app.newEventRoute("release",
+			func() interface{} { return &gitlab.ReleaseWebhook{} },
+			func(set *HandlerSet) []eventRegistration { return set.release }),
+	}
+}
@@ -1,15 +1,22 @@
 package youtrack
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/cookiejar"
 	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/internal/restclient"
+	"github.com/verath/mrgitlab/lib/redact"
 )
 
 // Client is a rest client for YouTrack
@@ -18,19 +25,36 @@ type Client struct {
 	baseURL    *url.URL
 	httpClient *http.Client
 
-	// loginTicketCh is a channel that acts as a mutex for performing
-	// a combined login+request. We use a channel instead of a mutex
-	// so that we can select on context cancellation while awaiting
-	// a ticket.
-	loginTicketCh chan struct{}
+	// loginMu guards the session and the loginCall.
+	loginMu sync.Mutex
+	// session is incremented each time the client has logged in, so
+	// that requests can tell if the client has logged in again since
+	// their session was rejected. Zero if the client never logged in.
+	session uint64
+	// loginCall is the login currently being performed, or nil.
+	loginCall *loginCall
 
 	username string
 	password string
+	// token is the permanent token used for authenticating with the
+	// current API. If empty, the legacy API is used, authenticating
+	// with the username and password.
+	token string
 }
 
-// NewClient creats a new YouTrack API client. The rawBaseURL should point to
-// the root of the YouTrack instance, e.g. "http://track.example.com:8080/".
-// The username and the password is used to authenticate with the YouTrack API.
+// loginTimeout is the max amount of time a login may take.
+const loginTimeout = 30 * time.Second
+
+// issueFields are the fields of an issue requested from the current API.
+const issueFields = "idReadable,summary,description," +
+	"customFields(name,value(name,login,fullName,text,presentation,minutes))," +
+	"links(direction,linkType(name,sourceToTarget,targetToSource),issues(idReadable))"
+
+// NewClient creats a new YouTrack API client, using the legacy REST API of
+// YouTrack. The rawBaseURL should point to the root of the YouTrack instance,
+// e.g. "http://track.example.com:8080/". The username and the password is
+// used to authenticate with the YouTrack API. Use NewTokenClient for servers
+// supporting the current REST API.
 func NewClient(logger *logrus.Logger, rawBaseURL string, username string, password string) (*Client, error) {
 	logEntry := logger.WithField("module", "youtrack")
 	baseURL, err := url.Parse(rawBaseURL)
@@ -47,16 +71,33 @@ func NewClient(logger *logrus.Logger, rawBaseURL string, username string, passwo
 	// Setup the httpClient to use a cookieJar. A cookieJar is required
 	// for the client to be able to store the cookie set when loggin in
 	httpClient := &http.Client{Jar: cookieJar}
-	// Create and add an initial value to the loginTicketCh
-	loginTicketCh := make(chan struct{}, 1)
-	loginTicketCh <- struct{}{}
 	return &Client{
-		logger:        logEntry,
-		baseURL:       baseURL,
-		httpClient:    httpClient,
-		loginTicketCh: loginTicketCh,
-		username:      username,
-		password:      password,
+		logger:     logEntry,
+		baseURL:    baseURL,
+		httpClient: httpClient,
+		username:   username,
+		password:   password,
+	}, nil
+}
+
+// NewTokenClient creates a new YouTrack API client, using the current REST API
+// of YouTrack. The rawBaseURL should point to the root of the YouTrack instance,
+// e.g. "https://example.youtrack.cloud/". The token is a permanent token, used
+// to authenticate with the YouTrack API.
+func NewTokenClient(logger *logrus.Logger, rawBaseURL string, token string) (*Client, error) {
+	logEntry := logger.WithField("module", "youtrack")
+	baseURL, err := url.Parse(rawBaseURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "error parsing apiURL: %s", baseURL)
+	}
+	if token == "" {
+		return nil, errors.New("token is required")
+	}
+	return &Client{
+		logger:     logEntry,
+		baseURL:    baseURL,
+		httpClient: &http.Client{},
+		token:      token,
 	}, nil
 }
 
@@ -69,14 +110,14 @@ func (c *Client) resolvePath(path string) (*url.URL, error) {
 	return c.baseURL.ResolveReference(u), nil
 }
 
-// newRequest creates a new http request, with the provided context and method.
-// The path is resolved against the Client's baseURL.
-func (c *Client) newRequest(ctx context.Context, method string, path string) (*http.Request, error) {
+// newRequest creates a new http request, with the provided context, method
+// and body. The path is resolved against the Client's baseURL.
+func (c *Client) newRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
 	reqURL, err := c.resolvePath(path)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not resolve path: %s", path)
 	}
-	req, err := http.NewRequest(method, reqURL.String(), nil)
+	req, err := http.NewRequest(method, reqURL.String(), body)
 	if err != nil {
 		return nil, errors.Wrapf(err, "could not create request for path: %s", path)
 	}
@@ -84,13 +125,39 @@ func (c *Client) newRequest(ctx context.Context, method string, path string) (*h
 	return req.WithContext(ctx), nil
 }
 
+// newJSONRequest creates a new http request, like newRequest, with the
+// body encoded as JSON.
+func (c *Client) newJSONRequest(ctx context.Context, method string, path string, body interface{}) (*http.Request, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not encode body as JSON")
+	}
+	req, err := c.newRequest(ctx, method, path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// newFormRequest creates a new POST http request, like newRequest, with
+// the form as its body.
+func (c *Client) newFormRequest(ctx context.Context, path string, form url.Values) (*http.Request, error) {
+	req, err := c.newRequest(ctx, "POST", path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
+
 // checkResponse returns an error if the response is not in the
 // 200 range.
 func (c *Client) checkResponse(res *http.Response) error {
 	if res.StatusCode >= 200 && res.StatusCode < 300 {
 		return nil
 	}
-	return newAPIHTTPError(res)
+	return restclient.NewHTTPError(res)
 }
 
 // do performs a request with the Client's httpClient
@@ -99,34 +166,128 @@ func (c *Client) do(req *http.Request) (*http.Response, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "error performing request")
 	}
-	c.logger.Debugf("%s %s - %d", req.Method, req.URL, res.StatusCode)
+	c.logger.Debugf("%s %s - %d", req.Method, redact.URL(req.URL), res.StatusCode)
 	return res, err
 }
 
-// doWithLogin performs a login request followed by the provided request, given
-// that the login request was successful. doWithLogin additionally synchronizes
-// with the loginTicketCh, so that only a single login+req combination is performed
-// at a time.
+// loginCall is a login being performed, that other requests needing to
+// login can wait for instead of logging in themselves.
+type loginCall struct {
+	// done is closed once the login has completed.
+	done chan struct{}
+	// err is the error of the login, set before done is closed.
+	err error
+}
+
+// doWithLogin performs the provided request, authenticated by the session of
+// the client. If the client has not yet logged in, or if the request is rejected
+// as unauthorized, e.g. because the session expired, the client logs in and the
+// request is performed again. Requests are performed concurrently, but only a
+// single login is performed at a time.
 func (c *Client) doWithLogin(ctx context.Context, req *http.Request) (*http.Response, error) {
+	c.loginMu.Lock()
+	session := c.session
+	c.loginMu.Unlock()
+	if session == 0 {
+		if err := c.ensureLogin(ctx, session); err != nil {
+			return nil, errors.Wrap(err, "could not login")
+		}
+	} else {
+		// Performing a request adds the session cookie to it, so the
+		// request is retried using a copy of the original request
+		retryReq := req.Clone(ctx)
+		res, err := c.do(req)
+		if err != nil || res.StatusCode != http.StatusUnauthorized {
+			return res, err
+		}
+		res.Body.Close()
+		c.logger.Debug("Session rejected, logging in again")
+		if err := c.ensureLogin(ctx, session); err != nil {
+			return nil, errors.Wrap(err, "could not login")
+		}
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Wrap(err, "could not reset request body")
+			}
+			retryReq.Body = body
+		}
+		req = retryReq
+	}
+	return c.do(req)
+}
+
+// ensureLogin makes sure that the client has logged in since the given
+// session, logging in if it has not. If another request is already logging
+// in, ensureLogin waits for that login instead of performing its own.
+func (c *Client) ensureLogin(ctx context.Context, session uint64) error {
+	c.loginMu.Lock()
+	if c.session != session {
+		// Logged in by another request since
+		c.loginMu.Unlock()
+		return nil
+	}
+	call := c.loginCall
+	if call == nil {
+		call = &loginCall{done: make(chan struct{})}
+		c.loginCall = call
+		go func() {
+			// The login is not tied to the ctx of this request,
+			// as other requests might be waiting for it
+			loginCtx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+			defer cancel()
+			err := c.login(loginCtx)
+			c.loginMu.Lock()
+			if err == nil {
+				c.session++
+			}
+			c.loginCall = nil
+			call.err = err
+			c.loginMu.Unlock()
+			close(call.done)
+		}()
+	}
+	c.loginMu.Unlock()
 	select {
 	case <-ctx.Done():
-		return nil, ctx.Err()
-	case <-c.loginTicketCh:
+		return ctx.Err()
+	case <-call.done:
+		return call.err
 	}
-	defer func() { c.loginTicketCh <- struct{}{} }()
-	if err := c.login(ctx); err != nil {
-		return nil, errors.Wrap(err, "could not login")
+}
+
+// doWithAuth performs the provided request, authenticated using the token
+// if the client has one, or else by doWithLogin.
+func (c *Client) doWithAuth(ctx context.Context, req *http.Request) (*http.Response, error) {
+	if c.token == "" {
+		return c.doWithLogin(ctx, req)
 	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
 	return c.do(req)
 }
 
+// doWithAuthAndCheck performs the provided request like doWithAuth, and
+// checks that the response status indicates success. The response body
+// is discarded.
+func (c *Client) doWithAuthAndCheck(ctx context.Context, req *http.Request) error {
+	res, err := c.doWithAuth(ctx, req)
+	if err != nil {
+		return errors.Wrap(err, "error performing request")
+	}
+	defer res.Body.Close()
+	return errors.Wrap(c.checkResponse(res), "bad response")
+}
+
 // login performs a login request with the client's username and password.
-// A successful login will result in a session cookie being added to the
-// httpClient's cookie jar, which will then act as authentication for other
-// requests.
+// The credentials are sent as a form in the request body, so that they are
+// not part of the URL. A successful login will result in a session cookie
+// being added to the httpClient's cookie jar, which will then act as
+// authentication for other requests.
 func (c *Client) login(ctx context.Context) error {
-	path := fmt.Sprintf("rest/user/login?login=%s&password=%s", c.username, c.password)
-	req, err := c.newRequest(ctx, "POST", path)
+	form := url.Values{}
+	form.Set("login", c.username)
+	form.Set("password", c.password)
+	req, err := c.newFormRequest(ctx, "rest/user/login", form)
 	if err != nil {
 		return errors.Wrap(err, "error creating request")
 	}
@@ -136,7 +297,7 @@ func (c *Client) login(ctx context.Context) error {
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return newAPIHTTPError(res)
+		return restclient.NewHTTPError(res)
 	}
 	return nil
 }
@@ -151,14 +312,19 @@ func (c *Client) GetIssueURL(ctx context.Context, issueID string) (*url.URL, err
 	return u, nil
 }
 
-// GetIssue returns the Issue identified by the given issueID
+// GetIssue returns the Issue identified by the given issueID. The issue is
+// fetched from the current API if the client has a token, or else from the
+// legacy API.
 func (c *Client) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
-	path := fmt.Sprintf("rest/issue/%s", issueID)
-	req, err := c.newRequest(ctx, "GET", path)
+	path := fmt.Sprintf("rest/issue/%s", url.PathEscape(issueID))
+	if c.token != "" {
+		path = fmt.Sprintf("api/issues/%s?fields=%s", url.PathEscape(issueID), url.QueryEscape(issueFields))
+	}
+	req, err := c.newRequest(ctx, "GET", path, nil)
 	if err != nil {
 		return nil, errors.Wrap(err, "error creating request")
 	}
-	res, err := c.doWithLogin(ctx, req)
+	res, err := c.doWithAuth(ctx, req)
 	if err != nil {
 		return nil, errors.Wrap(err, "error performing request")
 	}
@@ -169,3 +335,108 @@ func (c *Client) GetIssue(ctx context.Context, issueID string) (*Issue, error) {
 	issue := &Issue{}
 	return issue, json.NewDecoder(res.Body).Decode(issue)
 }
+
+// GetComments returns the comments on the issue identified by issueID.
+func (c *Client) GetComments(ctx context.Context, issueID string) ([]*Comment, error) {
+	path := fmt.Sprintf("rest/issue/%s/comment", url.PathEscape(issueID))
+	if c.token != "" {
+		path = fmt.Sprintf("api/issues/%s/comments?fields=id,text,author(login)", url.PathEscape(issueID))
+	}
+	req, err := c.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "error creating request")
+	}
+	res, err := c.doWithAuth(ctx, req)
+	if err != nil {
+		return nil, errors.Wrap(err, "error performing request")
+	}
+	defer res.Body.Close()
+	if err := c.checkResponse(res); err != nil {
+		return nil, errors.Wrap(err, "bad response")
+	}
+	var comments []*Comment
+	return comments, json.NewDecoder(res.Body).Decode(&comments)
+}
+
+// CurrentUserLogin returns the login of the user the client authenticates
+// as, i.e. the author of the comments added by the client. The legacy API
+// authenticates with the login as username, so only the current API is
+// asked for the user.
+func (c *Client) CurrentUserLogin(ctx context.Context) (string, error) {
+	if c.token == "" {
+		return c.username, nil
+	}
+	req, err := c.newRequest(ctx, "GET", "api/users/me?fields=login", nil)
+	if err != nil {
+		return "", errors.Wrap(err, "error creating request")
+	}
+	res, err := c.doWithAuth(ctx, req)
+	if err != nil {
+		return "", errors.Wrap(err, "error performing request")
+	}
+	defer res.Body.Close()
+	if err := c.checkResponse(res); err != nil {
+		return "", errors.Wrap(err, "bad response")
+	}
+	user := jsonUser{}
+	if err := json.NewDecoder(res.Body).Decode(&user); err != nil {
+		return "", errors.Wrap(err, "could not decode user")
+	}
+	return user.Login, nil
+}
+
+// AddComment adds a comment with the given text to the issue identified
+// by issueID.
+func (c *Client) AddComment(ctx context.Context, issueID string, text string) error {
+	var req *http.Request
+	var err error
+	if c.token != "" {
+		path := fmt.Sprintf("api/issues/%s/comments", url.PathEscape(issueID))
+		req, err = c.newJSONRequest(ctx, "POST", path, map[string]string{"text": text})
+	} else {
+		// The legacy API adds comments using the command endpoint
+		path := fmt.Sprintf("rest/issue/%s/execute", url.PathEscape(issueID))
+		req, err = c.newFormRequest(ctx, path, url.Values{"comment": {text}})
+	}
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	return c.doWithAuthAndCheck(ctx, req)
+}
+
+// UpdateComment replaces the text of the comment identified by commentID
+// on the issue identified by issueID.
+func (c *Client) UpdateComment(ctx context.Context, issueID string, commentID string, text string) error {
+	method := "PUT"
+	path := fmt.Sprintf("rest/issue/%s/comment/%s", url.PathEscape(issueID), url.PathEscape(commentID))
+	if c.token != "" {
+		method = "POST"
+		path = fmt.Sprintf("api/issues/%s/comments/%s", url.PathEscape(issueID), url.PathEscape(commentID))
+	}
+	req, err := c.newJSONRequest(ctx, method, path, map[string]string{"text": text})
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	return c.doWithAuthAndCheck(ctx, req)
+}
+
+// ExecuteCommand applies the YouTrack command, e.g. "State Fixed", to the
+// issue identified by issueID.
+func (c *Client) ExecuteCommand(ctx context.Context, issueID string, command string) error {
+	var req *http.Request
+	var err error
+	if c.token != "" {
+		body := map[string]interface{}{
+			"query":  command,
+			"issues": []map[string]string{{"idReadable": issueID}},
+		}
+		req, err = c.newJSONRequest(ctx, "POST", "api/commands", body)
+	} else {
+		path := fmt.Sprintf("rest/issue/%s/execute", url.PathEscape(issueID))
+		req, err = c.newFormRequest(ctx, path, url.Values{"command": {command}})
+	}
+	if err != nil {
+		return errors.Wrap(err, "error creating request")
+	}
+	return c.doWithAuthAndCheck(ctx, req)
+}
@@ -2,38 +2,369 @@ package youtrack
 
 import (
 	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Sirupsen/logrus"
 )
 
-// Test that the login ticket channel is initialized with (at least) one ticket.
-// Without a ticket added, no request would ever be possible as they would
-// always time out waiting for a new ticket
-func TestNewClient_AddsLoginTicket(t *testing.T) {
+func TestGetIssueURL(t *testing.T) {
 	c, err := NewClient(logrus.New(), "http://track.example.com:8080/", "user", "pass")
 	if err != nil {
 		t.Fatalf("unexpected error: %+v", err)
 	}
-	select {
-	case <-c.loginTicketCh:
-	default:
-		t.Error("loginTicketCh was blocking (no ticket added)")
+	expected, _ := url.Parse("http://track.example.com:8080/issue/XYZ-989")
+	actual, err := c.GetIssueURL(context.Background(), "XYZ-989")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if actual.String() != expected.String() {
+		t.Errorf("expected '%s', got: '%s'", expected, actual)
 	}
 }
 
-func TestGetIssueURL(t *testing.T) {
-	c, err := NewClient(logrus.New(), "http://track.example.com:8080/", "user", "pass")
+func TestTokenClient_GetIssue(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/issues/XYZ-996" {
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("fields") != issueFields {
+			t.Errorf("unexpected fields: %s", r.URL.Query().Get("fields"))
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer perm:token" {
+			t.Errorf("unexpected Authorization header: '%s'", auth)
+		}
+		w.Write([]byte(modernIssueJSON))
+	}))
+	defer server.Close()
+	c, err := NewTokenClient(logrus.New(), server.URL+"/", "perm:token")
 	if err != nil {
 		t.Fatalf("unexpected error: %+v", err)
 	}
-	expected, _ := url.Parse("http://track.example.com:8080/issue/XYZ-989")
-	actual, err := c.GetIssueURL(context.Background(), "XYZ-989")
+	issue, err := c.GetIssue(context.Background(), "XYZ-996")
 	if err != nil {
 		t.Fatalf("unexpected error: %+v", err)
 	}
-	if actual.String() != expected.String() {
-		t.Errorf("expected '%s', got: '%s'", expected, actual)
+	if issue.ID != "XYZ-996" || issue.State != "Open" {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+}
+
+func TestTokenClient_GetIssueNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+	c, err := NewTokenClient(logrus.New(), server.URL+"/", "perm:token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	_, err = c.GetIssue(context.Background(), "XYZ-996")
+	if !IsHTTPStatusError(err, http.StatusNotFound) {
+		t.Errorf("expected a not found error, got: %+v", err)
+	}
+}
+
+// Test that the credentials are sent in the body of the login request,
+// and not in its URL.
+func TestClient_LoginWithFormBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/user/login":
+			if r.URL.RawQuery != "" {
+				t.Errorf("expected no query in login URL, was: '%s'", r.URL.RawQuery)
+			}
+			if r.Method != "POST" || r.PostFormValue("login") != "user" || r.PostFormValue("password") != "pass" {
+				t.Errorf("unexpected login request: %s %v", r.Method, r.PostForm)
+			}
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "session", Path: "/"})
+		case "/rest/issue/XYZ-996":
+			if _, err := r.Cookie("JSESSIONID"); err != nil {
+				t.Error("expected session cookie to be sent")
+			}
+			w.Write([]byte(issueJSON))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL+"/", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	issue, err := c.GetIssue(context.Background(), "XYZ-996")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if issue.ID != "XYZ-996" {
+		t.Errorf("unexpected issue: %+v", issue)
+	}
+}
+
+// newSessionTestServer returns a test server accepting the session of the
+// last login, counting the logins. Issue requests with any other session
+// are rejected as unauthorized. The issueHandler, if set, is called for
+// each authorized issue request.
+func newSessionTestServer(t *testing.T, issueHandler func()) (*httptest.Server, *int32) {
+	var logins int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := strconv.Itoa(int(atomic.LoadInt32(&logins)))
+		switch r.URL.Path {
+		case "/rest/user/login":
+			session = strconv.Itoa(int(atomic.AddInt32(&logins, 1)))
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: session, Path: "/"})
+		case "/rest/issue/XYZ-996":
+			if cookie, err := r.Cookie("JSESSIONID"); err != nil || cookie.Value != session {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if issueHandler != nil {
+				issueHandler()
+			}
+			w.Write([]byte(issueJSON))
+		default:
+			t.Errorf("unexpected path: %s", r.URL.Path)
+		}
+	}))
+	return server, &logins
+}
+
+func TestClient_ReusesSession(t *testing.T) {
+	server, logins := newSessionTestServer(t, nil)
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL+"/", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetIssue(context.Background(), "XYZ-996"); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	if n := atomic.LoadInt32(logins); n != 1 {
+		t.Errorf("expected 1 login, was: %d", n)
+	}
+}
+
+// Test that the client logs in again once its session is rejected.
+func TestClient_LoginsAgainOnUnauthorized(t *testing.T) {
+	server, logins := newSessionTestServer(t, nil)
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL+"/", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if _, err := c.GetIssue(context.Background(), "XYZ-996"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	// Expire the session of the client by logging in another client
+	other, _ := NewClient(logrus.New(), server.URL+"/", "user", "pass")
+	if _, err := other.GetIssue(context.Background(), "XYZ-996"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if _, err := c.GetIssue(context.Background(), "XYZ-996"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if n := atomic.LoadInt32(logins); n != 3 {
+		t.Errorf("expected 3 logins, was: %d", n)
+	}
+}
+
+// Test that concurrent requests are performed in parallel, sharing
+// a single login.
+func TestClient_ConcurrentRequests(t *testing.T) {
+	const numRequests = 5
+	var inFlight sync.WaitGroup
+	inFlight.Add(numRequests)
+	server, logins := newSessionTestServer(t, func() {
+		// Block until all requests are in flight at the same time
+		inFlight.Done()
+		inFlight.Wait()
+	})
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL+"/", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	errCh := make(chan error, numRequests)
+	for i := 0; i < numRequests; i++ {
+		go func() {
+			_, err := c.GetIssue(ctx, "XYZ-996")
+			errCh <- err
+		}()
+	}
+	for i := 0; i < numRequests; i++ {
+		if err := <-errCh; err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	if n := atomic.LoadInt32(logins); n != 1 {
+		t.Errorf("expected 1 login, was: %d", n)
+	}
+}
+
+func TestTokenClient_Comments(t *testing.T) {
+	var added, updated string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Text string `json:"text"`
+		}
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/issues/XYZ-996/comments":
+			w.Write([]byte(`[{"id": "4-1", "text": "Hello", "author": {"login": "bot"}}]`))
+			return
+		case "POST /api/issues/XYZ-996/comments":
+			json.NewDecoder(r.Body).Decode(&body)
+			added = body.Text
+		case "POST /api/issues/XYZ-996/comments/4-1":
+			json.NewDecoder(r.Body).Decode(&body)
+			updated = body.Text
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+		if contentType := r.Header.Get("Content-Type"); contentType != "application/json" {
+			t.Errorf("unexpected Content-Type: '%s'", contentType)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+	c, err := NewTokenClient(logrus.New(), server.URL+"/", "perm:token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	ctx := context.Background()
+	comments, err := c.GetComments(ctx, "XYZ-996")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(comments) != 1 || comments[0].ID != "4-1" || comments[0].Text != "Hello" || comments[0].Author != "bot" {
+		t.Errorf("unexpected comments: %+v", comments)
+	}
+	if err := c.AddComment(ctx, "XYZ-996", "Added"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if err := c.UpdateComment(ctx, "XYZ-996", "4-1", "Updated"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if added != "Added" || updated != "Updated" {
+		t.Errorf("unexpected added '%s' and updated '%s' texts", added, updated)
+	}
+}
+
+func TestTokenClient_CurrentUserLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/users/me" || r.URL.Query().Get("fields") != "login" {
+			t.Errorf("unexpected request: %s", r.URL)
+		}
+		w.Write([]byte(`{"login": "bot", "$type": "Me"}`))
+	}))
+	defer server.Close()
+	c, err := NewTokenClient(logrus.New(), server.URL+"/", "perm:token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	login, err := c.CurrentUserLogin(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if login != "bot" {
+		t.Errorf("expected login 'bot', got: '%s'", login)
+	}
+}
+
+func TestClient_Comments(t *testing.T) {
+	var added, updated string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/user/login":
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "session", Path: "/"})
+		case "GET /rest/issue/XYZ-996/comment":
+			w.Write([]byte(`[{"id": "4-1", "text": "Hello", "author": "bot"}]`))
+		case "POST /rest/issue/XYZ-996/execute":
+			added = r.PostFormValue("comment")
+		case "PUT /rest/issue/XYZ-996/comment/4-1":
+			var body struct {
+				Text string `json:"text"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			updated = body.Text
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	c, err := NewClient(logrus.New(), server.URL+"/", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	ctx := context.Background()
+	comments, err := c.GetComments(ctx, "XYZ-996")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if len(comments) != 1 || comments[0].ID != "4-1" || comments[0].Author != "bot" {
+		t.Errorf("unexpected comments: %+v", comments)
+	}
+	if err := c.AddComment(ctx, "XYZ-996", "Added"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if err := c.UpdateComment(ctx, "XYZ-996", "4-1", "Updated"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if added != "Added" || updated != "Updated" {
+		t.Errorf("unexpected added '%s' and updated '%s' texts", added, updated)
+	}
+}
+
+func TestExecuteCommand(t *testing.T) {
+	var command, issueID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "POST /rest/user/login":
+			http.SetCookie(w, &http.Cookie{Name: "JSESSIONID", Value: "session", Path: "/"})
+		case "POST /rest/issue/XYZ-996/execute":
+			command, issueID = r.PostFormValue("command"), "XYZ-996"
+		case "POST /api/commands":
+			var body struct {
+				Query  string `json:"query"`
+				Issues []struct {
+					IDReadable string `json:"idReadable"`
+				} `json:"issues"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			command = body.Query
+			if len(body.Issues) == 1 {
+				issueID = body.Issues[0].IDReadable
+			}
+		default:
+			t.Errorf("unexpected request: %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+	legacyClient, err := NewClient(logrus.New(), server.URL+"/", "user", "pass")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	tokenClient, err := NewTokenClient(logrus.New(), server.URL+"/", "perm:token")
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	for _, c := range []*Client{legacyClient, tokenClient} {
+		command, issueID = "", ""
+		if err := c.ExecuteCommand(context.Background(), "XYZ-996", "State Fixed"); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if command != "State Fixed" || issueID != "XYZ-996" {
+			t.Errorf("unexpected command '%s' for issue '%s'", command, issueID)
+		}
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"testing"
 
 	"github.com/pkg/errors"
+	"github.com/verath/mrgitlab/lib/internal/restclient"
 )
 
 func TestIsHTTPStatusError(t *testing.T) {
@@ -16,28 +17,28 @@ func TestIsHTTPStatusError(t *testing.T) {
 		// paramters we have given it
 		expected bool
 	}{
-		// An error that is not an apiHTTPError does not have
+		// An error that is not an HTTPError does not have
 		// a status code, so should never match.
 		{
 			err:        errors.New("generic error"),
 			statusCode: 400,
 			expected:   false,
 		},
-		// apiHTTPError with the same status code as tested against
+		// HTTPError with the same status code as tested against
 		{
-			err:        apiHTTPError{statusCode: 400},
+			err:        restclient.HTTPError{StatusCode: 400},
 			statusCode: 400,
 			expected:   true,
 		},
-		// apiHTTPError with another status code than tested against
+		// HTTPError with another status code than tested against
 		{
-			err:        apiHTTPError{statusCode: 500},
+			err:        restclient.HTTPError{StatusCode: 500},
 			statusCode: 400,
 			expected:   false,
 		},
 		// Make sure that we unwrap pkg/errors errors
 		{
-			err:        errors.Wrap(apiHTTPError{statusCode: 500}, "wrapped apiHTTPError"),
+			err:        errors.Wrap(restclient.HTTPError{StatusCode: 500}, "wrapped HTTPError"),
 			statusCode: 400,
 			expected:   false,
 		},
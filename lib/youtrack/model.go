@@ -2,13 +2,35 @@ package youtrack
 
 import (
 	"encoding/json"
+	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-// Issue is a YouTrack issue as it is returned by the API.
+// Issue is a YouTrack issue as it is returned by the API. Issues returned
+// by both the legacy ("rest/issue") and the current ("api/issues") API are
+// decoded into the same Issue.
 type Issue struct {
-	Fields []IssueField `json:"field"`
+	// ID is the human readable id of the issue, e.g. "XYZ-982".
+	ID          string
+	Summary     string
+	Description string
+	// State is the name of the value of the "State" field, or
+	// empty if the issue has no such field.
+	State string
+	// Assignee is the value of the "Assignee" field, or nil if
+	// the issue is not assigned.
+	Assignee *User
+	// Priority is the name of the value of the "Priority" field,
+	// or empty if the issue has no such field.
+	Priority string
+	// Links are the links from the issue to other issues.
+	Links []IssueLink
+	// Fields are the fields of the issue, as returned by the API. For
+	// the legacy API this is all fields of the issue, and for the current
+	// API it is the custom fields of the issue.
+	Fields []IssueField
 }
 
 // IssueField is a field (aprox. key-value pair) attached to
@@ -18,6 +40,223 @@ type IssueField struct {
 	Value json.RawMessage `json:"value"`
 }
 
+// User is a YouTrack user, as referenced by fields of an issue.
+type User struct {
+	Login    string
+	FullName string
+}
+
+// The type and role of the link from a subtask to its parent issue.
+const (
+	subtaskLinkType = "Subtask"
+	subtaskOfRole   = "subtask of"
+)
+
+// IssueLink is a link from an issue to another issue.
+type IssueLink struct {
+	// Role is the name of the link as seen from the issue, e.g.
+	// "subtask of" or "relates to".
+	Role string `json:"role"`
+	// Type is the name of the type of the link, e.g. "Subtask".
+	Type string `json:"type"`
+	// IssueID is the id of the linked issue, e.g. "XYZ-990".
+	IssueID string `json:"value"`
+}
+
+// rawLink is a link type of an issue, and the issues linked by
+// it, as returned by the current API.
+type rawLink struct {
+	// Direction is "OUTWARD", "INWARD" or, for links that are not
+	// directed, "BOTH".
+	Direction string `json:"direction"`
+	LinkType  struct {
+		Name           string `json:"name"`
+		SourceToTarget string `json:"sourceToTarget"`
+		TargetToSource string `json:"targetToSource"`
+	} `json:"linkType"`
+	Issues []struct {
+		IDReadable string `json:"idReadable"`
+	} `json:"issues"`
+}
+
+// toIssueLinks converts the rawLink to an IssueLink for each of its issues.
+func (link rawLink) toIssueLinks() []IssueLink {
+	role := link.LinkType.SourceToTarget
+	if link.Direction == "INWARD" {
+		role = link.LinkType.TargetToSource
+	}
+	links := make([]IssueLink, len(link.Issues))
+	for i, issue := range link.Issues {
+		links[i] = IssueLink{Role: role, Type: link.LinkType.Name, IssueID: issue.IDReadable}
+	}
+	return links
+}
+
+// rawIssue is the union of the data of an issue returned by the
+// legacy API and the current API.
+type rawIssue struct {
+	// Returned by the legacy API, where ID is the human readable id
+	ID     string       `json:"id"`
+	Fields []IssueField `json:"field"`
+	// Returned by the current API
+	IDReadable   string       `json:"idReadable"`
+	Summary      string       `json:"summary"`
+	Description  string       `json:"description"`
+	CustomFields []IssueField `json:"customFields"`
+	Links        []rawLink    `json:"links"`
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding an
+// issue returned by either the legacy or the current API.
+func (issue *Issue) UnmarshalJSON(data []byte) error {
+	var raw rawIssue
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw.Fields != nil {
+		// Legacy API, where all values are fields
+		*issue = Issue{ID: raw.ID, Fields: raw.Fields}
+		issue.Summary, _ = issue.FieldStringValue("summary")
+		issue.Description, _ = issue.FieldStringValue("description")
+		if links := issue.fieldValue("links"); links != nil {
+			if err := json.Unmarshal(links, &issue.Links); err != nil {
+				return errors.Wrap(err, "could not decode links")
+			}
+		}
+	} else {
+		*issue = Issue{
+			ID:          raw.IDReadable,
+			Summary:     raw.Summary,
+			Description: raw.Description,
+			Fields:      raw.CustomFields,
+		}
+		for _, link := range raw.Links {
+			issue.Links = append(issue.Links, link.toIssueLinks()...)
+		}
+	}
+	issue.State = decodeEnumValue(issue.fieldValue("State"))
+	issue.Priority = decodeEnumValue(issue.fieldValue("Priority"))
+	issue.Assignee = decodeUserValue(issue.fieldValue("Assignee"))
+	return nil
+}
+
+// fieldValue returns the raw value of the field with the provided name,
+// or nil if the issue has no such field.
+func (issue *Issue) fieldValue(name string) json.RawMessage {
+	for _, v := range issue.Fields {
+		if v.Name == name {
+			return v.Value
+		}
+	}
+	return nil
+}
+
+// decodeEnumValues decodes the names of the values of an enum field. The
+// legacy API returns enum values as lists of names, e.g. ["Open"], and the
+// current API as objects, e.g. {"name": "Open"}, or lists of objects for
+// fields with multiple values. Returns nil if the value is empty or not
+// an enum value.
+func decodeEnumValues(value json.RawMessage) []string {
+	var names []string
+	if err := json.Unmarshal(value, &names); err == nil {
+		return names
+	}
+	var object struct {
+		Name *string `json:"name"`
+	}
+	if err := json.Unmarshal(value, &object); err == nil && object.Name != nil {
+		return []string{*object.Name}
+	}
+	var objects []struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(value, &objects); err == nil {
+		names = make([]string, len(objects))
+		for i, object := range objects {
+			names[i] = object.Name
+		}
+		return names
+	}
+	return nil
+}
+
+// decodeEnumValue decodes the name of the first value of an enum field,
+// or returns an empty string if the field has no values.
+func decodeEnumValue(value json.RawMessage) string {
+	if names := decodeEnumValues(value); len(names) > 0 {
+		return names[0]
+	}
+	return ""
+}
+
+// jsonUser is the union of a user value of the legacy API, where the
+// login is named "value", and of the current API.
+type jsonUser struct {
+	Value    string `json:"value"`
+	Login    string `json:"login"`
+	FullName string `json:"fullName"`
+}
+
+// toUser converts the jsonUser to a User, or nil if it has no login.
+func (u jsonUser) toUser() *User {
+	login := u.Login
+	if login == "" {
+		login = u.Value
+	}
+	if login == "" {
+		return nil
+	}
+	return &User{Login: login, FullName: u.FullName}
+}
+
+// decodeUserValues decodes the users of a user field. The legacy API
+// returns users as lists of objects, and the current API as objects or
+// lists of objects for fields with multiple values. Returns nil if the
+// value is empty or not a user value.
+func decodeUserValues(value json.RawMessage) []User {
+	var jsonUsers []jsonUser
+	if err := json.Unmarshal(value, &jsonUsers); err != nil {
+		var single jsonUser
+		if err := json.Unmarshal(value, &single); err != nil {
+			return nil
+		}
+		jsonUsers = []jsonUser{single}
+	}
+	users := make([]User, 0, len(jsonUsers))
+	for _, u := range jsonUsers {
+		if user := u.toUser(); user != nil {
+			users = append(users, *user)
+		}
+	}
+	return users
+}
+
+// decodeUserValue decodes the first user of a user field, or returns
+// nil if the field has no users.
+func decodeUserValue(value json.RawMessage) *User {
+	if users := decodeUserValues(value); len(users) > 0 {
+		return &users[0]
+	}
+	return nil
+}
+
+// decodeTimeValue decodes a timestamp, in milliseconds since the epoch. The
+// legacy API returns timestamps as strings, e.g. "1502968008698", and the
+// current API as numbers.
+func decodeTimeValue(value json.RawMessage) (time.Time, error) {
+	var millis int64
+	if err := json.Unmarshal(value, &millis); err != nil {
+		var str string
+		if err := json.Unmarshal(value, &str); err != nil {
+			return time.Time{}, errors.New("value is not a timestamp")
+		}
+		if millis, err = strconv.ParseInt(str, 10, 64); err != nil {
+			return time.Time{}, errors.Wrapf(err, "value '%s' is not a timestamp", str)
+		}
+	}
+	return time.Unix(0, millis*int64(time.Millisecond)), nil
+}
+
 // FieldStringValue is a helper method for extracting the value for a
 // field with the provided name, where the value is expected to be
 // a string. Returns an error if the field did not exist, or if
@@ -31,3 +270,92 @@ func (issue *Issue) FieldStringValue(name string) (string, error) {
 	}
 	return "", errors.Errorf("no value for Name '%s'", name)
 }
+
+// FieldEnumValues returns the names of the values of the enum field with
+// the provided name, e.g. ["Task"] for the "Type" field. Returns an error
+// if the field did not exist, or if it was not an enum field.
+func (issue *Issue) FieldEnumValues(name string) ([]string, error) {
+	value := issue.fieldValue(name)
+	if value == nil {
+		return nil, errors.Errorf("no value for Name '%s'", name)
+	}
+	if string(value) == "null" {
+		return nil, nil
+	}
+	names := decodeEnumValues(value)
+	if names == nil {
+		return nil, errors.Errorf("value for Name '%s' is not an enum", name)
+	}
+	return names, nil
+}
+
+// FieldUserValues returns the users of the user field with the provided
+// name, e.g. the "Assignee" field. Returns an error if the field did not
+// exist, or if it was not a user field.
+func (issue *Issue) FieldUserValues(name string) ([]User, error) {
+	value := issue.fieldValue(name)
+	if value == nil {
+		return nil, errors.Errorf("no value for Name '%s'", name)
+	}
+	if string(value) == "null" {
+		return nil, nil
+	}
+	users := decodeUserValues(value)
+	if users == nil {
+		return nil, errors.Errorf("value for Name '%s' is not a user", name)
+	}
+	return users, nil
+}
+
+// FieldTimeValue returns the time of the timestamp field with the provided
+// name, e.g. the "created" field of the legacy API. Returns an error if the
+// field did not exist, or if it was not a timestamp in milliseconds since
+// the epoch.
+func (issue *Issue) FieldTimeValue(name string) (time.Time, error) {
+	value := issue.fieldValue(name)
+	if value == nil {
+		return time.Time{}, errors.Errorf("no value for Name '%s'", name)
+	}
+	t, err := decodeTimeValue(value)
+	return t, errors.Wrapf(err, "invalid value for Name '%s'", name)
+}
+
+// Parent returns the id of the parent issue of the issue, i.e. the issue
+// it is a subtask of, or an empty string if it is not a subtask.
+func (issue *Issue) Parent() string {
+	for _, link := range issue.Links {
+		if link.Type == subtaskLinkType && link.Role == subtaskOfRole {
+			return link.IssueID
+		}
+	}
+	return ""
+}
+
+// Comment is a comment on a YouTrack issue.
+type Comment struct {
+	ID   string
+	Text string
+	// Author is the login of the user that wrote the comment.
+	Author string
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface, decoding a
+// comment returned by either the legacy or the current API. The legacy
+// API returns the author as a login, and the current API as a user object.
+func (comment *Comment) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID     string          `json:"id"`
+		Text   string          `json:"text"`
+		Author json.RawMessage `json:"author"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*comment = Comment{ID: raw.ID, Text: raw.Text}
+	if err := json.Unmarshal(raw.Author, &comment.Author); err != nil {
+		if author := decodeUserValue(raw.Author); author != nil {
+			comment.Author = author.Login
+		}
+	}
+	return nil
+}
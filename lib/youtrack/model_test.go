@@ -1,7 +1,11 @@
 package youtrack
 
-import "testing"
-import "encoding/json"
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
 
 var issueJSON = `{
     "comment": [
@@ -208,3 +212,209 @@ func TestIssueFieldStringValue(t *testing.T) {
 		t.Error("expected an error when trying to access value of non-existing field")
 	}
 }
+
+var modernIssueJSON = `{
+    "idReadable": "XYZ-996",
+    "summary": "Product X example code problems",
+    "description": "Solve issues.",
+    "customFields": [
+        {
+            "name": "Priority",
+            "value": {"name": "Major", "$type": "EnumBundleElement"},
+            "$type": "SingleEnumIssueCustomField"
+        },
+        {
+            "name": "State",
+            "value": {"name": "Open", "$type": "StateBundleElement"},
+            "$type": "StateIssueCustomField"
+        },
+        {
+            "name": "Assignee",
+            "value": {"login": "Tester_Test", "fullName": "Tester Test", "$type": "User"},
+            "$type": "SingleUserIssueCustomField"
+        },
+        {
+            "name": "Fix versions",
+            "value": [],
+            "$type": "MultiVersionIssueCustomField"
+        },
+        {
+            "name": "Sprints",
+            "value": [{"name": "S65", "$type": "Sprint"}, {"name": "S66", "$type": "Sprint"}],
+            "$type": "MultiEnumIssueCustomField"
+        },
+        {
+            "name": "Reviewers",
+            "value": [{"login": "jsmith", "fullName": "John Smith", "$type": "User"}],
+            "$type": "MultiUserIssueCustomField"
+        },
+        {
+            "name": "Due Date",
+            "value": 1505119826922,
+            "$type": "DateIssueCustomField"
+        }
+    ],
+    "links": [
+        {
+            "direction": "INWARD",
+            "linkType": {"name": "Subtask", "sourceToTarget": "parent for", "targetToSource": "subtask of"},
+            "issues": [{"idReadable": "XYZ-990"}]
+        },
+        {
+            "direction": "OUTWARD",
+            "linkType": {"name": "Subtask", "sourceToTarget": "parent for", "targetToSource": "subtask of"},
+            "issues": []
+        },
+        {
+            "direction": "BOTH",
+            "linkType": {"name": "Relates", "sourceToTarget": "relates to", "targetToSource": ""},
+            "issues": [{"idReadable": "XYZ-7"}, {"idReadable": "XYZ-8"}]
+        }
+    ],
+    "$type": "Issue"
+}`
+
+func TestIssueUnmarshal_Typed(t *testing.T) {
+	tests := []struct {
+		json     string
+		expected Issue
+	}{
+		{issueJSON, Issue{
+			ID:          "XYZ-996",
+			Summary:     "Product X example code problems",
+			Description: "==Description==\n- Solve issues. Product X is currently using Y for Z. This might not be an optimal solution as X is shipped to customers.",
+			State:       "Done",
+			Assignee:    &User{Login: "Tester_Test", FullName: "Tester Test"},
+			Links:       []IssueLink{{Role: "subtask of", Type: "Subtask", IssueID: "XYZ-990"}},
+		}},
+		{modernIssueJSON, Issue{
+			ID:          "XYZ-996",
+			Summary:     "Product X example code problems",
+			Description: "Solve issues.",
+			State:       "Open",
+			Assignee:    &User{Login: "Tester_Test", FullName: "Tester Test"},
+			Priority:    "Major",
+			Links: []IssueLink{
+				{Role: "subtask of", Type: "Subtask", IssueID: "XYZ-990"},
+				{Role: "relates to", Type: "Relates", IssueID: "XYZ-7"},
+				{Role: "relates to", Type: "Relates", IssueID: "XYZ-8"},
+			},
+		}},
+		{`{"idReadable": "XYZ-1", "summary": "Unassigned", "customFields": [{"name": "Assignee", "value": null}]}`, Issue{
+			ID:      "XYZ-1",
+			Summary: "Unassigned",
+		}},
+	}
+	for _, test := range tests {
+		issue := &Issue{}
+		if err := json.Unmarshal([]byte(test.json), issue); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		issue.Fields = nil
+		if !reflect.DeepEqual(*issue, test.expected) {
+			t.Errorf("expected issue %+v, was: %+v", test.expected, *issue)
+		}
+	}
+}
+
+func TestIssueFieldEnumValues(t *testing.T) {
+	tests := []struct {
+		json     string
+		name     string
+		expected []string
+	}{
+		{issueJSON, "Type", []string{"Task"}},
+		{issueJSON, "Sprint", []string{"S65"}},
+		{modernIssueJSON, "State", []string{"Open"}},
+		{modernIssueJSON, "Sprints", []string{"S65", "S66"}},
+		{modernIssueJSON, "Fix versions", []string{}},
+	}
+	for _, test := range tests {
+		issue := &Issue{}
+		if err := json.Unmarshal([]byte(test.json), issue); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		actual, err := issue.FieldEnumValues(test.name)
+		if err != nil {
+			t.Fatalf("unexpected error for field '%s': %+v", test.name, err)
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("expected %v for field '%s', was: %v", test.expected, test.name, actual)
+		}
+	}
+	issue := &Issue{}
+	json.Unmarshal([]byte(issueJSON), issue)
+	if _, err := issue.FieldEnumValues("NON-EXISTING"); err == nil {
+		t.Error("expected an error when trying to access value of non-existing field")
+	}
+}
+
+func TestIssueFieldUserValues(t *testing.T) {
+	tests := []struct {
+		json     string
+		name     string
+		expected []User
+	}{
+		{issueJSON, "Assignee", []User{{Login: "Tester_Test", FullName: "Tester Test"}}},
+		{modernIssueJSON, "Assignee", []User{{Login: "Tester_Test", FullName: "Tester Test"}}},
+		{modernIssueJSON, "Reviewers", []User{{Login: "jsmith", FullName: "John Smith"}}},
+	}
+	for _, test := range tests {
+		issue := &Issue{}
+		if err := json.Unmarshal([]byte(test.json), issue); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		actual, err := issue.FieldUserValues(test.name)
+		if err != nil {
+			t.Fatalf("unexpected error for field '%s': %+v", test.name, err)
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("expected %v for field '%s', was: %v", test.expected, test.name, actual)
+		}
+	}
+	issue := &Issue{}
+	json.Unmarshal([]byte(issueJSON), issue)
+	if _, err := issue.FieldUserValues("summary"); err == nil {
+		t.Error("expected an error when trying to access a string field as users")
+	}
+}
+
+func TestIssueFieldTimeValue(t *testing.T) {
+	expected := time.Date(2017, time.September, 11, 8, 50, 26, 922000000, time.UTC)
+	for _, test := range []struct{ json, name string }{
+		{issueJSON, "resolved"},
+		{modernIssueJSON, "Due Date"},
+	} {
+		issue := &Issue{}
+		if err := json.Unmarshal([]byte(test.json), issue); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		actual, err := issue.FieldTimeValue(test.name)
+		if err != nil {
+			t.Fatalf("unexpected error for field '%s': %+v", test.name, err)
+		}
+		if !actual.Equal(expected) {
+			t.Errorf("expected %s for field '%s', was: %s", expected, test.name, actual)
+		}
+	}
+	issue := &Issue{}
+	json.Unmarshal([]byte(issueJSON), issue)
+	if _, err := issue.FieldTimeValue("summary"); err == nil {
+		t.Error("expected an error when trying to access a string field as a time")
+	}
+}
+
+func TestIssueParent(t *testing.T) {
+	for _, data := range []string{issueJSON, modernIssueJSON} {
+		issue := &Issue{}
+		if err := json.Unmarshal([]byte(data), issue); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if parent := issue.Parent(); parent != "XYZ-990" {
+			t.Errorf("expected parent 'XYZ-990', was: '%s'", parent)
+		}
+	}
+	if parent := (&Issue{}).Parent(); parent != "" {
+		t.Errorf("expected no parent, was: '%s'", parent)
+	}
+}
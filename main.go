@@ -1,37 +1,24 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
-	"regexp"
-	"strings"
 	"syscall"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/verath/mrgitlab/lib"
+	"github.com/verath/mrgitlab/lib/config"
 	"github.com/verath/mrgitlab/lib/gitlab"
-	"github.com/verath/mrgitlab/lib/handlers"
-	"github.com/verath/mrgitlab/lib/youtrack"
+	"github.com/verath/mrgitlab/lib/queue"
+	"github.com/verath/mrgitlab/lib/redact"
 )
 
 func main() {
-	serverAddr := flag.String("addr", ":3000",
-		"TCP address where the server should listen for webhooks")
-	gitlabBaseURL := flag.String("gitlab-url", "https://gitlab.com/",
-		"The base URL of the GitLab server")
-	gitlabToken := flag.String("gitlab-token", "",
-		"The GitLab private token to use for request to the GitLab server")
-	webhookToken := flag.String("webhook-token", "",
-		"The webhook token that, if non-empty, must be included in the webhook calls")
-	youtrackBaseURL := flag.String("youtrack-url", "http://track.example.com:8080/",
-		"The base URL of the YouTrack server")
-	youtrackUsername := flag.String("youtrack-username", "",
-		"The YouTrack username of the user to use for authentication")
-	youtrackPassword := flag.String("youtrack-password", "",
-		"The YouTrack password of the user to use for authentication")
+	configFile := flag.String("config", "mrgitlab.yml",
+		"Path of the YAML config file, declaring the settings and handlers to use")
 	debug := flag.Bool("debug", false,
 		"Enables more verbose debug logging")
 	flag.Parse()
@@ -44,68 +31,98 @@ func main() {
 		logger.Debug("Debug logging enabled")
 	}
 
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		logger.Fatalf("Error loading config: %v", err)
+	}
+	// Mask the secrets of the config, should they end up in a log entry
+	redactHook := redact.NewHook(cfg.Secrets()...)
+	logger.Hooks.Add(redactHook)
+
 	// Setup the app, its dependencies, and register our handlers
-	gitlabClient, err := gitlab.NewClient(logger, *gitlabBaseURL, *gitlabToken)
+	gitlabClient, err := gitlab.NewClient(logger, cfg.GitLab.URL, cfg.GitLab.Token)
 	if err != nil {
 		logger.Fatalf("Error creating gitlabClient: %+v", err)
 	}
-	app, err := mrgitlab.New(logger, gitlabClient, *webhookToken)
+	jobQueue, err := queue.Open(cfg.Server.QueueFile)
+	if err != nil {
+		logger.Fatalf("Error opening job queue: %+v", err)
+	}
+	defer jobQueue.Close()
+	deadLetters, err := queue.OpenDeadLetters(cfg.Server.DeadLetterFile)
+	if err != nil {
+		logger.Fatalf("Error opening dead letter store: %+v", err)
+	}
+	app, err := mrgitlab.New(logger, gitlabClient, cfg.Server.WebhookToken, jobQueue, deadLetters)
 	if err != nil {
 		logger.Fatalf("Error creating app: %+v", err)
 	}
+	app.SetSecretFields(cfg.Server.SecretFields...)
 
-	// Setup the YouTrack client
-	youTrackClient, err := youtrack.NewClient(logger, *youtrackBaseURL,
-		*youtrackUsername, *youtrackPassword)
+	// Create the handlers declared in the config. It is the handlers
+	// that provide messages back to the gitlab merge request.
+	handlerSet, err := buildHandlers(logger, cfg)
 	if err != nil {
-		logger.Fatalf("error creating YouTrack Client: %+v", err)
+		logger.Fatalf("Error creating handlers: %v", err)
 	}
+	app.ReplaceHandlers(handlerSet)
 
-	// Register the merge request handlers. It is the handlers that provide
-	// messages back to the gitlab merge request.
-	youtrackMsg := handlers.NewYouTrack(youTrackClient, func(webhook *gitlab.MergeRequestWebhook) string {
-		return youtrackBranchNameFilter(webhook.ObjectAttributes.SourceBranch)
-	})
-	beepBoopMsg := handlers.NewMessage("BeepBoop!")
-	app.RegisterMergeRequestHandler("open", youtrackMsg)
-	app.RegisterMergeRequestHandler("open", beepBoopMsg)
+	// Start the workers handling the webhooks received by the app.
+	app.Start(cfg.Server.Workers)
 
 	// Setup an http server that forwards requests on "/" to the app
 	// instance. We also define a /healthcheck endpoint for quick remote
-	// health-checking.
+	// health-checking, and, if we have an admin token, the /admin/ endpoints.
 	http.Handle("/", app)
+	if cfg.Server.AdminToken != "" {
+		http.Handle("/admin/", http.StripPrefix("/admin", app.AdminHandler(cfg.Server.AdminToken)))
+	}
 	http.HandleFunc("/healthcheck", func(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte("OK"))
 	})
-	httpServer := &http.Server{Addr: *serverAddr}
+	httpServer := &http.Server{Addr: cfg.Server.Addr}
 	// Run the HTTP server, waiting for webhooks. We also
 	// listen for interrupt signals (such as ctrl+c) to make
-	// use stoppable.
+	// use stoppable, and for SIGHUP to reload the handlers.
 	errCh := make(chan error)
 	go func() { errCh <- httpServer.ListenAndServe() }()
 	logger.Infof("HTTP server running at '%s'", httpServer.Addr)
 	stopSigs := []os.Signal{os.Interrupt, os.Kill, syscall.SIGTERM}
 	stopCh := make(chan os.Signal, len(stopSigs))
 	signal.Notify(stopCh, stopSigs...)
-	select {
-	case err := <-errCh:
-		logger.Fatalf("Error during ListenAndServe: %+v", err)
-	case <-stopCh:
-		logger.Info("Caught interrupt, shutting down...")
-		httpServer.Close()
-		<-errCh
-	}
-}
-
-var youtrackBranchNameRegEx = regexp.MustCompile(`(?i)^(?:feature|release-fix)/([a-z]+)([0-9]+)`)
-
-// youtrackBranchNameFilter takes a branch name and returns the YouTrack id
-// associated with it, or an empty string if no id is associated with the
-// branch name.
-func youtrackBranchNameFilter(branchName string) string {
-	matches := youtrackBranchNameRegEx.FindStringSubmatch(branchName)
-	if matches != nil {
-		return fmt.Sprintf("%s-%s", strings.ToUpper(matches[1]), matches[2])
+	reloadCh := make(chan os.Signal, 1)
+	signal.Notify(reloadCh, syscall.SIGHUP)
+	// currentCfg is the config last loaded, that reloaded configs are
+	// compared to. The server settings remain those of the cfg.
+	currentCfg := cfg
+	for {
+		select {
+		case err := <-errCh:
+			logger.Fatalf("Error during ListenAndServe: %+v", err)
+		case <-reloadCh:
+			logger.Info("Caught SIGHUP, reloading handlers...")
+			newCfg, err := reloadHandlers(logger, app, *configFile, currentCfg, redactHook)
+			if err != nil {
+				logger.Errorf("Error reloading config, keeping the running handlers: %v", err)
+				continue
+			}
+			currentCfg = newCfg
+			logger.Info("Handlers reloaded")
+		case <-stopCh:
+			logger.Info("Caught interrupt, shutting down...")
+			// Stop accepting new requests, then wait for the app to finish
+			// handling the webhooks it is currently handling. Any unfinished
+			// webhooks remain in the job queue until we are started again.
+			ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+			defer cancel()
+			if err := httpServer.Shutdown(ctx); err != nil {
+				logger.Warnf("Error shutting down HTTP server: %+v", err)
+			}
+			<-errCh
+			if err := app.Shutdown(ctx); err != nil {
+				logger.Warnf("Error shutting down app: %+v", err)
+			}
+			return
+		}
 	}
-	return ""
 }